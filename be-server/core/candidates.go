@@ -0,0 +1,68 @@
+package core
+
+import (
+	"context"
+	"d2t_server/internal/tracing"
+	"errors"
+	"log/slog"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Candidate is one of several SQL generations for the same question
+type Candidate struct {
+	Generation
+	Temperature float64
+}
+
+// GenerateCandidates samples one generation per temperature concurrently and
+// returns the successful ones in temperature order. Failed samples are logged
+// and left out. When all of them fail, a request for clarification takes
+// precedence and is returned with its generation, like Generate does;
+// otherwise the first error is returned.
+func GenerateCandidates(ctx context.Context, req GenerateRequest, temperatures []float64) ([]Candidate, *Generation, error) {
+	ctx, span := tracing.Start(ctx, "nl2sql.candidates",
+		attribute.String("d2t.data_source", req.DataSource),
+		attribute.Int("d2t.candidates", len(temperatures)))
+
+	generations := make([]*Generation, len(temperatures))
+	errs := make([]error, len(temperatures))
+	var wg sync.WaitGroup
+	for i, temperature := range temperatures {
+		wg.Add(1)
+		go func(i int, temperature float64) {
+			defer wg.Done()
+			sample := req
+			sample.Temperature = &temperature
+			generations[i], errs[i] = Generate(ctx, sample)
+		}(i, temperature)
+	}
+	wg.Wait()
+
+	var candidates []Candidate
+	var clarification *Generation
+	var firstErr error
+	for i, generation := range generations {
+		switch {
+		case errs[i] == nil:
+			candidates = append(candidates, Candidate{Generation: *generation, Temperature: temperatures[i]})
+		case errors.Is(errs[i], ErrClarificationNeeded) && clarification == nil:
+			clarification = generation
+			firstErr = errs[i]
+		default:
+			slog.WarnContext(ctx, "sql candidate failed", "data_source", req.DataSource, "temperature", temperatures[i], "error", errs[i])
+			if firstErr == nil {
+				firstErr = errs[i]
+			}
+		}
+	}
+	span.SetAttributes(attribute.Int("d2t.candidates.generated", len(candidates)))
+
+	if len(candidates) == 0 {
+		tracing.End(span, firstErr)
+		return nil, clarification, firstErr
+	}
+	tracing.End(span, nil)
+	return candidates, nil, nil
+}
@@ -0,0 +1,306 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Chart types returned by RecommendChart
+const (
+	ChartLine        = "line"
+	ChartBar         = "bar"
+	ChartScatter     = "scatter"
+	ChartSingleValue = "single_value"
+)
+
+const (
+	// maxBarCategories is the largest number of distinct x values drawn as bars
+	maxBarCategories = 50
+	// maxSeries is the largest number of distinct values used as colour series
+	maxSeries = 10
+	// vegaLiteSchema is the Vega-Lite version the specs are written for
+	vegaLiteSchema = "https://vega.github.io/schema/vega-lite/v5.json"
+	// ChartDataName is the named dataset the Vega-Lite spec reads; clients
+	// bind the response's results to it instead of the spec embedding them
+	ChartDataName = "results"
+)
+
+// Chart is a visualisation recommended for a result set: a simple descriptor
+// plus an equivalent Vega-Lite spec
+type Chart struct {
+	Type string `json:"type"`
+	// X is the column on the x axis; empty for single values
+	X string `json:"x,omitempty"`
+	// Y lists the numeric columns plotted
+	Y []string `json:"y"`
+	// Series is the column that splits Y into coloured series
+	Series   string                 `json:"series,omitempty"`
+	VegaLite map[string]interface{} `json:"vega_lite"`
+}
+
+// column kinds inferred from the values
+const (
+	kindNumber   = "number"
+	kindTemporal = "temporal"
+	kindCategory = "category"
+)
+
+type columnProfile struct {
+	name     string
+	kind     string
+	distinct int
+	// ordinal marks numeric period columns such as year or month, which are
+	// plotted along a time axis but are not timestamps
+	ordinal bool
+	// identifier marks id columns, used as categories only when there is no
+	// descriptive one
+	identifier bool
+}
+
+// RecommendChart picks a chart from the column types and cardinality of the
+// results with fixed rules, or returns nil when a table fits best:
+//   - a single numeric cell is shown as a single value
+//   - a time or period column with numeric columns becomes a line chart, split
+//     into series by a low-cardinality category when there is one measure
+//   - a category with numeric columns becomes a bar chart, with a second
+//     low-cardinality category as series
+//   - two numeric columns without categories become a scatter plot
+func RecommendChart(results []map[string]interface{}) *Chart {
+	if len(results) == 0 {
+		return nil
+	}
+	profiles := profileColumns(results)
+
+	var temporal, numbers, categories []columnProfile
+	for _, p := range profiles {
+		switch {
+		case p.kind == kindTemporal || p.ordinal:
+			temporal = append(temporal, p)
+		case p.kind == kindNumber:
+			numbers = append(numbers, p)
+		case p.distinct > 1:
+			categories = append(categories, p)
+		}
+	}
+	if len(numbers) == 0 {
+		return nil
+	}
+	sort.SliceStable(categories, func(a, b int) bool {
+		return !categories[a].identifier && categories[b].identifier
+	})
+	measures := names(numbers)
+
+	switch {
+	case len(results) == 1 && len(profiles) == 1:
+		return newChart(ChartSingleValue, "", measures, "", nil)
+
+	case len(temporal) > 0:
+		x := temporal[0]
+		series := ""
+		if len(measures) == 1 {
+			series = lowCardinality(categories, maxSeries)
+		}
+		return newChart(ChartLine, x.name, measures, series, &x)
+
+	case len(categories) > 0:
+		x := categories[0]
+		if x.distinct > maxBarCategories {
+			return nil
+		}
+		series := ""
+		if len(measures) == 1 {
+			series = lowCardinality(categories[1:], maxSeries)
+		}
+		return newChart(ChartBar, x.name, measures, series, &x)
+
+	case len(numbers) == 2 && len(results) > 1:
+		return newChart(ChartScatter, numbers[0].name, measures[1:], "", &numbers[0])
+	}
+	return nil
+}
+
+// profileColumns infers kind and cardinality of every column, in name order
+func profileColumns(results []map[string]interface{}) []columnProfile {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, row := range results {
+		for name := range row {
+			if !seen[name] {
+				seen[name] = true
+				columns = append(columns, name)
+			}
+		}
+	}
+	sort.Strings(columns)
+
+	profiles := make([]columnProfile, 0, len(columns))
+	for _, name := range columns {
+		var values []interface{}
+		distinct := make(map[string]bool)
+		for _, row := range results {
+			if v := row[name]; v != nil {
+				values = append(values, v)
+				distinct[fmt.Sprint(v)] = true
+			}
+		}
+
+		p := columnProfile{name: name, kind: kindCategory, distinct: len(distinct)}
+		switch {
+		case len(values) == 0:
+		case isIdentifier(name):
+			// identifiers are numeric but never measures
+			p.identifier = true
+		case isNumeric(values):
+			p.kind = kindNumber
+			p.ordinal = isPeriod(name)
+		case isTemporal(values):
+			p.kind = kindTemporal
+		}
+		profiles = append(profiles, p)
+	}
+	return profiles
+}
+
+func isNumeric(values []interface{}) bool {
+	_, ok := numericValues(values)
+	return ok
+}
+
+// isTemporal accepts timestamps and date strings such as 2024-01-31 or 2024-01
+func isTemporal(values []interface{}) bool {
+	if _, ok := timeValues(values); ok {
+		return true
+	}
+	for _, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			return false
+		}
+		if _, err := time.Parse("2006-01-02", s); err == nil {
+			continue
+		}
+		if _, err := time.Parse("2006-01", s); err == nil {
+			continue
+		}
+		return false
+	}
+	return true
+}
+
+func isIdentifier(name string) bool {
+	name = strings.ToLower(name)
+	return name == "id" || strings.HasSuffix(name, "_id")
+}
+
+// periodNames are numeric column names that denote a point in time
+var periodNames = []string{"year", "quarter", "month", "week", "day", "hour"}
+
+func isPeriod(name string) bool {
+	name = strings.ToLower(name)
+	for _, period := range periodNames {
+		if name == period || strings.HasSuffix(name, "_"+period) || strings.HasPrefix(name, period+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// lowCardinality returns the first category with at most limit values
+func lowCardinality(categories []columnProfile, limit int) string {
+	for _, c := range categories {
+		if c.distinct <= limit {
+			return c.name
+		}
+	}
+	return ""
+}
+
+func names(profiles []columnProfile) []string {
+	result := make([]string, len(profiles))
+	for i, p := range profiles {
+		result[i] = p.name
+	}
+	return result
+}
+
+func newChart(chartType, x string, y []string, series string, xProfile *columnProfile) *Chart {
+	return &Chart{
+		Type:     chartType,
+		X:        x,
+		Y:        y,
+		Series:   series,
+		VegaLite: vegaLiteSpec(chartType, xProfile, y, series),
+	}
+}
+
+// vegaLiteSpec writes the chart as a Vega-Lite spec over the named dataset
+// ChartDataName. Numeric columns are converted with toNumber, since
+// PostgreSQL numeric values arrive as strings; several measures are folded
+// into a "measure"/"value" pair and coloured by measure.
+func vegaLiteSpec(chartType string, x *columnProfile, y []string, series string) map[string]interface{} {
+	transforms := make([]interface{}, 0, len(y)+1)
+	for _, field := range y {
+		transforms = append(transforms, map[string]interface{}{"calculate": "toNumber(datum[" + quoteVega(field) + "])", "as": field})
+	}
+
+	yField, color := y[0], series
+	if len(y) > 1 {
+		transforms = append(transforms, map[string]interface{}{"fold": y, "as": []string{"measure", "value"}})
+		yField, color = "value", "measure"
+	}
+
+	encoding := map[string]interface{}{}
+	mark := map[string]interface{}{"tooltip": true}
+	switch chartType {
+	case ChartSingleValue:
+		mark["type"] = "text"
+		mark["fontSize"] = 32
+		encoding["text"] = map[string]interface{}{"field": yField, "type": "quantitative", "format": ","}
+	case ChartLine:
+		mark["type"] = "line"
+		mark["point"] = true
+		encoding["x"] = axis(x, "temporal")
+		encoding["y"] = map[string]interface{}{"field": yField, "type": "quantitative"}
+	case ChartBar:
+		mark["type"] = "bar"
+		xEncoding := axis(x, "nominal")
+		xEncoding["sort"] = "-y"
+		encoding["x"] = xEncoding
+		encoding["y"] = map[string]interface{}{"field": yField, "type": "quantitative"}
+		if color != "" {
+			encoding["xOffset"] = map[string]interface{}{"field": color}
+		}
+	case ChartScatter:
+		mark["type"] = "point"
+		transforms = append(transforms, map[string]interface{}{"calculate": "toNumber(datum[" + quoteVega(x.name) + "])", "as": x.name})
+		encoding["x"] = map[string]interface{}{"field": x.name, "type": "quantitative"}
+		encoding["y"] = map[string]interface{}{"field": yField, "type": "quantitative"}
+	}
+	if color != "" {
+		encoding["color"] = map[string]interface{}{"field": color, "type": "nominal"}
+	}
+
+	return map[string]interface{}{
+		"$schema":   vegaLiteSchema,
+		"data":      map[string]interface{}{"name": ChartDataName},
+		"transform": transforms,
+		"mark":      mark,
+		"encoding":  encoding,
+	}
+}
+
+// axis encodes the x column; period numbers such as years are ordinal
+func axis(x *columnProfile, defaultType string) map[string]interface{} {
+	fieldType := defaultType
+	if x.ordinal {
+		fieldType = "ordinal"
+	}
+	return map[string]interface{}{"field": x.name, "type": fieldType}
+}
+
+// quoteVega quotes a field name as a Vega expression string literal
+func quoteVega(field string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(field) + "'"
+}
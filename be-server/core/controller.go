@@ -1,42 +1,230 @@
 package core
 
 import (
+	"context"
 	"d2t_server/internal/config"
+	"d2t_server/internal/metrics"
+	"d2t_server/internal/prompts"
+	"d2t_server/internal/tracing"
 	"d2t_server/utils"
+	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	// Import any database packages needed for executing SQL
+	"log/slog"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // ProcessNaturalLanguageQuery takes a natural language query, converts it to SQL and executes it
-// Returns both the generated SQL and the query result
-func ProcessNaturalLanguageQuery(nlQuery string) (string, string, error) {
+// Returns both the generated SQL and the query result. Optional few-shot examples are
+// included in the prompt ahead of the question.
+func ProcessNaturalLanguageQuery(nlQuery string, examples ...utils.FewShotExample) (string, string, error) {
 	// Step 1: Convert natural language to SQL using Deepseek with database schema
-	sqlQuery, err := utils.DeepseekRequest(nlQuery, "nl2sql_with_schema", config.DatabaseSchema)
+	sqlQuery, err := GenerateSQL(nlQuery, examples...)
 	if err != nil {
-		return "", "", fmt.Errorf("failed to convert natural language to SQL: %w", err)
-	}
-
-	if sqlQuery == "" {
-		return "", "", fmt.Errorf("empty SQL query returned from Deepseek")
-	} else {
-		sqlQuery = utils.CleanSQLFromMarkdown(sqlQuery)
-
+		return "", "", err
 	}
 
-	log.Printf("Natural language query converted to SQL: '%s'", sqlQuery)
-
 	// Step 2: Execute the SQL query against the database
 	// Note: This should be implemented based on your database setup
 	// For now, we're returning the SQL without executing it
 
 	// Step 3 (Optional): Analyze the SQL query for additional insights
-	analysisResult, err := utils.DeepseekRequest(sqlQuery, "analyze")
+	// We don't fail the whole process if analysis fails
+	analysisResult := AnalyzeSQL(sqlQuery, config.DefaultDataSource, nil)
+
+	return sqlQuery, analysisResult, nil
+}
+
+// GenerateRequest is the input of one NL-to-SQL generation
+type GenerateRequest struct {
+	Question   string
+	DataSource string
+	// SchemaDDL is the DDL of the data source; empty means config.DatabaseSchema
+	SchemaDDL string
+	// PromptVersions are workspace template overrides in PROMPT_VERSIONS syntax
+	PromptVersions string
+	Examples       []utils.FewShotExample
+	// Access limits the tables and columns shown to the model; nil shows the full schema
+	Access AccessChecker
+	// Clarification is the user's answer when the pipeline resumes after
+	// the model asked a clarifying question
+	Clarification *utils.Clarification
+	// Temperature overrides the sampling temperature of the model
+	Temperature *float64
+	// Meter, when set, receives the token usage of the LLM call
+	Meter *utils.UsageMeter
+}
+
+// Generation is the SQL produced for a question and the prompt version used
+type Generation struct {
+	SQL           string
+	PromptVersion string
+	// Details is set when the template asked for structured output and the
+	// model's answer passed validation
+	Details *GenerationDetails
+}
+
+// ErrClarificationNeeded is returned by Generate when the model asks the user
+// a question instead of answering with SQL
+var ErrClarificationNeeded = errors.New("clarification needed")
+
+// GenerateSQL converts a natural language query to SQL without executing or analyzing it
+func GenerateSQL(nlQuery string, examples ...utils.FewShotExample) (string, error) {
+	generation, err := Generate(context.Background(), GenerateRequest{Question: nlQuery, Examples: examples})
 	if err != nil {
-		// We don't fail the whole process if analysis fails
-		log.Printf("Warning: failed to analyze SQL query: %v", err)
-		analysisResult = "No analysis available"
+		return "", err
 	}
+	return generation.SQL, nil
+}
 
-	return sqlQuery, analysisResult, nil
+// generateMode is the prompt template mode used for SQL generation
+const generateMode = "nl2sql_with_schema"
+
+// PromptSchema returns the schema context shown to the model. The canonical
+// metric definitions of the semantic layer, which is defined on the built-in
+// schema, are appended to the schema. Restricted callers only see the tables,
+// columns and metrics they may query.
+func PromptSchema(req GenerateRequest) string {
+	ddl := req.SchemaDDL
+	builtin := ddl == "" || ddl == config.DatabaseSchema
+	if builtin {
+		ddl = config.DatabaseSchema
+	}
+	if req.Access != nil {
+		ddl = SchemaFor(ddl).Filter(req.Access).Render()
+	}
+	if builtin {
+		ddl += "\n" + SemanticPromptContext(FilterSemanticLayer(config.GetSemanticLayer(), req.Access))
+	}
+	return ddl
+}
+
+// Generate converts a natural language query to SQL using the prompt template
+// selected for the data source
+func Generate(ctx context.Context, req GenerateRequest) (generation *Generation, err error) {
+	ctx, span := tracing.Start(ctx, "nl2sql.generate",
+		attribute.String("d2t.data_source", req.DataSource),
+		attribute.Int("d2t.examples", len(req.Examples)))
+	defer func() { tracing.End(span, err) }()
+
+	// structured templates show the tables of every example in its answer
+	examples := make([]utils.FewShotExample, len(req.Examples))
+	for i, e := range req.Examples {
+		e.Tables = ExtractTables(e.SQL)
+		examples[i] = e
+	}
+
+	resp, err := utils.DeepseekPrompt(ctx, utils.PromptRequest{
+		Mode:           generateMode,
+		Input:          req.Question,
+		DataSource:     req.DataSource,
+		PromptVersions: req.PromptVersions,
+		Schema:         PromptSchema(req),
+		Examples:       examples,
+		Clarification:  req.Clarification,
+		Temperature:    req.Temperature,
+		Meter:          req.Meter,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert natural language to SQL: %w", err)
+	}
+
+	if resp.Content == "" {
+		return nil, fmt.Errorf("empty SQL query returned from Deepseek")
+	}
+
+	generation = &Generation{PromptVersion: resp.PromptVersion}
+	if resp.Format != prompts.ResponseFormatJSON {
+		generation.SQL = utils.CleanSQLFromMarkdown(resp.Content)
+	} else if generation.SQL, generation.Details, err = ParseStructuredGeneration(resp.Content); err != nil {
+		slog.WarnContext(ctx, "structured output invalid, extracting SQL from text", "prompt_version", resp.PromptVersion, "error", err)
+		metrics.StructuredOutputFallback(generateMode)
+		generation.SQL, err = ExtractGeneratedSQL(resp.Content), nil
+	}
+	span.SetAttributes(attribute.Bool("d2t.structured", generation.Details != nil))
+	if generation.Details != nil && generation.SQL == "" {
+		slog.InfoContext(ctx, "model asked for clarification", "data_source", req.DataSource, "prompt_version", resp.PromptVersion)
+		return generation, fmt.Errorf("%w: %s", ErrClarificationNeeded, generation.Details.Clarification)
+	}
+
+	span.SetAttributes(attribute.String("d2t.statement.hash", tracing.StatementHash(generation.SQL)))
+	slog.InfoContext(ctx, "sql generated", "data_source", req.DataSource, "prompt_version", resp.PromptVersion, "sql", generation.SQL)
+	return generation, nil
+}
+
+// analysisSampleRows bounds the number of result rows shown to the analysis model
+const analysisSampleRows = 20
+
+// NoAnalysis is returned by Analyze when the model could not explain the SQL
+const NoAnalysis = "No analysis available"
+
+// AnalyzeRequest is the input of one SQL analysis
+type AnalyzeRequest struct {
+	SQL            string
+	DataSource     string
+	PromptVersions string
+	// Results must already be masked; a bounded sample is shown to the model
+	Results []map[string]interface{}
+	Meter   *utils.UsageMeter
+}
+
+// AnalyzeSQL asks the model to explain the SQL; failures are not fatal and
+// yield a placeholder text
+func AnalyzeSQL(sqlQuery, dataSource string, results []map[string]interface{}) string {
+	return Analyze(context.Background(), AnalyzeRequest{SQL: sqlQuery, DataSource: dataSource, Results: results})
+}
+
+// Analyze asks the model to explain the SQL using the analyze template of the
+// data source; a sample of the results is made available to the template
+func Analyze(ctx context.Context, req AnalyzeRequest) string {
+	ctx, span := tracing.Start(ctx, "nl2sql.analyze",
+		attribute.String("d2t.data_source", req.DataSource),
+		attribute.Int("d2t.sample_rows", min(len(req.Results), analysisSampleRows)))
+	resp, err := utils.DeepseekPrompt(ctx, utils.PromptRequest{
+		Mode:           "analyze",
+		Input:          req.SQL,
+		DataSource:     req.DataSource,
+		PromptVersions: req.PromptVersions,
+		Results:        renderSample(req.Results, analysisSampleRows, 0),
+		Meter:          req.Meter,
+	})
+	tracing.End(span, err)
+	if err != nil {
+		metrics.PipelineError(metrics.StageAnalysis)
+		slog.WarnContext(ctx, "sql analysis failed", "data_source", req.DataSource, "error", err)
+		return NoAnalysis
+	}
+	return resp.Content
+}
+
+// renderSample renders up to limit rows as JSON lines, shortening long text
+// values; with maxChars > 0 rows that would exceed it are left out
+func renderSample(results []map[string]interface{}, limit, maxChars int) string {
+	var sb strings.Builder
+	for i, row := range results {
+		if i == limit {
+			sb.WriteString(fmt.Sprintf("... %d more rows\n", len(results)-limit))
+			break
+		}
+		shortened := make(map[string]interface{}, len(row))
+		for k, v := range row {
+			if s, ok := v.(string); ok {
+				v = truncateValue(s, maxValueChars)
+			}
+			shortened[k] = v
+		}
+		line, err := json.Marshal(shortened)
+		if err != nil {
+			continue
+		}
+		if maxChars > 0 && sb.Len()+len(line)+1 > maxChars {
+			sb.WriteString(fmt.Sprintf("... %d more rows\n", len(results)-i))
+			break
+		}
+		sb.Write(line)
+		sb.WriteString("\n")
+	}
+	return sb.String()
 }
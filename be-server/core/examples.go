@@ -0,0 +1,193 @@
+package core
+
+import (
+	"d2t_server/utils"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// stopWords are ignored when comparing questions
+var stopWords = map[string]bool{
+	"a": true, "an": true, "the": true, "of": true, "for": true, "to": true, "in": true,
+	"on": true, "by": true, "and": true, "or": true, "is": true, "are": true, "was": true,
+	"were": true, "what": true, "which": true, "who": true, "how": true, "me": true,
+	"show": true, "list": true, "give": true, "find": true, "get": true, "all": true,
+	"each": true, "per": true, "with": true, "that": true, "do": true, "does": true,
+	"have": true, "has": true, "many": true, "much": true,
+}
+
+// TokenizeQuestion splits a question into comparable terms: lower-cased latin
+// words without stop words, and character bigrams for CJK text
+func TokenizeQuestion(question string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+
+	flushWord := func() {
+		if len(word) == 0 {
+			return
+		}
+		w := string(word)
+		word = word[:0]
+		if stopWords[w] {
+			return
+		}
+		// naive plural folding so "orders" matches "order"
+		if len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss") {
+			w = strings.TrimSuffix(w, "s")
+		}
+		tokens = append(tokens, w)
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			tokens = append(tokens, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+
+	for _, r := range strings.ToLower(question) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+
+	return tokens
+}
+
+// SelectSimilarExamples returns up to k examples ranked by TF-IDF cosine
+// similarity between their question and the incoming question. Examples with
+// no term in common are never selected.
+func SelectSimilarExamples(question string, examples []utils.FewShotExample, k int) []utils.FewShotExample {
+	if k <= 0 || len(examples) == 0 {
+		return nil
+	}
+
+	queryTokens := TokenizeQuestion(question)
+	if len(queryTokens) == 0 {
+		return nil
+	}
+
+	docs := make([][]string, len(examples))
+	docFreq := make(map[string]int)
+	for i, e := range examples {
+		docs[i] = TokenizeQuestion(e.Question)
+		seen := make(map[string]bool)
+		for _, t := range docs[i] {
+			if !seen[t] {
+				seen[t] = true
+				docFreq[t]++
+			}
+		}
+	}
+
+	idf := func(term string) float64 {
+		return math.Log(float64(len(examples)+1)/float64(docFreq[term]+1)) + 1
+	}
+	queryVec := termVector(queryTokens, idf)
+
+	type scored struct {
+		index int
+		score float64
+	}
+	var ranked []scored
+	for i, doc := range docs {
+		score := cosine(queryVec, termVector(doc, idf))
+		if score > 0 {
+			ranked = append(ranked, scored{index: i, score: score})
+		}
+	}
+
+	sort.SliceStable(ranked, func(a, b int) bool {
+		return ranked[a].score > ranked[b].score
+	})
+
+	if len(ranked) > k {
+		ranked = ranked[:k]
+	}
+	selected := make([]utils.FewShotExample, len(ranked))
+	for i, r := range ranked {
+		selected[i] = examples[r.index]
+	}
+	return selected
+}
+
+func termVector(tokens []string, idf func(string) float64) map[string]float64 {
+	vec := make(map[string]float64)
+	for _, t := range tokens {
+		vec[t]++
+	}
+	for t, tf := range vec {
+		vec[t] = tf * idf(t)
+	}
+	return vec
+}
+
+func cosine(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for t, v := range a {
+		dot += v * b[t]
+		normA += v * v
+	}
+	for _, v := range b {
+		normB += v * v
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// questionPatterns maps a coarse intent to the keywords that signal it; the
+// first matching pattern wins
+var questionPatterns = []struct {
+	name     string
+	keywords []string
+}{
+	{"ranking", []string{"top", "best", "most", "least", "highest", "lowest", "rank", "最", "排名", "前"}},
+	{"trend", []string{"trend", "over time", "monthly", "yearly", "per month", "per year", "each month", "each year", "趋势", "每月", "每年"}},
+	{"count", []string{"how many", "count", "number of", "多少", "数量"}},
+	{"aggregate", []string{"total", "sum", "average", "avg", "mean", "合计", "总", "平均"}},
+	{"existence", []string{"never", "without", "not", "no", "没有", "从未"}},
+}
+
+// QuestionPattern classifies a question into a coarse intent pattern
+// (ranking, trend, count, aggregate, existence or lookup) for reporting
+func QuestionPattern(question string) string {
+	// latin keywords must match whole words, so punctuation is folded to spaces
+	normalized := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return ' '
+	}, question)
+	padded := " " + strings.Join(strings.Fields(normalized), " ") + " "
+
+	for _, p := range questionPatterns {
+		for _, kw := range p.keywords {
+			if kw[0] < utf8.RuneSelf {
+				if strings.Contains(padded, " "+kw+" ") {
+					return p.name
+				}
+			} else if strings.Contains(question, kw) {
+				return p.name
+			}
+		}
+	}
+	return "lookup"
+}
@@ -0,0 +1,39 @@
+package core
+
+import (
+	"crypto/sha256"
+	"d2t_server/internal/prompts"
+	"encoding/hex"
+	"strings"
+	"unicode"
+)
+
+// NormalizeQuestion folds case, collapses whitespace and drops trailing
+// punctuation so trivially different spellings of a question compare equal
+func NormalizeQuestion(question string) string {
+	question = strings.Join(strings.Fields(strings.ToLower(question)), " ")
+	return strings.TrimRightFunc(question, func(r rune) bool {
+		return unicode.IsPunct(r) || unicode.IsSpace(r)
+	})
+}
+
+// PromptFingerprint identifies everything besides the question that shapes
+// the generation prompt: the template version that will be used and a hash of
+// the schema context (after access filtering) and the few-shot examples.
+// Requests with equal fingerprints and normalised questions get the same prompt.
+func PromptFingerprint(req GenerateRequest) (promptVersion, contextHash string, err error) {
+	tmpl, err := prompts.ResolveFor(generateMode, req.DataSource, req.PromptVersions)
+	if err != nil {
+		return "", "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(PromptSchema(req)))
+	for _, e := range req.Examples {
+		h.Write([]byte{0})
+		h.Write([]byte(e.Question))
+		h.Write([]byte{0})
+		h.Write([]byte(e.SQL))
+	}
+	return tmpl.Version, hex.EncodeToString(h.Sum(nil)), nil
+}
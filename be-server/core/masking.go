@@ -0,0 +1,141 @@
+package core
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"d2t_server/internal/config"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+// fullMask replaces a value masked with config.MaskFull
+const fullMask = "****"
+
+// columnMask is the masking applied to one result column
+type columnMask struct {
+	strategy string
+	kind     string
+}
+
+// MaskResults masks PII in query results in place. Each result column is
+// matched by name to its lineage; columns derived from PII columns are masked
+// with the strictest strategy that applies to the caller's roles, and columns
+// traced only to non-PII columns are left as they are. Every other column —
+// one the lineage has no sources for, one that cannot be matched by name, or
+// all of them when lineage is nil because the SQL could not be analyzed — is
+// masked with the strictest strategy of the policy. Only string values are
+// changed; NULLs, numbers and dates pass through.
+func MaskResults(results []map[string]interface{}, lineage []ResultColumn, policy *config.PIIPolicy, roles []string) {
+	if len(results) == 0 || policy == nil || len(policy.Columns) == 0 {
+		return
+	}
+
+	strictest := columnMask{strategy: config.MaskNone}
+	for _, c := range policy.Columns {
+		strictest.strategy = config.StricterMask(strictest.strategy, c.StrategyFor(roles))
+	}
+	if strictest.strategy == config.MaskNone {
+		return
+	}
+
+	masks := make(map[string]columnMask, len(lineage))
+	for _, col := range lineage {
+		m := columnMask{strategy: config.MaskNone}
+		if len(col.Sources) == 0 {
+			m = strictest
+		} else if pii, ok := maskFor(col.Sources, policy, roles); ok {
+			m = pii
+		}
+		name := strings.ToLower(col.Name)
+		if existing, dup := masks[name]; dup {
+			if config.StricterMask(existing.strategy, m.strategy) == existing.strategy {
+				m = existing
+			}
+		}
+		masks[name] = m
+	}
+
+	for _, row := range results {
+		for key, value := range row {
+			s, isString := value.(string)
+			if !isString {
+				continue
+			}
+			m, ok := masks[strings.ToLower(key)]
+			if !ok {
+				m = strictest
+			}
+			if m.strategy == config.MaskNone {
+				continue
+			}
+			row[key] = MaskValue(s, m.strategy, m.kind, policy.HashKey)
+		}
+	}
+}
+
+// maskFor combines the PII policies of the sources of one result column
+func maskFor(sources []ColumnRef, policy *config.PIIPolicy, roles []string) (columnMask, bool) {
+	var m columnMask
+	found := false
+	for _, src := range sources {
+		c, ok := policy.Find(src.Table, src.Column)
+		if !ok {
+			continue
+		}
+		strategy := c.StrategyFor(roles)
+		if !found {
+			m = columnMask{strategy: strategy, kind: c.Kind}
+			found = true
+			continue
+		}
+		m.strategy = config.StricterMask(m.strategy, strategy)
+		if m.kind != c.Kind {
+			m.kind = ""
+		}
+	}
+	return m, found && m.strategy != config.MaskNone
+}
+
+// MaskValue masks one value with the given strategy
+func MaskValue(value, strategy, kind, hashKey string) string {
+	value = strings.TrimSpace(value)
+	switch strategy {
+	case config.MaskNone:
+		return value
+	case config.MaskPartial:
+		return partialMask(value, kind)
+	case config.MaskHash:
+		mac := hmac.New(sha256.New, []byte(hashKey))
+		mac.Write([]byte(value))
+		return hex.EncodeToString(mac.Sum(nil))[:16]
+	default:
+		return fullMask
+	}
+}
+
+// partialMask keeps just enough to recognise a value: j***@x.com for emails,
+// J*** S*** for names and the first character otherwise
+func partialMask(value, kind string) string {
+	if value == "" {
+		return value
+	}
+	switch kind {
+	case "email":
+		if at := strings.LastIndex(value, "@"); at > 0 {
+			return firstRune(value[:at]) + "***" + value[at:]
+		}
+	case "name":
+		words := strings.Fields(value)
+		for i, w := range words {
+			words[i] = firstRune(w) + "***"
+		}
+		return strings.Join(words, " ")
+	}
+	return firstRune(value) + "***"
+}
+
+func firstRune(s string) string {
+	r, _ := utf8.DecodeRuneInString(s)
+	return string(r)
+}
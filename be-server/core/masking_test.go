@@ -0,0 +1,105 @@
+package core
+
+import (
+	"d2t_server/internal/config"
+	"testing"
+)
+
+func TestMaskResults(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		row  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			name: "alias",
+			sql:  "SELECT c.cust_email AS contact, c.cust_name FROM Customers c",
+			row:  map[string]interface{}{"contact": "jane@x.com", "cust_name": "Jane"},
+			want: map[string]interface{}{"contact": "j***@x.com", "cust_name": "Jane"},
+		},
+		{
+			name: "expression",
+			sql:  "SELECT lower(cust_email) || '' AS e FROM Customers",
+			row:  map[string]interface{}{"e": "jane@x.com"},
+			want: map[string]interface{}{"e": "j***@x.com"},
+		},
+		{
+			name: "mixed sources take the stricter strategy",
+			sql:  "SELECT cust_contact || cust_address AS x FROM Customers",
+			row:  map[string]interface{}{"x": "Jane Doe 1 Main St"},
+			want: map[string]interface{}{"x": fullMask},
+		},
+		{
+			name: "cte",
+			sql:  "WITH c AS (SELECT cust_email AS m FROM Customers) SELECT m AS out FROM c",
+			row:  map[string]interface{}{"out": "jane@x.com"},
+			want: map[string]interface{}{"out": "j***@x.com"},
+		},
+		{
+			name: "column alias list",
+			sql:  "SELECT e FROM Customers AS c(a,b,c3,d,e1,f,g,h,e)",
+			row:  map[string]interface{}{"e": "jane@x.com"},
+			want: map[string]interface{}{"e": "j***@x.com"},
+		},
+		{
+			name: "untraced column gets the strictest strategy",
+			sql:  "SELECT 'x' AS label, cust_name FROM Customers",
+			row:  map[string]interface{}{"label": "x", "cust_name": "Jane"},
+			want: map[string]interface{}{"label": fullMask, "cust_name": "Jane"},
+		},
+		{
+			name: "unmatched column gets the strictest strategy",
+			sql:  "SELECT cust_name FROM Customers",
+			row:  map[string]interface{}{"cust_name": "Jane", "other": "jane@x.com"},
+			want: map[string]interface{}{"cust_name": "Jane", "other": fullMask},
+		},
+		{
+			name: "non-string values pass through",
+			sql:  "SELECT cust_email FROM Customers",
+			row:  map[string]interface{}{"cust_email": nil},
+			want: map[string]interface{}{"cust_email": nil},
+		},
+	}
+
+	policy := &config.DefaultPIIPolicy
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lineage, err := ResultLineage(tt.sql, DefaultSchema())
+			if err != nil {
+				t.Fatalf("ResultLineage(%q): %v", tt.sql, err)
+			}
+			results := []map[string]interface{}{tt.row}
+			MaskResults(results, lineage, policy, nil)
+			for key, want := range tt.want {
+				if got := results[0][key]; got != want {
+					t.Errorf("%s = %v, want %v", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestMaskResultsWithoutLineage(t *testing.T) {
+	results := []map[string]interface{}{{"cust_name": "Jane", "n": 3}}
+	MaskResults(results, nil, &config.DefaultPIIPolicy, nil)
+	if results[0]["cust_name"] != fullMask || results[0]["n"] != 3 {
+		t.Fatalf("got %v, want every string masked", results[0])
+	}
+}
+
+func TestMaskResultsRoleOverride(t *testing.T) {
+	policy := &config.PIIPolicy{Columns: []config.PIIColumn{
+		{Table: "Customers", Column: "cust_email", Kind: "email", Strategy: config.MaskFull,
+			Roles: map[string]string{"support": config.MaskNone}},
+	}}
+	lineage, err := ResultLineage("SELECT 'x' AS label, cust_email FROM Customers", DefaultSchema())
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []map[string]interface{}{{"label": "x", "cust_email": "jane@x.com"}}
+	MaskResults(results, lineage, policy, []string{"support"})
+	if results[0]["label"] != "x" || results[0]["cust_email"] != "jane@x.com" {
+		t.Fatalf("got %v, want nothing masked for a role that sees every column", results[0])
+	}
+}
@@ -0,0 +1,278 @@
+package core
+
+import (
+	"d2t_server/internal/config"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// AccessChecker decides which tables and columns a caller may use. A nil
+// AccessChecker means unrestricted access.
+type AccessChecker interface {
+	TableAllowed(table string) bool
+	ColumnAllowed(table, column string) bool
+}
+
+// Schema is a structured view of a DDL script: tables with their column
+// definitions, plus the constraint statements that reference them
+type Schema struct {
+	Tables      []*TableDef
+	Constraints []ConstraintDef
+}
+
+// TableDef is one CREATE TABLE statement
+type TableDef struct {
+	Name    string
+	Comment string
+	Columns []ColumnDef
+}
+
+// ColumnDef is one column line of a CREATE TABLE statement
+type ColumnDef struct {
+	Name       string
+	Definition string
+}
+
+// ConstraintDef is an ALTER TABLE statement together with the tables and
+// columns it mentions, so it can be dropped when any of them is hidden
+type ConstraintDef struct {
+	Statement string
+	Columns   map[string][]string
+}
+
+var (
+	createTablePattern = regexp.MustCompile(`(?is)(--[^\n]*\n\s*)?CREATE\s+TABLE\s+(\w+)\s*\((.*?)\)\s*;`)
+	alterTablePattern  = regexp.MustCompile(`(?is)ALTER\s+TABLE\s+(\w+)\s+(.*?);`)
+	referencesPattern  = regexp.MustCompile(`(?is)REFERENCES\s+(\w+)\s*\(([^)]*)\)`)
+	keyColumnsPattern  = regexp.MustCompile(`(?is)KEY\s*\(([^)]*)\)`)
+)
+
+var (
+	defaultSchema     *Schema
+	defaultSchemaOnce sync.Once
+
+	// parsedSchemas caches SchemaFor by DDL text
+	parsedSchemas sync.Map
+)
+
+// DefaultSchema returns config.DatabaseSchema parsed once
+func DefaultSchema() *Schema {
+	defaultSchemaOnce.Do(func() {
+		defaultSchema = ParseSchema(config.DatabaseSchema)
+	})
+	return defaultSchema
+}
+
+// SchemaFor returns the parsed form of a data source DDL; each distinct DDL is
+// parsed once and the result must not be modified
+func SchemaFor(ddl string) *Schema {
+	if ddl == "" || ddl == config.DatabaseSchema {
+		return DefaultSchema()
+	}
+	if schema, ok := parsedSchemas.Load(ddl); ok {
+		return schema.(*Schema)
+	}
+	schema, _ := parsedSchemas.LoadOrStore(ddl, ParseSchema(ddl))
+	return schema.(*Schema)
+}
+
+// ParseSchema extracts tables, columns and ALTER TABLE constraints from a DDL
+// script in the format of config.DatabaseSchema
+func ParseSchema(ddl string) *Schema {
+	schema := &Schema{}
+
+	for _, m := range createTablePattern.FindAllStringSubmatch(ddl, -1) {
+		table := &TableDef{Name: m[2], Comment: strings.TrimSpace(m[1])}
+		for _, line := range splitColumnDefinitions(m[3]) {
+			fields := strings.Fields(line)
+			if len(fields) == 0 {
+				continue
+			}
+			table.Columns = append(table.Columns, ColumnDef{
+				Name:       fields[0],
+				Definition: strings.TrimSpace(strings.TrimPrefix(line, fields[0])),
+			})
+		}
+		schema.Tables = append(schema.Tables, table)
+	}
+
+	for _, m := range alterTablePattern.FindAllStringSubmatch(ddl, -1) {
+		c := ConstraintDef{
+			Statement: strings.TrimSpace(m[0]),
+			Columns:   make(map[string][]string),
+		}
+		owner := strings.ToLower(m[1])
+		c.Columns[owner] = nil
+		if key := keyColumnsPattern.FindStringSubmatch(m[2]); key != nil {
+			c.Columns[owner] = splitNames(key[1])
+		}
+		for _, ref := range referencesPattern.FindAllStringSubmatch(m[2], -1) {
+			refTable := strings.ToLower(ref[1])
+			c.Columns[refTable] = append(c.Columns[refTable], splitNames(ref[2])...)
+		}
+		schema.Constraints = append(schema.Constraints, c)
+	}
+
+	return schema
+}
+
+// splitColumnDefinitions splits the body of CREATE TABLE on top-level commas
+func splitColumnDefinitions(body string) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i, r := range body {
+		switch r {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				parts = append(parts, strings.TrimSpace(body[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if rest := strings.TrimSpace(body[start:]); rest != "" {
+		parts = append(parts, rest)
+	}
+	return parts
+}
+
+func splitNames(list string) []string {
+	var names []string
+	for _, n := range strings.Split(list, ",") {
+		if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// Table returns the table definition by case-insensitive name
+func (s *Schema) Table(name string) (*TableDef, bool) {
+	for _, t := range s.Tables {
+		if strings.EqualFold(t.Name, name) {
+			return t, true
+		}
+	}
+	return nil, false
+}
+
+// HasColumn reports whether the table defines the column
+func (t *TableDef) HasColumn(column string) bool {
+	for _, c := range t.Columns {
+		if strings.EqualFold(c.Name, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// Filter returns a copy of the schema that only contains the tables and
+// columns permitted by access; constraints touching hidden objects are dropped
+func (s *Schema) Filter(access AccessChecker) *Schema {
+	if access == nil {
+		return s
+	}
+
+	filtered := &Schema{}
+	for _, t := range s.Tables {
+		if !access.TableAllowed(t.Name) {
+			continue
+		}
+		copied := &TableDef{Name: t.Name, Comment: t.Comment}
+		for _, c := range t.Columns {
+			if access.ColumnAllowed(t.Name, c.Name) {
+				copied.Columns = append(copied.Columns, c)
+			}
+		}
+		if len(copied.Columns) > 0 {
+			filtered.Tables = append(filtered.Tables, copied)
+		}
+	}
+
+	for _, c := range s.Constraints {
+		visible := true
+		for table, columns := range c.Columns {
+			if !access.TableAllowed(table) {
+				visible = false
+				break
+			}
+			for _, col := range columns {
+				if !access.ColumnAllowed(table, col) {
+					visible = false
+					break
+				}
+			}
+		}
+		if visible {
+			filtered.Constraints = append(filtered.Constraints, c)
+		}
+	}
+	return filtered
+}
+
+// Render turns the schema back into a DDL script for the prompt
+func (s *Schema) Render() string {
+	var sb strings.Builder
+	for _, t := range s.Tables {
+		if t.Comment != "" {
+			sb.WriteString(t.Comment + "\n")
+		}
+		sb.WriteString("CREATE TABLE " + t.Name + "\n(\n")
+		for i, c := range t.Columns {
+			sb.WriteString("  " + c.Name + " " + c.Definition)
+			if i < len(t.Columns)-1 {
+				sb.WriteString(",")
+			}
+			sb.WriteString("\n")
+		}
+		sb.WriteString(");\n\n")
+	}
+	for _, c := range s.Constraints {
+		sb.WriteString(c.Statement + "\n")
+	}
+	return sb.String()
+}
+
+// FilterSemanticLayer drops metrics, dimensions and joins whose definitions
+// reference tables or columns hidden by access
+func FilterSemanticLayer(layer *config.SemanticLayer, access AccessChecker) *config.SemanticLayer {
+	if access == nil || layer == nil {
+		return layer
+	}
+
+	visible := func(table, expression string) bool {
+		if !access.TableAllowed(table) {
+			return false
+		}
+		for _, m := range qualifiedColumnPattern.FindAllStringSubmatch(expression, -1) {
+			if !access.TableAllowed(m[1]) || !access.ColumnAllowed(m[1], m[2]) {
+				return false
+			}
+		}
+		return true
+	}
+
+	filtered := &config.SemanticLayer{}
+	for _, m := range layer.Metrics {
+		if visible(m.Table, m.Expression) {
+			filtered.Metrics = append(filtered.Metrics, m)
+		}
+	}
+	for _, d := range layer.Dimensions {
+		if visible(d.Table, d.Expression) {
+			filtered.Dimensions = append(filtered.Dimensions, d)
+		}
+	}
+	for _, j := range layer.Joins {
+		if visible(j.From, j.On) && access.TableAllowed(j.To) {
+			filtered.Joins = append(filtered.Joins, j)
+		}
+	}
+	return filtered
+}
+
+var qualifiedColumnPattern = regexp.MustCompile(`\b([A-Za-z_]\w*)\.([A-Za-z_]\w*)\b`)
@@ -0,0 +1,253 @@
+package core
+
+import (
+	"d2t_server/internal/config"
+	"fmt"
+	"strings"
+)
+
+// MetricQuery describes a request against the semantic layer:
+// which metrics to compute, grouped by which dimensions
+type MetricQuery struct {
+	Metrics    []string       `json:"metrics"`
+	Dimensions []string       `json:"dimensions"`
+	Filters    []MetricFilter `json:"filters"`
+	OrderBy    string         `json:"order_by"`
+	Descending bool           `json:"descending"`
+	Limit      int            `json:"limit"`
+}
+
+// MetricFilter restricts a metric query on a dimension value
+type MetricFilter struct {
+	Dimension string      `json:"dimension"`
+	Operator  string      `json:"operator"`
+	Value     interface{} `json:"value"`
+}
+
+// allowedFilterOperators whitelists the comparison operators accepted in filters
+var allowedFilterOperators = map[string]string{
+	"=":    "=",
+	"!=":   "<>",
+	"<>":   "<>",
+	">":    ">",
+	">=":   ">=",
+	"<":    "<",
+	"<=":   "<=",
+	"like": "LIKE",
+}
+
+// CompileMetricQuery deterministically turns a metric query into SQL using the
+// canonical definitions of the semantic layer. Filter values are returned as
+// positional arguments instead of being inlined into the statement.
+func CompileMetricQuery(layer *config.SemanticLayer, q MetricQuery) (string, []interface{}, error) {
+	if len(q.Metrics) == 0 {
+		return "", nil, fmt.Errorf("at least one metric is required")
+	}
+
+	var selects []string
+	var groupBy []string
+	var tables []string
+	var args []interface{}
+
+	for _, name := range q.Dimensions {
+		d, ok := layer.FindDimension(name)
+		if !ok {
+			return "", nil, fmt.Errorf("unknown dimension: %s", name)
+		}
+		selects = append(selects, fmt.Sprintf("%s AS %s", d.Expression, d.Name))
+		groupBy = append(groupBy, d.Expression)
+		tables = append(tables, d.Table)
+	}
+
+	var baseTable string
+	for _, name := range q.Metrics {
+		m, ok := layer.FindMetric(name)
+		if !ok {
+			return "", nil, fmt.Errorf("unknown metric: %s", name)
+		}
+		if baseTable == "" {
+			baseTable = m.Table
+		}
+		selects = append(selects, fmt.Sprintf("%s AS %s", m.Expression, m.Name))
+		tables = append(tables, m.Table)
+	}
+
+	var where []string
+	for _, f := range q.Filters {
+		d, ok := layer.FindDimension(f.Dimension)
+		if !ok {
+			return "", nil, fmt.Errorf("unknown filter dimension: %s", f.Dimension)
+		}
+		op := strings.ToLower(strings.TrimSpace(f.Operator))
+		if op == "" {
+			op = "="
+		}
+
+		if op == "in" {
+			values, ok := f.Value.([]interface{})
+			if !ok || len(values) == 0 {
+				return "", nil, fmt.Errorf("filter on %s with operator IN requires a non-empty list", f.Dimension)
+			}
+			placeholders := make([]string, len(values))
+			for i, v := range values {
+				args = append(args, v)
+				placeholders[i] = fmt.Sprintf("$%d", len(args))
+			}
+			where = append(where, fmt.Sprintf("%s IN (%s)", d.Expression, strings.Join(placeholders, ", ")))
+		} else {
+			sqlOp, ok := allowedFilterOperators[op]
+			if !ok {
+				return "", nil, fmt.Errorf("unsupported filter operator: %s", f.Operator)
+			}
+			args = append(args, f.Value)
+			where = append(where, fmt.Sprintf("%s %s $%d", d.Expression, sqlOp, len(args)))
+		}
+		tables = append(tables, d.Table)
+	}
+
+	from, err := buildJoinClause(layer, baseTable, tables)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("SELECT ")
+	sb.WriteString(strings.Join(selects, ", "))
+	sb.WriteString("\nFROM ")
+	sb.WriteString(from)
+	if len(where) > 0 {
+		sb.WriteString("\nWHERE ")
+		sb.WriteString(strings.Join(where, " AND "))
+	}
+	if len(groupBy) > 0 {
+		sb.WriteString("\nGROUP BY ")
+		sb.WriteString(strings.Join(groupBy, ", "))
+	}
+
+	if q.OrderBy != "" {
+		orderBy, ok := selectedName(layer, q, q.OrderBy)
+		if !ok {
+			return "", nil, fmt.Errorf("order_by must reference a selected metric or dimension: %s", q.OrderBy)
+		}
+		direction := "ASC"
+		if q.Descending {
+			direction = "DESC"
+		}
+		sb.WriteString(fmt.Sprintf("\nORDER BY %s %s", orderBy, direction))
+	}
+	if q.Limit > 0 {
+		sb.WriteString(fmt.Sprintf("\nLIMIT %d", q.Limit))
+	}
+
+	return sb.String(), args, nil
+}
+
+// buildJoinClause connects every required table to the base table by walking
+// the join graph of the semantic layer (breadth-first, shortest path)
+func buildJoinClause(layer *config.SemanticLayer, baseTable string, tables []string) (string, error) {
+	type edge struct {
+		to string
+		on string
+	}
+	graph := make(map[string][]edge)
+	for _, j := range layer.Joins {
+		from, to := strings.ToLower(j.From), strings.ToLower(j.To)
+		graph[from] = append(graph[from], edge{to: j.To, on: j.On})
+		graph[to] = append(graph[to], edge{to: j.From, on: j.On})
+	}
+
+	joined := map[string]bool{strings.ToLower(baseTable): true}
+	clause := baseTable
+
+	for _, target := range tables {
+		if joined[strings.ToLower(target)] {
+			continue
+		}
+
+		// BFS from every already joined table towards the target
+		prev := make(map[string]string)
+		via := make(map[string]edge)
+		visited := make(map[string]bool)
+		var queue []string
+		for t := range joined {
+			visited[t] = true
+			queue = append(queue, t)
+		}
+
+		found := false
+		for len(queue) > 0 && !found {
+			current := queue[0]
+			queue = queue[1:]
+			for _, e := range graph[current] {
+				next := strings.ToLower(e.to)
+				if visited[next] {
+					continue
+				}
+				visited[next] = true
+				prev[next] = current
+				via[next] = e
+				if next == strings.ToLower(target) {
+					found = true
+					break
+				}
+				queue = append(queue, next)
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("no join path from %s to %s", baseTable, target)
+		}
+
+		// Rebuild the path and append joins in order
+		var path []string
+		for t := strings.ToLower(target); !joined[t]; t = prev[t] {
+			path = append([]string{t}, path...)
+		}
+		for _, t := range path {
+			e := via[t]
+			clause += fmt.Sprintf("\nJOIN %s ON %s", e.to, e.on)
+			joined[t] = true
+		}
+	}
+
+	return clause, nil
+}
+
+// SemanticPromptContext renders the canonical metric and dimension definitions
+// so they can be injected into the nl2sql prompt next to the schema
+func SemanticPromptContext(layer *config.SemanticLayer) string {
+	if layer == nil || (len(layer.Metrics) == 0 && len(layer.Dimensions) == 0) {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("-- Business definitions (always use these exact expressions when the question mentions them)\n")
+	for _, m := range layer.Metrics {
+		sb.WriteString(fmt.Sprintf("-- metric %s: %s", m.Name, m.Expression))
+		if len(m.Synonyms) > 0 {
+			sb.WriteString(fmt.Sprintf(" (also called: %s)", strings.Join(m.Synonyms, ", ")))
+		}
+		sb.WriteString("\n")
+	}
+	for _, d := range layer.Dimensions {
+		sb.WriteString(fmt.Sprintf("-- dimension %s: %s\n", d.Name, d.Expression))
+	}
+	for _, j := range layer.Joins {
+		sb.WriteString(fmt.Sprintf("-- join %s -> %s: %s\n", j.From, j.To, j.On))
+	}
+	return sb.String()
+}
+
+// selectedName resolves name to the canonical alias of a selected metric or dimension
+func selectedName(layer *config.SemanticLayer, q MetricQuery, name string) (string, bool) {
+	for _, n := range q.Metrics {
+		if m, ok := layer.FindMetric(n); ok && strings.EqualFold(m.Name, name) {
+			return m.Name, true
+		}
+	}
+	for _, n := range q.Dimensions {
+		if d, ok := layer.FindDimension(n); ok && strings.EqualFold(d.Name, name) {
+			return d.Name, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,1064 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrSQLNotAllowed is returned when generated SQL touches objects the caller may not use
+var ErrSQLNotAllowed = errors.New("generated SQL is not allowed")
+
+// publicSchema is the only schema a table reference may name
+const publicSchema = "public"
+
+// writeKeywords are rejected anywhere in SQL checked for a restricted caller
+var writeKeywords = map[string]bool{
+	"insert": true, "update": true, "delete": true, "merge": true, "truncate": true,
+	"drop": true, "alter": true, "create": true, "grant": true, "revoke": true,
+	"copy": true, "call": true, "do": true, "execute": true, "vacuum": true,
+	"reindex": true, "cluster": true, "comment": true, "lock": true, "set": true,
+	"reset": true, "refresh": true, "listen": true, "notify": true, "prepare": true,
+	"into": true,
+}
+
+// allowedFunctions are the only functions generated SQL may call: read-only
+// aggregate, window, scalar and set-returning functions. Anything else could
+// change session or database state (set_config, setval, lo_unlink,
+// pg_advisory_lock, pg_notify, ...), read server files or the catalog, or run
+// a query given as a string, which would escape both this analysis and
+// row-level security.
+var allowedFunctions = map[string]bool{
+	// aggregates
+	"count": true, "sum": true, "avg": true, "min": true, "max": true,
+	"stddev": true, "stddev_pop": true, "stddev_samp": true, "variance": true,
+	"var_pop": true, "var_samp": true, "string_agg": true, "array_agg": true,
+	"json_agg": true, "jsonb_agg": true, "json_object_agg": true, "jsonb_object_agg": true,
+	"bool_and": true, "bool_or": true, "every": true, "bit_and": true, "bit_or": true,
+	"percentile_cont": true, "percentile_disc": true, "mode": true, "corr": true,
+	"covar_pop": true, "covar_samp": true, "regr_slope": true, "regr_intercept": true,
+	"regr_r2": true, "regr_count": true, "regr_avgx": true, "regr_avgy": true,
+	"rollup": true, "cube": true,
+	// window functions
+	"row_number": true, "rank": true, "dense_rank": true, "percent_rank": true,
+	"cume_dist": true, "ntile": true, "lag": true, "lead": true,
+	"first_value": true, "last_value": true, "nth_value": true,
+	// conditionals and casts
+	"coalesce": true, "nullif": true, "greatest": true, "least": true, "cast": true,
+	// numbers
+	"abs": true, "ceil": true, "ceiling": true, "floor": true, "round": true,
+	"trunc": true, "sign": true, "sqrt": true, "cbrt": true, "power": true, "pow": true,
+	"exp": true, "ln": true, "log": true, "log10": true, "mod": true, "div": true,
+	"pi": true, "degrees": true, "radians": true, "width_bucket": true,
+	// strings
+	"length": true, "char_length": true, "character_length": true, "octet_length": true,
+	"lower": true, "upper": true, "initcap": true, "trim": true, "btrim": true,
+	"ltrim": true, "rtrim": true, "substr": true, "substring": true, "position": true,
+	"strpos": true, "replace": true, "concat": true, "concat_ws": true, "lpad": true,
+	"rpad": true, "repeat": true, "reverse": true, "split_part": true, "starts_with": true,
+	"overlay": true, "translate": true, "format": true, "md5": true, "ascii": true,
+	"chr": true, "regexp_replace": true, "regexp_match": true, "regexp_matches": true,
+	"regexp_split_to_array": true, "string_to_array": true, "array_to_string": true,
+	"to_char": true, "to_number": true, "to_date": true, "to_timestamp": true,
+	// dates and times
+	"now": true, "date_trunc": true, "date_part": true, "extract": true, "age": true,
+	"date_bin": true, "make_date": true, "make_time": true, "make_timestamp": true,
+	"make_interval": true, "justify_days": true, "justify_hours": true,
+	"justify_interval": true, "isfinite": true, "clock_timestamp": true,
+	"statement_timestamp": true, "transaction_timestamp": true, "timezone": true,
+	// json and arrays
+	"to_json": true, "to_jsonb": true, "row_to_json": true, "json_build_object": true,
+	"jsonb_build_object": true, "json_build_array": true, "jsonb_build_array": true,
+	"json_extract_path": true, "json_extract_path_text": true, "jsonb_extract_path": true,
+	"jsonb_extract_path_text": true, "json_array_length": true, "jsonb_array_length": true,
+	"json_typeof": true, "jsonb_typeof": true, "array_length": true, "cardinality": true,
+	"array_position": true, "array_remove": true, "array_append": true, "array_cat": true,
+	"array_lower": true, "array_upper": true,
+	// set-returning functions, usable in FROM
+	"unnest": true, "generate_series": true, "generate_subscripts": true,
+	"json_each": true, "jsonb_each": true, "json_each_text": true, "jsonb_each_text": true,
+	"json_array_elements": true, "jsonb_array_elements": true,
+	"json_array_elements_text": true, "jsonb_array_elements_text": true,
+	"json_object_keys": true, "jsonb_object_keys": true,
+}
+
+// fromClauseEnd lists the keywords that terminate a FROM clause
+var fromClauseEnd = map[string]bool{
+	"where": true, "group": true, "having": true, "window": true, "order": true,
+	"limit": true, "offset": true, "fetch": true, "for": true, "union": true,
+	"intersect": true, "except": true, "returning": true,
+}
+
+// joinKeywords may appear between FROM items
+var joinKeywords = map[string]bool{
+	"join": true, "inner": true, "left": true, "right": true, "full": true,
+	"outer": true, "cross": true, "natural": true, "lateral": true,
+}
+
+// notAlias lists keywords that can follow a table reference but are not an alias
+var notAlias = map[string]bool{
+	"on": true, "using": true, "where": true, "group": true, "having": true,
+	"window": true, "order": true, "limit": true, "offset": true, "fetch": true,
+	"for": true, "union": true, "intersect": true, "except": true, "join": true,
+	"inner": true, "left": true, "right": true, "full": true, "outer": true,
+	"cross": true, "natural": true, "lateral": true, "tablesample": true, "with": true,
+}
+
+// expressionKeywords are words that can appear unquoted in a query without
+// naming a column. A bare name that resolves to no column is only accepted
+// when it is one of them.
+var expressionKeywords = map[string]bool{
+	"select": true, "from": true, "where": true, "group": true, "by": true, "having": true,
+	"window": true, "order": true, "limit": true, "offset": true, "fetch": true, "first": true,
+	"next": true, "row": true, "rows": true, "only": true, "with": true, "ties": true,
+	"union": true, "intersect": true, "except": true, "all": true, "distinct": true,
+	"on": true, "as": true, "and": true, "or": true, "not": true, "is": true, "null": true,
+	"true": true, "false": true, "unknown": true, "like": true, "ilike": true, "similar": true,
+	"to": true, "escape": true, "between": true, "symmetric": true, "asymmetric": true,
+	"in": true, "exists": true, "any": true, "some": true, "case": true, "when": true,
+	"then": true, "else": true, "end": true, "asc": true, "desc": true, "nulls": true,
+	"last": true, "using": true, "join": true, "inner": true, "left": true, "right": true,
+	"full": true, "outer": true, "cross": true, "natural": true, "lateral": true,
+	"values": true, "table": true, "interval": true, "date": true, "time": true,
+	"timestamp": true, "zone": true, "at": true, "double": true, "precision": true,
+	"varying": true, "character": true, "without": true, "local": true, "collate": true,
+	"over": true, "partition": true, "range": true, "groups": true, "unbounded": true,
+	"preceding": true, "following": true, "current": true, "exclude": true, "others": true,
+	"no": true, "filter": true, "within": true, "ordinality": true, "tablesample": true,
+	"repeatable": true, "bernoulli": true, "system": true, "array": true, "isnull": true,
+	"notnull": true, "overlaps": true, "epoch": true, "millennium": true, "century": true,
+	"decade": true, "year": true, "quarter": true, "month": true, "week": true, "day": true,
+	"hour": true, "minute": true, "second": true, "milliseconds": true, "microseconds": true,
+	"dow": true, "doy": true, "isodow": true, "isoyear": true, "timezone": true,
+	"timezone_hour": true, "timezone_minute": true, "both": true, "leading": true,
+	"trailing": true, "for": true, "placing": true, "current_date": true,
+	"current_time": true, "current_timestamp": true, "localtime": true,
+	"localtimestamp": true, "current_user": true, "session_user": true, "user": true,
+	"current_role": true, "default": true, "grouping": true, "sets": true,
+	"recursive": true, "materialized": true,
+}
+
+// relation is the lineage of a derived table, CTE, table function or a base
+// table with a column alias list: its output columns in order plus the union
+// of all their sources, used whenever a reference cannot be attributed to a
+// single column
+type relation struct {
+	columns []ResultColumn
+	all     map[ColumnRef]bool
+	// base is set for a base table whose columns were renamed, e.g.
+	// customers AS c(a, b); its references still need the column checks
+	base string
+}
+
+func newRelation(columns []ResultColumn) *relation {
+	r := &relation{columns: columns, all: make(map[ColumnRef]bool)}
+	for _, c := range columns {
+		for _, src := range c.Sources {
+			r.all[src] = true
+		}
+	}
+	return r
+}
+
+// sources returns the lineage of one output column of the relation
+func (r *relation) sources(name string) map[ColumnRef]bool {
+	for _, c := range r.columns {
+		if c.Name == name {
+			set := make(map[ColumnRef]bool)
+			for _, src := range c.Sources {
+				set[src] = true
+			}
+			return set
+		}
+	}
+	return r.all
+}
+
+func (r *relation) has(name string) bool {
+	for _, c := range r.columns {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sqlScope holds the FROM items visible in one SELECT block
+type sqlScope struct {
+	parent  *sqlScope
+	tables  map[string]string    // alias or table name -> base table
+	derived map[string]*relation // aliases of subqueries, CTE references and table functions
+	ctes    map[string]*relation
+	order   []string // FROM items in order, for * expansion
+	// outputs are the output column names, which ORDER BY and GROUP BY may use
+	outputs map[string]bool
+}
+
+func newSQLScope(parent *sqlScope) *sqlScope {
+	return &sqlScope{
+		parent:  parent,
+		tables:  make(map[string]string),
+		derived: make(map[string]*relation),
+		ctes:    make(map[string]*relation),
+		outputs: make(map[string]bool),
+	}
+}
+
+func (s *sqlScope) cte(name string) (*relation, bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if r, ok := sc.ctes[name]; ok {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+// resolve finds what a qualifier refers to, searching enclosing scopes for
+// correlated subqueries
+func (s *sqlScope) resolve(name string) (table string, derived *relation, ok bool) {
+	for sc := s; sc != nil; sc = sc.parent {
+		if t, found := sc.tables[name]; found {
+			return t, nil, true
+		}
+		if r, found := sc.derived[name]; found {
+			return "", r, true
+		}
+	}
+	return "", nil, false
+}
+
+// sqlGuard walks a tokenized statement, checking references against an
+// AccessChecker (nil = unrestricted) and tracking column lineage
+type sqlGuard struct {
+	tokens []sqlToken
+	parens map[int]int
+	schema *Schema
+	access AccessChecker
+}
+
+// newSQLGuard tokenizes a single statement
+func newSQLGuard(sqlStr string, schema *Schema, access AccessChecker) (*sqlGuard, error) {
+	tokens, err := tokenizeSQL(sqlStr)
+	if err != nil {
+		return nil, err
+	}
+	for len(tokens) > 0 && tokens[len(tokens)-1].Kind == tokSemicolon {
+		tokens = tokens[:len(tokens)-1]
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("empty statement")
+	}
+	for _, t := range tokens {
+		if t.Kind == tokSemicolon {
+			return nil, fmt.Errorf("multiple statements")
+		}
+	}
+	if !tokens[0].is("select") && !tokens[0].is("with") && !tokens[0].is("table") && tokens[0].Kind != tokLParen {
+		return nil, fmt.Errorf("only SELECT statements are permitted")
+	}
+
+	parens, err := matchParens(tokens)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlGuard{tokens: tokens, parens: parens, schema: schema, access: access}, nil
+}
+
+// CheckSQLAccess rejects SQL that references tables or columns the caller may
+// not use. Table aliases, derived tables, CTEs, correlated subqueries, `*`,
+// `alias.*` and whole-row references such as row_to_json(c) are resolved
+// against the schema. Anything the analyzer cannot attribute safely (unknown
+// qualifiers, multiple statements, data-modifying statements) is rejected.
+func CheckSQLAccess(sqlStr string, schema *Schema, access AccessChecker) error {
+	if access == nil {
+		return nil
+	}
+
+	g, err := newSQLGuard(sqlStr, schema, access)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrSQLNotAllowed, err)
+	}
+	for _, t := range g.tokens {
+		if t.Kind == tokIdent && writeKeywords[t.Value] {
+			return fmt.Errorf("%w: %s statements are not permitted", ErrSQLNotAllowed, t.Value)
+		}
+	}
+
+	_, err = g.query(0, len(g.tokens), nil)
+	return err
+}
+
+func (g *sqlGuard) tableAllowed(table string) bool {
+	return g.access == nil || g.access.TableAllowed(table)
+}
+
+func (g *sqlGuard) columnAllowed(table, column string) bool {
+	return g.access == nil || g.access.ColumnAllowed(table, column)
+}
+
+// isSubquery reports whether the parenthesis at i opens a query
+func (g *sqlGuard) isSubquery(i int) bool {
+	if i+1 >= len(g.tokens) {
+		return false
+	}
+	next := g.tokens[i+1]
+	if next.is("select") || next.is("with") || next.is("values") || next.is("table") {
+		return true
+	}
+	if next.Kind == tokLParen {
+		return g.isSubquery(i + 1)
+	}
+	return false
+}
+
+// query checks [lo, hi): an optional WITH list followed by SELECT blocks
+// combined with set operators. It returns the output columns of the query.
+func (g *sqlGuard) query(lo, hi int, parent *sqlScope) ([]ResultColumn, error) {
+	scope := newSQLScope(parent)
+	i := lo
+
+	if i < hi && g.tokens[i].is("with") {
+		i++
+		if i < hi && g.tokens[i].is("recursive") {
+			i++
+		}
+		for i < hi {
+			if !g.tokens[i].isName() {
+				return nil, fmt.Errorf("%w: malformed WITH clause", ErrSQLNotAllowed)
+			}
+			name := g.tokens[i].Value
+			// recursive CTEs may reference themselves; their lineage is unknown until analyzed
+			scope.ctes[name] = newRelation(nil)
+			i++
+			var aliases []string
+			if i < hi && g.tokens[i].Kind == tokLParen {
+				aliases = g.names(i+1, g.parens[i])
+				i = g.parens[i] + 1
+			}
+			if i >= hi || !g.tokens[i].is("as") {
+				return nil, fmt.Errorf("%w: malformed WITH clause", ErrSQLNotAllowed)
+			}
+			i++
+			for i < hi && (g.tokens[i].is("not") || g.tokens[i].is("materialized")) {
+				i++
+			}
+			if i >= hi || g.tokens[i].Kind != tokLParen {
+				return nil, fmt.Errorf("%w: malformed WITH clause", ErrSQLNotAllowed)
+			}
+			end := g.parens[i]
+			columns, err := g.query(i+1, end, scope)
+			if err != nil {
+				return nil, err
+			}
+			scope.ctes[name] = newRelation(renameColumns(columns, aliases))
+			i = end + 1
+			if i < hi && g.tokens[i].Kind == tokComma {
+				i++
+				continue
+			}
+			break
+		}
+	}
+
+	// split the remaining body on top-level set operators; the output names come
+	// from the first block, sources are merged by position
+	var columns []ResultColumn
+	start := i
+	for j := i; j <= hi; j++ {
+		if j < hi && g.tokens[j].Kind == tokLParen {
+			j = g.parens[j]
+			continue
+		}
+		if j == hi || g.tokens[j].is("union") || g.tokens[j].is("intersect") || g.tokens[j].is("except") {
+			block, err := g.selectBlock(start, j, scope)
+			if err != nil {
+				return nil, err
+			}
+			if columns == nil {
+				// ORDER BY after a set operation refers to the names of the first block
+				for _, c := range block {
+					scope.outputs[c.Name] = true
+				}
+			}
+			columns = mergeColumns(columns, block)
+			if j < hi {
+				j++
+				if j < hi && (g.tokens[j].is("all") || g.tokens[j].is("distinct")) {
+					j++
+				}
+				start = j
+				j--
+			}
+		}
+	}
+	return columns, nil
+}
+
+// selectBlock checks one SELECT (or parenthesised query / VALUES list)
+func (g *sqlGuard) selectBlock(lo, hi int, parent *sqlScope) ([]ResultColumn, error) {
+	if lo >= hi {
+		return nil, fmt.Errorf("%w: empty query block", ErrSQLNotAllowed)
+	}
+	if g.tokens[lo].Kind == tokLParen && g.parens[lo] == hi-1 {
+		return g.query(lo+1, hi-1, parent)
+	}
+
+	scope := newSQLScope(parent)
+	skip := make(map[int]bool)
+	if g.tokens[lo].is("table") {
+		return g.tableBlock(lo+1, hi, scope)
+	}
+	if g.tokens[lo].is("values") {
+		sink := make(map[ColumnRef]bool)
+		if err := g.expressions(lo, hi, scope, skip, sink); err != nil {
+			return nil, err
+		}
+		return []ResultColumn{{Name: "column1", Sources: sortedRefs(sink)}}, nil
+	}
+
+	// locate the FROM clause of this block (nested parentheses are not part of it)
+	fromAt := hi
+	for i := lo; i < hi; i++ {
+		if g.tokens[i].Kind == tokLParen {
+			i = g.parens[i]
+			continue
+		}
+		if g.tokens[i].is("group") && i > lo && g.tokens[i-1].is("within") {
+			continue // ordered-set aggregate: WITHIN GROUP (ORDER BY ...)
+		}
+		if g.tokens[i].Kind == tokIdent && (g.tokens[i].Value == "from" || fromClauseEnd[g.tokens[i].Value]) {
+			fromAt = i
+			break
+		}
+	}
+	if fromAt < hi && g.tokens[fromAt].is("from") {
+		end := fromAt + 1
+		for end < hi {
+			if g.tokens[end].Kind == tokLParen {
+				end = g.parens[end] + 1
+				continue
+			}
+			if g.tokens[end].Kind == tokIdent && fromClauseEnd[g.tokens[end].Value] {
+				break
+			}
+			end++
+		}
+		if err := g.fromItems(fromAt+1, end, scope, skip); err != nil {
+			return nil, err
+		}
+	}
+
+	columns, err := g.selectList(lo, fromAt, scope, skip)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range columns {
+		scope.outputs[c.Name] = true
+	}
+	return columns, g.expressions(lo, hi, scope, skip, nil)
+}
+
+// tableBlock checks TABLE [ONLY] name, which reads every column of a table or CTE
+func (g *sqlGuard) tableBlock(lo, hi int, scope *sqlScope) ([]ResultColumn, error) {
+	i := lo
+	if i < hi && g.tokens[i].is("only") {
+		i++
+	}
+	if i >= hi || !g.tokens[i].isName() {
+		return nil, fmt.Errorf("%w: malformed TABLE query", ErrSQLNotAllowed)
+	}
+	nameEnd := i
+	for nameEnd+2 < hi && g.tokens[nameEnd+1].Kind == tokDot && g.tokens[nameEnd+2].isName() {
+		nameEnd += 2
+	}
+	if nameEnd+1 < hi && !(nameEnd+2 == hi && g.tokens[nameEnd+1].Kind == tokStar) {
+		return nil, fmt.Errorf("%w: malformed TABLE query", ErrSQLNotAllowed)
+	}
+	name := g.tokens[nameEnd].Value
+
+	if rel, ok := scope.cte(name); ok && nameEnd == i {
+		scope.derived[name] = rel
+		return g.expand(scope, name)
+	}
+	if err := g.baseTable(i, nameEnd); err != nil {
+		return nil, err
+	}
+	scope.tables[name] = name
+	return g.expand(scope, name)
+}
+
+// selectList checks the output expressions between SELECT and FROM, marks them
+// as done in skip and returns their lineage
+func (g *sqlGuard) selectList(lo, hi int, scope *sqlScope, skip map[int]bool) ([]ResultColumn, error) {
+	i := lo
+	if i < hi && g.tokens[i].is("select") {
+		i++
+	}
+	if i < hi && g.tokens[i].is("all") {
+		i++
+	} else if i < hi && g.tokens[i].is("distinct") {
+		i++
+		if i+1 < hi && g.tokens[i].is("on") && g.tokens[i+1].Kind == tokLParen {
+			// DISTINCT ON (...) is checked by the block pass but is not an output column
+			i = g.parens[i+1] + 1
+		}
+	}
+
+	var columns []ResultColumn
+	start := i
+	for j := i; j <= hi; j++ {
+		if j < hi && g.tokens[j].Kind == tokLParen {
+			j = g.parens[j]
+			continue
+		}
+		if j < hi && g.tokens[j].Kind != tokComma {
+			continue
+		}
+		if start < j {
+			item, err := g.selectItem(start, j, scope)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, item...)
+		}
+		for k := start; k <= j && k < hi; k++ {
+			skip[k] = true
+		}
+		start = j + 1
+	}
+	return columns, nil
+}
+
+// selectItem returns the output columns produced by one select list item
+func (g *sqlGuard) selectItem(lo, hi int, scope *sqlScope) ([]ResultColumn, error) {
+	// * and qualifier.* expand to several output columns
+	if hi-lo == 1 && g.tokens[lo].Kind == tokStar {
+		var columns []ResultColumn
+		for _, name := range scope.order {
+			expanded, err := g.expand(scope, name)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, expanded...)
+		}
+		return columns, nil
+	}
+	if hi-lo == 3 && g.tokens[lo].isName() && g.tokens[lo+1].Kind == tokDot && g.tokens[lo+2].Kind == tokStar {
+		return g.expand(scope, g.tokens[lo].Value)
+	}
+
+	sink := make(map[ColumnRef]bool)
+	end := hi
+	if g.implicitAlias(lo, hi) {
+		// an implicit alias is no reference, but a name PostgreSQL might read
+		// as a column after all (x LIKE y) is still checked when it resolves
+		end = hi - 1
+		if _, err := g.resolveBare(scope, g.tokens[end].Value, sink); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.expressions(lo, end, scope, make(map[int]bool), sink); err != nil {
+		return nil, err
+	}
+	return []ResultColumn{{Name: g.outputName(lo, hi), Sources: sortedRefs(sink)}}, nil
+}
+
+// expand returns the columns of one FROM item for * expansion
+func (g *sqlGuard) expand(scope *sqlScope, name string) ([]ResultColumn, error) {
+	table, derived, ok := scope.resolve(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown table reference %s", ErrSQLNotAllowed, name)
+	}
+	if derived != nil && derived.base != "" {
+		if err := g.checkTableStar(derived.base, nil); err != nil {
+			return nil, err
+		}
+		return derived.columns, nil
+	}
+	if derived != nil {
+		if len(derived.columns) == 0 {
+			return []ResultColumn{{Name: name, Sources: sortedRefs(derived.all)}}, nil
+		}
+		return derived.columns, nil
+	}
+
+	if err := g.checkTableStar(table, nil); err != nil {
+		return nil, err
+	}
+	def, _ := g.schema.Table(table)
+	columns := make([]ResultColumn, len(def.Columns))
+	for i, c := range def.Columns {
+		columns[i] = ResultColumn{Name: lowerName(c.Name), Sources: []ColumnRef{newColumnRef(table, c.Name)}}
+	}
+	return columns, nil
+}
+
+// fromItems registers the tables of a FROM clause in scope and marks their
+// tokens in skip; ON/USING conditions stay unmarked and are checked as expressions
+func (g *sqlGuard) fromItems(lo, hi int, scope *sqlScope, skip map[int]bool) error {
+	i := lo
+	for i < hi {
+		t := g.tokens[i]
+
+		switch {
+		case t.Kind == tokComma || (t.Kind == tokIdent && joinKeywords[t.Value]):
+			skip[i] = true
+			i++
+			continue
+
+		case t.is("on"):
+			// join condition: leave for the expression pass, up to the next item
+			skip[i] = true
+			i++
+			for i < hi {
+				if g.tokens[i].Kind == tokLParen {
+					i = g.parens[i] + 1
+					continue
+				}
+				if g.tokens[i].Kind == tokComma || (g.tokens[i].Kind == tokIdent && joinKeywords[g.tokens[i].Value]) {
+					break
+				}
+				i++
+			}
+			continue
+
+		case t.is("using"):
+			// the column list is checked by the expression pass
+			skip[i] = true
+			i++
+			if i < hi && g.tokens[i].Kind == tokLParen {
+				i = g.parens[i] + 1
+			}
+			continue
+
+		case t.Kind == tokLParen:
+			end := g.parens[i]
+			if g.isSubquery(i) {
+				columns, err := g.query(i+1, end, scope.parent)
+				if err != nil {
+					return err
+				}
+				for k := i; k <= end; k++ {
+					skip[k] = true
+				}
+				i = g.alias(end+1, hi, skip, func(alias string, names []string) {
+					scope.derived[alias] = newRelation(renameColumns(columns, names))
+					scope.order = append(scope.order, alias)
+				})
+				continue
+			}
+			// parenthesised join tree
+			if err := g.fromItems(i+1, end, scope, skip); err != nil {
+				return err
+			}
+			skip[i] = true
+			skip[end] = true
+			i = end + 1
+			continue
+
+		case t.is("only"):
+			skip[i] = true
+			i++
+			continue
+
+		case t.is("tablesample") || t.is("repeatable"):
+			// TABLESAMPLE method (arguments) [REPEATABLE (seed)]: the arguments
+			// are left for the expression pass
+			skip[i] = true
+			i++
+			if t.is("tablesample") && i < hi && g.tokens[i].isName() {
+				skip[i] = true
+				i++
+			}
+			if i < hi && g.tokens[i].Kind == tokLParen {
+				i = g.parens[i] + 1
+			}
+			continue
+
+		case t.isName():
+			// [schema.]name, or a table function name(...)
+			nameEnd := i
+			for nameEnd+2 < hi && g.tokens[nameEnd+1].Kind == tokDot && g.tokens[nameEnd+2].isName() {
+				nameEnd += 2
+			}
+			for k := i; k <= nameEnd; k++ {
+				skip[k] = true
+			}
+			name := g.tokens[nameEnd].Value
+
+			if nameEnd+1 < hi && g.tokens[nameEnd+1].Kind == tokLParen {
+				// table function: its arguments are ordinary expressions and the
+				// output is attributed to every column they reference
+				if nameEnd != i || !allowedFunctions[name] {
+					return fmt.Errorf("%w: function %s is not permitted", ErrSQLNotAllowed, name)
+				}
+				end := g.parens[nameEnd+1]
+				sink := make(map[ColumnRef]bool)
+				if err := g.expressions(nameEnd+2, end, scope, make(map[int]bool), sink); err != nil {
+					return err
+				}
+				for k := nameEnd + 1; k <= end; k++ {
+					skip[k] = true
+				}
+				rel := &relation{all: sink}
+				scope.derived[name] = rel
+				scope.order = append(scope.order, name)
+				i = g.alias(end+1, hi, skip, func(alias string, _ []string) {
+					delete(scope.derived, name)
+					scope.derived[alias] = rel
+					scope.order[len(scope.order)-1] = alias
+				})
+				continue
+			}
+
+			// schema-qualified names always refer to tables, never to CTEs
+			if rel, ok := scope.cte(name); ok && nameEnd == i {
+				scope.derived[name] = rel
+				scope.order = append(scope.order, name)
+				i = g.alias(nameEnd+1, hi, skip, func(alias string, names []string) {
+					delete(scope.derived, name)
+					scope.derived[alias] = newRelation(renameColumns(rel.columns, names))
+					scope.order[len(scope.order)-1] = alias
+				})
+				continue
+			}
+
+			if err := g.baseTable(i, nameEnd); err != nil {
+				return err
+			}
+			scope.tables[name] = name
+			scope.order = append(scope.order, name)
+			var renameErr error
+			i = g.alias(nameEnd+1, hi, skip, func(alias string, names []string) {
+				scope.order[len(scope.order)-1] = alias
+				if len(names) == 0 {
+					scope.tables[alias] = name
+					return
+				}
+				// customers AS c(a, b): the columns are only visible under the new names
+				delete(scope.tables, name)
+				def, ok := g.schema.Table(name)
+				if !ok {
+					renameErr = fmt.Errorf("%w: cannot resolve columns of %s", ErrSQLNotAllowed, name)
+					return
+				}
+				columns := make([]ResultColumn, len(def.Columns))
+				for k, c := range def.Columns {
+					columns[k] = ResultColumn{Name: lowerName(c.Name), Sources: []ColumnRef{newColumnRef(name, c.Name)}}
+				}
+				rel := newRelation(renameColumns(columns, names))
+				rel.base = name
+				scope.derived[alias] = rel
+			})
+			if renameErr != nil {
+				return renameErr
+			}
+			continue
+
+		default:
+			i++
+		}
+	}
+	return nil
+}
+
+// baseTable checks the table named by the tokens [lo, nameEnd], which may be
+// qualified by a schema. The DDL of a data source declares no schema, so its
+// tables live in public; any other schema (pg_catalog, another tenant's
+// schema, ...) and database-qualified names are rejected. Tables the schema
+// does not define, such as pg_stat_activity, are rejected for every caller,
+// including those whose AccessChecker allows all tables.
+func (g *sqlGuard) baseTable(lo, nameEnd int) error {
+	var parts []string
+	for k := lo; k <= nameEnd; k += 2 {
+		parts = append(parts, g.tokens[k].Value)
+	}
+	qualified := strings.Join(parts, ".")
+	if len(parts) > 2 || (len(parts) == 2 && parts[0] != publicSchema) {
+		return fmt.Errorf("%w: table %s is outside the data source schema", ErrSQLNotAllowed, qualified)
+	}
+	name := parts[len(parts)-1]
+	if _, ok := g.schema.Table(name); !ok {
+		return fmt.Errorf("%w: table %s is not in the data source schema", ErrSQLNotAllowed, qualified)
+	}
+	if !g.tableAllowed(name) {
+		return fmt.Errorf("%w: table %s is not permitted", ErrSQLNotAllowed, qualified)
+	}
+	return nil
+}
+
+// alias consumes an optional [AS] alias [(column aliases)] starting at i
+func (g *sqlGuard) alias(i, hi int, skip map[int]bool, register func(alias string, columns []string)) int {
+	if i < hi && g.tokens[i].is("as") {
+		skip[i] = true
+		i++
+	}
+	if i < hi && g.tokens[i].isName() && !(g.tokens[i].Kind == tokIdent && notAlias[g.tokens[i].Value]) {
+		skip[i] = true
+		alias := g.tokens[i].Value
+		i++
+		var columns []string
+		if i < hi && g.tokens[i].Kind == tokLParen {
+			end := g.parens[i]
+			columns = g.names(i+1, end)
+			for k := i; k <= end; k++ {
+				skip[k] = true
+			}
+			i = end + 1
+		}
+		register(alias, columns)
+	}
+	return i
+}
+
+// names returns the identifiers of a comma separated list
+func (g *sqlGuard) names(lo, hi int) []string {
+	var names []string
+	for k := lo; k < hi; k++ {
+		if g.tokens[k].isName() {
+			names = append(names, g.tokens[k].Value)
+		}
+	}
+	return names
+}
+
+// expressions checks every column reference in [lo, hi) that is not marked in
+// skip; when sink is not nil the referenced base columns are collected into it
+func (g *sqlGuard) expressions(lo, hi int, scope *sqlScope, skip map[int]bool, sink map[ColumnRef]bool) error {
+	for i := lo; i < hi; i++ {
+		if skip[i] {
+			continue
+		}
+		t := g.tokens[i]
+
+		switch {
+		case t.Kind == tokLParen && g.isSubquery(i):
+			end := g.parens[i]
+			columns, err := g.query(i+1, end, scope)
+			if err != nil {
+				return err
+			}
+			for _, c := range columns {
+				addRefs(sink, c.Sources...)
+			}
+			i = end
+
+		case t.Kind == tokStar:
+			if g.isStarExpansion(i) {
+				for _, table := range scope.tables {
+					if err := g.checkTableStar(table, sink); err != nil {
+						return err
+					}
+				}
+				for _, rel := range scope.derived {
+					if rel.base != "" {
+						if err := g.checkTableStar(rel.base, sink); err != nil {
+							return err
+						}
+					}
+				}
+			}
+
+		case t.isName():
+			prev := g.prevToken(i)
+			if i+1 < hi && g.tokens[i+1].Kind == tokLParen {
+				if err := g.checkCall(i); err != nil {
+					return err
+				}
+				continue // function name
+			}
+			if prev != nil && (prev.is("as") || (prev.Kind == tokOperator && prev.Value == "::")) {
+				continue // alias or type name
+			}
+			if prev != nil && prev.Kind == tokDot {
+				continue // already handled with its qualifier
+			}
+
+			if i+2 < hi && g.tokens[i+1].Kind == tokDot {
+				// qualifier.column or qualifier.*  (schema.table.column is shifted by one)
+				qualifier, target := i, i+2
+				if target+2 < hi && g.tokens[target+1].Kind == tokDot && g.tokens[target].isName() {
+					qualifier, target = target, target+2
+				}
+				if err := g.checkQualified(scope, g.tokens[qualifier].Value, g.tokens[target], sink); err != nil {
+					return err
+				}
+				i = target
+				continue
+			}
+
+			if err := g.checkBare(scope, i, sink); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *sqlGuard) prevToken(i int) *sqlToken {
+	if i == 0 {
+		return nil
+	}
+	return &g.tokens[i-1]
+}
+
+// checkCall checks the name at i, which is followed by a parenthesis. Keywords
+// such as IN ( or OVER ( and type modifiers such as ::numeric(10, 2) are not
+// calls; any other name must be an allowed function. Schema-qualified calls
+// never get here: their schema is rejected as an unknown qualifier.
+func (g *sqlGuard) checkCall(i int) error {
+	t := g.tokens[i]
+	if t.Kind == tokIdent && expressionKeywords[t.Value] {
+		return nil
+	}
+	if prev := g.prevToken(i); prev != nil && (prev.is("as") || (prev.Kind == tokOperator && prev.Value == "::")) {
+		return nil
+	}
+	if !allowedFunctions[t.Value] {
+		return fmt.Errorf("%w: function %s is not permitted", ErrSQLNotAllowed, t.Value)
+	}
+	return nil
+}
+
+// isStarExpansion distinguishes SELECT * / , * from multiplication and count(*)
+func (g *sqlGuard) isStarExpansion(i int) bool {
+	prev := g.prevToken(i)
+	if prev == nil {
+		return false
+	}
+	return prev.is("select") || prev.is("distinct") || prev.is("all") || prev.Kind == tokComma
+}
+
+// checkQualified checks qualifier.column and qualifier.*
+func (g *sqlGuard) checkQualified(scope *sqlScope, qualifier string, target sqlToken, sink map[ColumnRef]bool) error {
+	table, derived, ok := scope.resolve(qualifier)
+	if !ok {
+		return fmt.Errorf("%w: unknown table reference %s", ErrSQLNotAllowed, qualifier)
+	}
+	if derived != nil {
+		// the derived query itself has been checked; only lineage is needed
+		refs := derived.all
+		if target.Kind != tokStar {
+			refs = derived.sources(target.Value)
+		}
+		if err := g.checkRenamed(derived, refs); err != nil {
+			return err
+		}
+		addRefSet(sink, refs)
+		return nil
+	}
+	if target.Kind == tokStar {
+		return g.checkTableStar(table, sink)
+	}
+	if !g.columnAllowed(table, target.Value) {
+		return fmt.Errorf("%w: column %s.%s is not permitted", ErrSQLNotAllowed, table, target.Value)
+	}
+	addRefs(sink, newColumnRef(table, target.Value))
+	return nil
+}
+
+// checkBare checks the unqualified name at i: a whole-row reference to a table
+// alias, or a column of any table visible in scope. Names that resolve to
+// nothing are rejected unless they are keywords, output names, window names or
+// named function arguments.
+func (g *sqlGuard) checkBare(scope *sqlScope, i int, sink map[ColumnRef]bool) error {
+	t := g.tokens[i]
+	resolved, err := g.resolveBare(scope, t.Value, sink)
+	if err != nil || resolved {
+		return err
+	}
+
+	if t.Kind == tokIdent && expressionKeywords[t.Value] {
+		return nil
+	}
+	for sc := scope; sc != nil; sc = sc.parent {
+		if sc.outputs[t.Value] {
+			return nil
+		}
+	}
+	prev := g.prevToken(i)
+	if prev != nil && (prev.is("over") || prev.is("window") || prev.is("collate")) {
+		return nil
+	}
+	if i+1 < len(g.tokens) {
+		next := g.tokens[i+1]
+		if next.Kind == tokOperator && next.Value == "=>" {
+			return nil
+		}
+		// further definitions of a WINDOW clause: name AS (...)
+		if next.is("as") && i+2 < len(g.tokens) && g.tokens[i+2].Kind == tokLParen {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: cannot resolve %s", ErrSQLNotAllowed, t.Value)
+}
+
+// resolveBare checks an unqualified name against the FROM items in scope and
+// reports whether it referred to any of them
+func (g *sqlGuard) resolveBare(scope *sqlScope, name string, sink map[ColumnRef]bool) (bool, error) {
+	if table, derived, ok := scope.resolve(name); ok {
+		if derived != nil && derived.base == "" {
+			addRefSet(sink, derived.all)
+			return true, nil
+		}
+		if derived != nil {
+			table = derived.base
+		}
+		return true, g.checkTableStar(table, sink)
+	}
+
+	resolved := false
+	for sc := scope; sc != nil; sc = sc.parent {
+		for _, table := range sc.tables {
+			def, ok := g.schema.Table(table)
+			if !ok || !def.HasColumn(name) {
+				continue
+			}
+			if !g.columnAllowed(table, name) {
+				return true, fmt.Errorf("%w: column %s.%s is not permitted", ErrSQLNotAllowed, table, name)
+			}
+			addRefs(sink, newColumnRef(table, name))
+			resolved = true
+		}
+		for _, rel := range sc.derived {
+			if rel.has(name) || len(rel.columns) == 0 {
+				refs := rel.sources(name)
+				if err := g.checkRenamed(rel, refs); err != nil {
+					return true, err
+				}
+				addRefSet(sink, refs)
+				resolved = true
+			}
+		}
+	}
+	return resolved, nil
+}
+
+// checkRenamed checks the columns read through a renamed base table
+func (g *sqlGuard) checkRenamed(rel *relation, refs map[ColumnRef]bool) error {
+	if rel.base == "" {
+		return nil
+	}
+	for ref := range refs {
+		if !g.columnAllowed(rel.base, ref.Column) {
+			return fmt.Errorf("%w: column %s.%s is not permitted", ErrSQLNotAllowed, rel.base, ref.Column)
+		}
+	}
+	return nil
+}
+
+// checkTableStar fails when any column of the table is hidden
+func (g *sqlGuard) checkTableStar(table string, sink map[ColumnRef]bool) error {
+	def, ok := g.schema.Table(table)
+	if !ok {
+		// unknown tables cannot be expanded safely
+		return fmt.Errorf("%w: cannot expand columns of %s", ErrSQLNotAllowed, table)
+	}
+	for _, c := range def.Columns {
+		if !g.columnAllowed(table, c.Name) {
+			return fmt.Errorf("%w: %s.* includes hidden column %s", ErrSQLNotAllowed, table, c.Name)
+		}
+		addRefs(sink, newColumnRef(table, c.Name))
+	}
+	return nil
+}
@@ -0,0 +1,241 @@
+package core
+
+import (
+	"d2t_server/internal/config"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// stubAccess hides OrderItems and Customers.cust_email
+type stubAccess struct{}
+
+func (stubAccess) TableAllowed(table string) bool {
+	return !strings.EqualFold(table, "orderitems")
+}
+
+func (stubAccess) ColumnAllowed(table, column string) bool {
+	return !(strings.EqualFold(table, "customers") && strings.EqualFold(column, "cust_email"))
+}
+
+func TestCheckSQLAccess(t *testing.T) {
+	tests := []struct {
+		name    string
+		sql     string
+		allowed bool
+	}{
+		{"plain column", "SELECT cust_name FROM Customers", true},
+		{"denied column", "SELECT cust_email FROM Customers", false},
+		{"denied table", "SELECT order_num FROM OrderItems", false},
+		{"star", "SELECT * FROM Customers", false},
+		{"qualified star", "SELECT c.* FROM Customers c", false},
+		{"whole row", "SELECT c FROM Customers c", false},
+		{"where clause", "SELECT cust_id FROM Customers WHERE cust_email LIKE '%@x.com'", false},
+		{"join", "SELECT o.order_num, c.cust_name FROM Orders o JOIN Customers c ON c.cust_id = o.cust_id", true},
+		{"join denied column", "SELECT o.order_num FROM Orders o JOIN Customers c ON c.cust_id = o.cust_id WHERE c.cust_email IS NULL", false},
+		{"join denied table", "SELECT o.order_num FROM Orders o JOIN OrderItems oi USING (order_num)", false},
+		{"schema qualified", "SELECT cust_email FROM public.Customers", false},
+		{"subquery", "SELECT cust_name FROM Customers WHERE cust_id IN (SELECT cust_id FROM Orders)", true},
+		{"subquery denied", "SELECT order_num FROM Orders WHERE cust_id IN (SELECT cust_id FROM Customers WHERE cust_email <> '')", false},
+		{"derived table", "SELECT x.e FROM (SELECT cust_email AS e FROM Customers) x", false},
+		{"exists", "SELECT prod_id FROM Products p WHERE NOT EXISTS (SELECT 1 FROM OrderItems oi WHERE oi.prod_id = p.prod_id)", false},
+		{"cte", "WITH c AS (SELECT cust_id, cust_name FROM Customers) SELECT cust_name FROM c", true},
+		{"cte denied", "WITH c AS (SELECT cust_email FROM Customers) SELECT * FROM c", false},
+		{"cte shadowing a table", "WITH Customers AS (SELECT 1 AS cust_id) SELECT cust_id FROM Customers", true},
+		{"public schema", "SELECT c.cust_name FROM public.Customers c", true},
+		{"other schema", "SELECT c.cust_name FROM tenant_b.Customers c", false},
+		{"catalog schema", "SELECT c.cust_id FROM pg_catalog.customers c", false},
+		{"quoted schema", `SELECT c.cust_name FROM "tenant_b"."Customers" c`, false},
+		{"database qualified", "SELECT cust_name FROM d2t.public.Customers", false},
+		{"table form other schema", "TABLE tenant_b.Orders", false},
+		{"qualified name is not a cte", "WITH Customers AS (SELECT 1 AS cust_id) SELECT cust_email FROM public.Customers", false},
+		{"table alias", "SELECT c.cust_name AS n FROM Customers AS c ORDER BY n", true},
+		{"column alias list", "SELECT e FROM Customers AS c(a,b,c3,d,e1,f,g,h,e)", false},
+		{"column alias list qualified", "SELECT c.e FROM Customers AS c(a,b,c3,d,e1,f,g,h,e)", false},
+		{"column alias list star", "SELECT * FROM Customers AS c(a,b)", false},
+		{"column alias list allowed", "SELECT b FROM Customers AS c(a,b)", true},
+		{"quoted identifier", `SELECT "cust_email" FROM "Customers"`, false},
+		{"quoted mixed case", `SELECT "CUST_EMAIL" FROM Customers`, false},
+		{"unicode identifier", `SELECT U&"\0063ust_email" FROM Customers`, false},
+		{"unicode identifier lower", `SELECT u&"cust_email" FROM Customers`, false},
+		{"unresolved name", "SELECT cust_emial FROM Customers", false},
+		{"table form", "TABLE Customers", false},
+		{"table form allowed", "TABLE Orders", true},
+		{"table subquery", "SELECT cust_id FROM Customers WHERE cust_id IN (TABLE OrderItems)", false},
+		{"table cte", "WITH o AS (SELECT order_num FROM Orders) SELECT 1 FROM Orders WHERE order_num IN (TABLE o)", true},
+		{"order by output name", "SELECT count(*) AS n, cust_state FROM Customers GROUP BY cust_state ORDER BY n DESC", true},
+		{"window", "SELECT cust_id, rank() OVER w FROM Customers WINDOW w AS (ORDER BY cust_name)", true},
+		{"keywords", "SELECT cust_id FROM Customers WHERE cust_state IS NOT NULL ORDER BY cust_id NULLS LAST LIMIT 5", true},
+		{"extract", "SELECT EXTRACT(year FROM order_date) AS y FROM Orders", true},
+		{"cast", "SELECT CAST(order_num AS varchar) FROM Orders", true},
+		{"union", "SELECT cust_name FROM Customers UNION SELECT vend_name FROM Vendors", true},
+		{"union denied", "SELECT cust_name FROM Customers UNION SELECT cust_email FROM Customers", false},
+		{"write", "DELETE FROM Customers", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckSQLAccess(tt.sql, DefaultSchema(), stubAccess{})
+			if tt.allowed && err != nil {
+				t.Fatalf("CheckSQLAccess(%q) = %v, want nil", tt.sql, err)
+			}
+			if !tt.allowed && err == nil {
+				t.Fatalf("CheckSQLAccess(%q) = nil, want an error", tt.sql)
+			}
+		})
+	}
+}
+
+// allowAll restricts nothing but still runs every check
+type allowAll struct{}
+
+func (allowAll) TableAllowed(string) bool          { return true }
+func (allowAll) ColumnAllowed(string, string) bool { return true }
+
+func TestCheckSQLAccessExamples(t *testing.T) {
+	// names that resolve to nothing are rejected, so the shipped examples
+	// must all resolve
+	for _, seed := range config.DefaultExampleSeeds {
+		if err := CheckSQLAccess(seed.SQL, DefaultSchema(), allowAll{}); err != nil {
+			t.Errorf("example %q: %v", seed.Question, err)
+		}
+	}
+}
+
+// TestCheckSQLAccessUnknownTables checks that catalog tables and views, which
+// a caller without role limits would otherwise read, are rejected
+func TestCheckSQLAccessUnknownTables(t *testing.T) {
+	for _, sqlStr := range []string{
+		"SELECT a.rolpassword FROM pg_catalog.pg_authid a",
+		"SELECT a.query FROM pg_stat_activity a",
+		"SELECT usename FROM pg_user",
+		"SELECT * FROM pg_settings",
+		"SELECT c.cust_id FROM Customers c JOIN pg_roles r ON true",
+		"SELECT cust_id FROM Customers WHERE cust_id IN (SELECT a.usename FROM pg_stat_activity a)",
+		"TABLE pg_shadow",
+	} {
+		if err := CheckSQLAccess(sqlStr, DefaultSchema(), allowAll{}); !errors.Is(err, ErrSQLNotAllowed) {
+			t.Errorf("CheckSQLAccess(%q) = %v, want ErrSQLNotAllowed", sqlStr, err)
+		}
+	}
+}
+
+func TestCheckSQLAccessFunctions(t *testing.T) {
+	denied := []string{
+		"SELECT setval('orders_order_num_seq', 1)",
+		"SELECT lo_from_bytea(0, 'x')",
+		"SELECT lo_unlink(16400)",
+		"SELECT lo_get(16400)",
+		"SELECT pg_notify('c', 'x')",
+		"SELECT pg_advisory_lock(1)",
+		"SELECT set_config('d2t.roles', ',admin,', false)",
+		"SELECT current_setting('d2t.roles')",
+		"SELECT pg_read_file('/etc/passwd')",
+		`SELECT "setval"('orders_order_num_seq', 1)`,
+		"SELECT pg_catalog.setval('orders_order_num_seq', 1)",
+		"SELECT cust_id FROM Customers WHERE pg_advisory_lock(1) IS NOT NULL",
+		"SELECT cust_id FROM Customers ORDER BY pg_notify('c', cust_id)",
+		"SELECT cust_state FROM Customers GROUP BY cust_state HAVING count(*) > lo_unlink(1)",
+		"SELECT cust_id FROM Customers LIMIT setval('s', 1)",
+		"SELECT o.order_num FROM Orders o JOIN Customers c ON pg_advisory_lock(2) IS NULL",
+		"WITH x AS (SELECT setval('s', 1)) SELECT * FROM x",
+		"SELECT cust_id FROM Customers WHERE cust_id IN (SELECT lo_get(1)::text)",
+		"SELECT a.query FROM pg_stat_get_activity(NULL) a",
+		"SELECT * FROM pg_catalog.generate_series(1, 3)",
+		"SELECT * FROM dblink('dbname=d2t', 'SELECT 1') AS t(x int)",
+	}
+	for _, sqlStr := range denied {
+		if err := CheckSQLAccess(sqlStr, DefaultSchema(), allowAll{}); !errors.Is(err, ErrSQLNotAllowed) {
+			t.Errorf("CheckSQLAccess(%q) = %v, want ErrSQLNotAllowed", sqlStr, err)
+		}
+	}
+
+	allowed := []string{
+		"SELECT CAST(item_price AS numeric(10, 2)) FROM OrderItems",
+		"SELECT item_price::numeric(10, 2), prod_id::character varying(10) FROM OrderItems",
+		"SELECT count(*) FILTER (WHERE cust_state = 'CA') FROM Customers",
+		"SELECT percentile_cont(0.5) WITHIN GROUP (ORDER BY item_price) FROM OrderItems",
+		"SELECT cust_state, cust_city, count(*) FROM Customers GROUP BY ROLLUP (cust_state, cust_city)",
+		"SELECT coalesce(sum(quantity), 0) FROM OrderItems WHERE EXISTS (SELECT 1 FROM Orders)",
+		"SELECT g FROM generate_series(1, 3) AS g",
+		"SELECT cust_id FROM ONLY Customers TABLESAMPLE bernoulli (10) REPEATABLE (1)",
+	}
+	for _, sqlStr := range allowed {
+		if err := CheckSQLAccess(sqlStr, DefaultSchema(), allowAll{}); err != nil {
+			t.Errorf("CheckSQLAccess(%q) = %v, want nil", sqlStr, err)
+		}
+	}
+}
+
+func TestCheckSQLAccessUnrestricted(t *testing.T) {
+	if err := CheckSQLAccess("SELECT cust_email FROM Customers", DefaultSchema(), nil); err != nil {
+		t.Fatalf("nil access checker should allow everything, got %v", err)
+	}
+}
+
+func TestCheckSQLAccessErrorType(t *testing.T) {
+	err := CheckSQLAccess("SELECT e FROM Customers AS c(a,b,c3,d,e1,f,g,h,e)", DefaultSchema(), stubAccess{})
+	if !errors.Is(err, ErrSQLNotAllowed) {
+		t.Fatalf("want ErrSQLNotAllowed, got %v", err)
+	}
+}
+
+func TestResultLineage(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want map[string][]ColumnRef
+	}{
+		{
+			name: "alias",
+			sql:  "SELECT c.cust_email AS contact FROM Customers c",
+			want: map[string][]ColumnRef{"contact": {{"customers", "cust_email"}}},
+		},
+		{
+			name: "expression",
+			sql:  "SELECT upper(cust_email) || cust_name AS x FROM Customers",
+			want: map[string][]ColumnRef{"x": {{"customers", "cust_email"}, {"customers", "cust_name"}}},
+		},
+		{
+			name: "cte",
+			sql:  "WITH c AS (SELECT cust_email AS m FROM Customers) SELECT m AS out FROM c",
+			want: map[string][]ColumnRef{"out": {{"customers", "cust_email"}}},
+		},
+		{
+			name: "column alias list",
+			sql:  "SELECT e FROM Customers AS c(a,b,c3,d,e1,f,g,h,e)",
+			want: map[string][]ColumnRef{"e": {{"customers", "cust_email"}}},
+		},
+		{
+			name: "constant",
+			sql:  "SELECT 1 AS one",
+			want: map[string][]ColumnRef{"one": nil},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			columns, err := ResultLineage(tt.sql, DefaultSchema())
+			if err != nil {
+				t.Fatalf("ResultLineage(%q): %v", tt.sql, err)
+			}
+			if len(columns) != len(tt.want) {
+				t.Fatalf("got %d columns, want %d: %+v", len(columns), len(tt.want), columns)
+			}
+			for _, c := range columns {
+				want, ok := tt.want[c.Name]
+				if !ok {
+					t.Fatalf("unexpected column %q", c.Name)
+				}
+				if len(c.Sources) != len(want) {
+					t.Fatalf("column %q sources = %v, want %v", c.Name, c.Sources, want)
+				}
+				for i := range want {
+					if c.Sources[i] != want[i] {
+						t.Fatalf("column %q sources = %v, want %v", c.Name, c.Sources, want)
+					}
+				}
+			}
+		})
+	}
+}
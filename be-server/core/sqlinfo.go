@@ -0,0 +1,29 @@
+package core
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var tableRefPattern = regexp.MustCompile(`(?i)\b(?:from|join)\s+("?[a-zA-Z_][\w]*"?(?:\."?[a-zA-Z_][\w]*"?)?)`)
+
+// ExtractTables returns the distinct, lower-cased table names referenced after
+// FROM or JOIN in a SQL statement. Subqueries in FROM are skipped.
+func ExtractTables(sqlStr string) []string {
+	seen := make(map[string]bool)
+	for _, m := range tableRefPattern.FindAllStringSubmatch(sqlStr, -1) {
+		name := strings.ToLower(strings.ReplaceAll(m[1], `"`, ""))
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		seen[name] = true
+	}
+
+	tables := make([]string, 0, len(seen))
+	for t := range seen {
+		tables = append(tables, t)
+	}
+	sort.Strings(tables)
+	return tables
+}
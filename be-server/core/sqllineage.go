@@ -0,0 +1,192 @@
+package core
+
+import (
+	"sort"
+	"strings"
+)
+
+// ColumnRef identifies a base table column; both parts are lower-cased
+type ColumnRef struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+}
+
+func newColumnRef(table, column string) ColumnRef {
+	return ColumnRef{Table: lowerName(table), Column: lowerName(column)}
+}
+
+// ResultColumn is one output column of a query together with the base table
+// columns its value is derived from
+type ResultColumn struct {
+	Name    string      `json:"name"`
+	Sources []ColumnRef `json:"sources"`
+}
+
+// ResultLineage returns the output columns of a SELECT statement in order and,
+// for each, the base columns that flow into it through aliases, expressions,
+// derived tables, CTEs and set operations. Output names follow PostgreSQL's
+// naming rules for the common cases and are lower-cased unless an explicit
+// alias was given; callers should treat unmatched result columns conservatively.
+func ResultLineage(sqlStr string, schema *Schema) ([]ResultColumn, error) {
+	g, err := newSQLGuard(sqlStr, schema, nil)
+	if err != nil {
+		return nil, err
+	}
+	return g.query(0, len(g.tokens), nil)
+}
+
+// syntaxFunctionNames maps SQL-standard syntax to the column name PostgreSQL gives it
+var syntaxFunctionNames = map[string]string{
+	"trim": "btrim",
+}
+
+// reservedTrailing cannot be an implicit column alias at the end of an item
+var reservedTrailing = map[string]bool{
+	"null": true, "true": true, "false": true, "end": true, "unknown": true,
+	"and": true, "or": true, "not": true, "is": true, "then": true, "else": true,
+	"current_date": true, "current_time": true, "current_timestamp": true,
+	"localtime": true, "localtimestamp": true, "current_user": true,
+}
+
+// outputName derives the PostgreSQL output name of a select list item
+func (g *sqlGuard) outputName(lo, hi int) string {
+	last := g.tokens[hi-1]
+
+	// expr AS alias / expr alias
+	if hi-lo >= 2 && last.isName() && (g.tokens[hi-2].is("as") || g.implicitAlias(lo, hi)) {
+		return last.Value
+	}
+
+	// expr::type keeps the name of expr
+	for k := hi - 1; k > lo; k-- {
+		if g.tokens[k].Kind == tokRParen {
+			k = g.openParen(k)
+			continue
+		}
+		if g.tokens[k].Kind == tokOperator && g.tokens[k].Value == "::" {
+			return g.outputName(lo, k)
+		}
+	}
+
+	first := g.tokens[lo]
+	switch {
+	case hi-lo == 1 && first.isName():
+		return first.Value
+	case hi-lo >= 3 && last.isName() && g.tokens[hi-2].Kind == tokDot && g.isQualifiedName(lo, hi):
+		return last.Value
+	case first.is("case"):
+		return "case"
+	case first.isName() && lo+1 < hi && g.tokens[lo+1].Kind == tokLParen && g.parens[lo+1] == hi-1:
+		if name, ok := syntaxFunctionNames[first.Value]; ok {
+			return name
+		}
+		return first.Value
+	}
+	return "?column?"
+}
+
+// implicitAlias reports whether a select list item ends in an alias written
+// without AS, as in count(*) n
+func (g *sqlGuard) implicitAlias(lo, hi int) bool {
+	if hi-lo < 2 {
+		return false
+	}
+	last, prev := g.tokens[hi-1], g.tokens[hi-2]
+	if !last.isName() || prev.is("as") {
+		return false
+	}
+	implicit := prev.Kind == tokRParen || prev.Kind == tokString || prev.Kind == tokNumber || prev.isName()
+	return implicit && !(last.Kind == tokIdent && reservedTrailing[last.Value]) &&
+		!(prev.Kind == tokIdent && reservedTrailing[prev.Value])
+}
+
+// isQualifiedName reports whether [lo, hi) is a.b or a.b.c
+func (g *sqlGuard) isQualifiedName(lo, hi int) bool {
+	for k := lo; k < hi; k++ {
+		if (k-lo)%2 == 0 && !g.tokens[k].isName() {
+			return false
+		}
+		if (k-lo)%2 == 1 && g.tokens[k].Kind != tokDot {
+			return false
+		}
+	}
+	return true
+}
+
+// openParen finds the opening parenthesis matching the one at close
+func (g *sqlGuard) openParen(close int) int {
+	for open, c := range g.parens {
+		if c == close {
+			return open
+		}
+	}
+	return close
+}
+
+// renameColumns applies a column alias list such as t(a, b) by position
+func renameColumns(columns []ResultColumn, names []string) []ResultColumn {
+	if len(names) == 0 {
+		return columns
+	}
+	renamed := make([]ResultColumn, len(columns))
+	copy(renamed, columns)
+	for i := range renamed {
+		if i < len(names) {
+			renamed[i].Name = names[i]
+		}
+	}
+	return renamed
+}
+
+// mergeColumns combines the columns of set operation branches by position
+func mergeColumns(first, next []ResultColumn) []ResultColumn {
+	if first == nil {
+		return next
+	}
+	for i := range first {
+		if i >= len(next) {
+			break
+		}
+		set := make(map[ColumnRef]bool)
+		addRefs(set, first[i].Sources...)
+		addRefs(set, next[i].Sources...)
+		first[i].Sources = sortedRefs(set)
+	}
+	return first
+}
+
+func addRefs(sink map[ColumnRef]bool, refs ...ColumnRef) {
+	if sink == nil {
+		return
+	}
+	for _, r := range refs {
+		sink[r] = true
+	}
+}
+
+func addRefSet(sink map[ColumnRef]bool, refs map[ColumnRef]bool) {
+	if sink == nil {
+		return
+	}
+	for r := range refs {
+		sink[r] = true
+	}
+}
+
+func sortedRefs(set map[ColumnRef]bool) []ColumnRef {
+	refs := make([]ColumnRef, 0, len(set))
+	for r := range set {
+		refs = append(refs, r)
+	}
+	sort.Slice(refs, func(i, j int) bool {
+		if refs[i].Table != refs[j].Table {
+			return refs[i].Table < refs[j].Table
+		}
+		return refs[i].Column < refs[j].Column
+	})
+	return refs
+}
+
+func lowerName(name string) string {
+	return strings.ToLower(name)
+}
@@ -0,0 +1,244 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// sqlTokenKind classifies a lexical SQL token
+type sqlTokenKind int
+
+const (
+	tokIdent sqlTokenKind = iota
+	tokQuotedIdent
+	tokString
+	tokNumber
+	tokParam
+	tokOperator
+	tokLParen
+	tokRParen
+	tokComma
+	tokDot
+	tokStar
+	tokSemicolon
+)
+
+// sqlToken is one lexical token; Value is lower-cased for identifiers
+type sqlToken struct {
+	Kind  sqlTokenKind
+	Value string
+	Pos   int
+}
+
+// is reports whether the token is the given (unquoted) keyword
+func (t sqlToken) is(keyword string) bool {
+	return t.Kind == tokIdent && t.Value == keyword
+}
+
+// isName reports whether the token can name a table, column or alias
+func (t sqlToken) isName() bool {
+	return t.Kind == tokIdent || t.Kind == tokQuotedIdent
+}
+
+// tokenizeSQL splits a PostgreSQL statement into tokens, dropping comments and
+// whitespace. String literals (including escape strings and dollar-quoted strings) are
+// kept as single tokens so that their content is never mistaken for names.
+func tokenizeSQL(sqlStr string) ([]sqlToken, error) {
+	var tokens []sqlToken
+	runes := []rune(sqlStr)
+	n := len(runes)
+
+	for i := 0; i < n; {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '-' && i+1 < n && runes[i+1] == '-':
+			for i < n && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && i+1 < n && runes[i+1] == '*':
+			depth := 0
+			for i < n {
+				if runes[i] == '/' && i+1 < n && runes[i+1] == '*' {
+					depth++
+					i += 2
+				} else if runes[i] == '*' && i+1 < n && runes[i+1] == '/' {
+					depth--
+					i += 2
+					if depth == 0 {
+						break
+					}
+				} else {
+					i++
+				}
+			}
+			if depth != 0 {
+				return nil, fmt.Errorf("unterminated comment")
+			}
+
+		case r == '\'' || ((r == 'e' || r == 'E') && i+1 < n && runes[i+1] == '\''):
+			start := i
+			if r != '\'' {
+				i++
+			}
+			i++
+			closed := false
+			for i < n {
+				if runes[i] == '\\' && r != '\'' {
+					i += 2
+					continue
+				}
+				if runes[i] == '\'' {
+					if i+1 < n && runes[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated string literal")
+			}
+			tokens = append(tokens, sqlToken{Kind: tokString, Value: string(runes[start:i]), Pos: start})
+
+		case r == '$' && i+1 < n && unicode.IsDigit(runes[i+1]):
+			start := i
+			i++
+			for i < n && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{Kind: tokParam, Value: string(runes[start:i]), Pos: start})
+
+		case r == '$':
+			// dollar-quoted string: $tag$ ... $tag$
+			end := i + 1
+			for end < n && (unicode.IsLetter(runes[end]) || unicode.IsDigit(runes[end]) || runes[end] == '_') {
+				end++
+			}
+			if end >= n || runes[end] != '$' {
+				return nil, fmt.Errorf("unexpected character %q at %d", r, i)
+			}
+			tag := runes[i : end+1]
+			stop := -1
+			for j := end + 1; j+len(tag) <= n; j++ {
+				if string(runes[j:j+len(tag)]) == string(tag) {
+					stop = j + len(tag)
+					break
+				}
+			}
+			if stop < 0 {
+				return nil, fmt.Errorf("unterminated dollar-quoted string")
+			}
+			tokens = append(tokens, sqlToken{Kind: tokString, Value: string(runes[i:stop]), Pos: i})
+			i = stop
+
+		case r == '"':
+			start := i
+			i++
+			var sb strings.Builder
+			closed := false
+			for i < n {
+				if runes[i] == '"' {
+					if i+1 < n && runes[i+1] == '"' {
+						sb.WriteRune('"')
+						i += 2
+						continue
+					}
+					i++
+					closed = true
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, fmt.Errorf("unterminated quoted identifier")
+			}
+			// Quoted names are folded too: the check becomes stricter, never looser
+			tokens = append(tokens, sqlToken{Kind: tokQuotedIdent, Value: strings.ToLower(sb.String()), Pos: start})
+
+		case (r == 'u' || r == 'U') && i+2 < n && runes[i+1] == '&' && (runes[i+2] == '"' || runes[i+2] == '\''):
+			// U&"..." spells names with escapes the checks would not see through
+			return nil, fmt.Errorf("unicode escape identifiers and strings are not supported")
+
+		case unicode.IsLetter(r) || r == '_':
+			start := i
+			for i < n && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '$') {
+				i++
+			}
+			tokens = append(tokens, sqlToken{Kind: tokIdent, Value: strings.ToLower(string(runes[start:i])), Pos: start})
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < n && unicode.IsDigit(runes[i+1])):
+			start := i
+			for i < n && (unicode.IsDigit(runes[i]) || runes[i] == '.' || runes[i] == 'e' || runes[i] == 'E' ||
+				((runes[i] == '+' || runes[i] == '-') && (runes[i-1] == 'e' || runes[i-1] == 'E'))) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{Kind: tokNumber, Value: string(runes[start:i]), Pos: start})
+
+		case r == '(':
+			tokens = append(tokens, sqlToken{Kind: tokLParen, Value: "(", Pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, sqlToken{Kind: tokRParen, Value: ")", Pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, sqlToken{Kind: tokComma, Value: ",", Pos: i})
+			i++
+		case r == '.':
+			tokens = append(tokens, sqlToken{Kind: tokDot, Value: ".", Pos: i})
+			i++
+		case r == '*':
+			tokens = append(tokens, sqlToken{Kind: tokStar, Value: "*", Pos: i})
+			i++
+		case r == ';':
+			tokens = append(tokens, sqlToken{Kind: tokSemicolon, Value: ";", Pos: i})
+			i++
+
+		default:
+			start := i
+			for i < n && strings.ContainsRune("+-/<>=~!@#%^&|`?:[]", runes[i]) {
+				// stop before a comment start
+				if runes[i] == '-' && i+1 < n && runes[i+1] == '-' && i > start {
+					break
+				}
+				i++
+			}
+			if i == start {
+				return nil, fmt.Errorf("unexpected character %q at %d", r, i)
+			}
+			tokens = append(tokens, sqlToken{Kind: tokOperator, Value: string(runes[start:i]), Pos: start})
+		}
+	}
+
+	return tokens, nil
+}
+
+// matchParens maps the index of every opening parenthesis to its closing one
+func matchParens(tokens []sqlToken) (map[int]int, error) {
+	pairs := make(map[int]int)
+	var stack []int
+	for i, t := range tokens {
+		switch t.Kind {
+		case tokLParen:
+			stack = append(stack, i)
+		case tokRParen:
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced parenthesis at %d", t.Pos)
+			}
+			pairs[stack[len(stack)-1]] = i
+			stack = stack[:len(stack)-1]
+		}
+	}
+	if len(stack) > 0 {
+		return nil, fmt.Errorf("unbalanced parenthesis")
+	}
+	return pairs, nil
+}
@@ -0,0 +1,112 @@
+package core
+
+import (
+	"d2t_server/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// GenerationDetails is what a structured generation reports besides the SQL
+type GenerationDetails struct {
+	TablesUsed  []string `json:"tables_used"`
+	Assumptions []string `json:"assumptions"`
+	// Confidence is the model's own estimate between 0 and 1
+	Confidence float64 `json:"confidence"`
+	// Clarification is the question the model wants to ask the user when
+	// the request is too ambiguous to answer; the SQL is then empty
+	Clarification string `json:"clarification,omitempty"`
+	// Options are the interpretations suggested for the user to pick from
+	Options []string `json:"options,omitempty"`
+}
+
+// structuredOutput is the JSON object the structured generation templates
+// ask for. Pointers tell missing fields from zero values.
+type structuredOutput struct {
+	SQL                 *string   `json:"sql"`
+	TablesUsed          *[]string `json:"tables_used"`
+	Assumptions         []string  `json:"assumptions"`
+	Confidence          *float64  `json:"confidence"`
+	ClarificationNeeded *string   `json:"clarification_needed"`
+	Options             []string  `json:"clarification_options"`
+}
+
+// ParseStructuredGeneration decodes and validates a structured generation:
+// sql is a string, tables_used a list of strings, assumptions an optional
+// list of strings, confidence a number in [0, 1], clarification_needed a
+// string or null and clarification_options an optional list of strings.
+// Either sql or clarification_needed must be non-empty.
+// Markdown code fences and text around the object are tolerated, since
+// providers without a JSON mode sometimes add them.
+func ParseStructuredGeneration(content string) (string, *GenerationDetails, error) {
+	var out structuredOutput
+	if err := decodeObject(content, &out); err != nil {
+		return "", nil, err
+	}
+
+	switch {
+	case out.SQL == nil:
+		return "", nil, errors.New(`missing field "sql"`)
+	case out.TablesUsed == nil:
+		return "", nil, errors.New(`missing field "tables_used"`)
+	case out.Confidence == nil:
+		return "", nil, errors.New(`missing field "confidence"`)
+	case *out.Confidence < 0 || *out.Confidence > 1:
+		return "", nil, fmt.Errorf(`"confidence" %v is outside [0, 1]`, *out.Confidence)
+	}
+
+	details := &GenerationDetails{
+		TablesUsed:  *out.TablesUsed,
+		Assumptions: out.Assumptions,
+		Confidence:  *out.Confidence,
+	}
+	if out.ClarificationNeeded != nil {
+		details.Clarification = strings.TrimSpace(*out.ClarificationNeeded)
+	}
+	if details.Clarification != "" {
+		for _, option := range out.Options {
+			if option = strings.TrimSpace(option); option != "" {
+				details.Options = append(details.Options, option)
+			}
+		}
+	}
+	if details.Assumptions == nil {
+		details.Assumptions = []string{}
+	}
+
+	sqlQuery := strings.TrimSpace(*out.SQL)
+	if sqlQuery == "" && details.Clarification == "" {
+		return "", nil, errors.New(`both "sql" and "clarification_needed" are empty`)
+	}
+	// some models still wrap the statement in a code fence inside the JSON
+	if strings.Contains(sqlQuery, "```") {
+		sqlQuery = utils.CleanSQLFromMarkdown(sqlQuery)
+	}
+	return sqlQuery, details, nil
+}
+
+// ExtractGeneratedSQL is the fallback for answers that failed validation: the
+// "sql" field when the answer is still a JSON object holding one, otherwise
+// the SQL scraped from free text
+func ExtractGeneratedSQL(content string) string {
+	var out struct {
+		SQL string `json:"sql"`
+	}
+	if decodeObject(content, &out) == nil && strings.TrimSpace(out.SQL) != "" {
+		return utils.CleanSQLFromMarkdown(out.SQL)
+	}
+	return utils.CleanSQLFromMarkdown(content)
+}
+
+// decodeObject decodes the outermost JSON object in content
+func decodeObject(content string, v interface{}) error {
+	start, end := strings.Index(content, "{"), strings.LastIndex(content, "}")
+	if start < 0 || end < start {
+		return errors.New("no JSON object in the response")
+	}
+	if err := json.Unmarshal([]byte(content[start:end+1]), v); err != nil {
+		return fmt.Errorf("invalid JSON: %w", err)
+	}
+	return nil
+}
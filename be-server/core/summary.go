@@ -0,0 +1,273 @@
+package core
+
+import (
+	"context"
+	"d2t_server/internal/metrics"
+	"d2t_server/internal/tracing"
+	"d2t_server/utils"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// defaultSummaryInputChars bounds the rendered column statistics and
+	// sample rows sent to the model, keeping the prompt within token limits
+	defaultSummaryInputChars = 6000
+	// maxValueChars truncates long text values in the sample
+	maxValueChars = 200
+	// topValues is the number of most frequent values listed per text column
+	topValues = 3
+	// maxDistinct stops counting distinct values of very varied columns
+	maxDistinct = 1000
+)
+
+// SummarizeRequest is the input of one natural-language answer
+type SummarizeRequest struct {
+	Question       string
+	SQL            string
+	DataSource     string
+	PromptVersions string
+	// Results must already be masked; statistics are computed over all rows,
+	// only a bounded sample is shown to the model
+	Results []map[string]interface{}
+	// SampleRows and MaxInputChars bound the sample and the total size of the
+	// result context; zero selects the defaults
+	SampleRows    int
+	MaxInputChars int
+	Meter         *utils.UsageMeter
+}
+
+// Summarize asks the model to answer the question from the query result,
+// given the SQL, per-column statistics and a sample of the rows. Failures are
+// not fatal and yield NoAnalysis.
+func Summarize(ctx context.Context, req SummarizeRequest) string {
+	if req.SampleRows <= 0 {
+		req.SampleRows = analysisSampleRows
+	}
+	if req.MaxInputChars <= 0 {
+		req.MaxInputChars = defaultSummaryInputChars
+	}
+
+	columns := DescribeColumns(req.Results, req.MaxInputChars)
+	// the statistics take precedence; the sample gets whatever budget is left
+	sample := renderSample(req.Results, req.SampleRows, max(req.MaxInputChars-len(columns), 1))
+
+	ctx, span := tracing.Start(ctx, "nl2sql.summarize",
+		attribute.String("d2t.data_source", req.DataSource),
+		attribute.Int("db.rows", len(req.Results)),
+		attribute.Int("d2t.sample_rows", strings.Count(sample, "\n")))
+	resp, err := utils.DeepseekPrompt(ctx, utils.PromptRequest{
+		Mode:           "summarize",
+		Input:          req.Question,
+		DataSource:     req.DataSource,
+		PromptVersions: req.PromptVersions,
+		SQL:            req.SQL,
+		Columns:        columns,
+		RowCount:       len(req.Results),
+		Results:        sample,
+		Meter:          req.Meter,
+	})
+	tracing.End(span, err)
+	if err != nil {
+		metrics.PipelineError(metrics.StageAnalysis)
+		slog.WarnContext(ctx, "result summary failed", "data_source", req.DataSource, "error", err)
+		return NoAnalysis
+	}
+	return resp.Content
+}
+
+// DescribeColumns renders one line per result column with its inferred type
+// and statistics over all rows: min/max/sum/avg for numbers, the range for
+// timestamps and the distinct count and most frequent values for text. Output
+// beyond maxChars is cut at a line boundary.
+func DescribeColumns(results []map[string]interface{}, maxChars int) string {
+	if len(results) == 0 {
+		return ""
+	}
+
+	names := make(map[string]bool)
+	for _, row := range results {
+		for name := range row {
+			names[name] = true
+		}
+	}
+	columns := make([]string, 0, len(names))
+	for name := range names {
+		columns = append(columns, name)
+	}
+	sort.Strings(columns)
+
+	var sb strings.Builder
+	for i, name := range columns {
+		line := describeColumn(name, results) + "\n"
+		if maxChars > 0 && sb.Len()+len(line) > maxChars {
+			sb.WriteString(fmt.Sprintf("... %d more columns\n", len(columns)-i))
+			break
+		}
+		sb.WriteString(line)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+func describeColumn(name string, results []map[string]interface{}) string {
+	var values []interface{}
+	for _, row := range results {
+		if v := row[name]; v != nil {
+			values = append(values, v)
+		}
+	}
+	if len(values) == 0 {
+		return fmt.Sprintf("- %s: all null", name)
+	}
+	nonNull := fmt.Sprintf("%d non-null", len(values))
+
+	if numbers, ok := numericValues(values); ok {
+		lo, hi, sum := numbers[0], numbers[0], 0.0
+		for _, n := range numbers {
+			lo, hi, sum = math.Min(lo, n), math.Max(hi, n), sum+n
+		}
+		return fmt.Sprintf("- %s (number): %s, min %s, max %s, sum %s, avg %s", name, nonNull,
+			formatNumber(lo), formatNumber(hi), formatNumber(sum), formatNumber(sum/float64(len(numbers))))
+	}
+
+	if times, ok := timeValues(values); ok {
+		first, last := times[0], times[0]
+		for _, t := range times {
+			if t.Before(first) {
+				first = t
+			}
+			if t.After(last) {
+				last = t
+			}
+		}
+		return fmt.Sprintf("- %s (timestamp): %s, from %s to %s", name, nonNull, first.Format(time.RFC3339), last.Format(time.RFC3339))
+	}
+
+	counts := make(map[string]int)
+	for _, v := range values {
+		key := truncateValue(fmt.Sprint(v), 40)
+		if _, seen := counts[key]; seen || len(counts) < maxDistinct {
+			counts[key]++
+		}
+	}
+	distinct := strconv.Itoa(len(counts))
+	if len(counts) == maxDistinct {
+		distinct = "over " + distinct
+	}
+	return fmt.Sprintf("- %s (%s): %s, %s distinct, most frequent: %s", name, valueKind(values[0]), nonNull, distinct, mostFrequent(counts))
+}
+
+// numericValues converts the values to numbers when all of them are numeric;
+// PostgreSQL numeric columns arrive as strings, cached results as json.Number
+func numericValues(values []interface{}) ([]float64, bool) {
+	numbers := make([]float64, 0, len(values))
+	for _, v := range values {
+		var n float64
+		switch x := v.(type) {
+		case int64:
+			n = float64(x)
+		case int:
+			n = float64(x)
+		case float64:
+			n = x
+		case float32:
+			n = float64(x)
+		case json.Number:
+			f, err := x.Float64()
+			if err != nil {
+				return nil, false
+			}
+			n = f
+		case string:
+			f, err := strconv.ParseFloat(strings.TrimSpace(x), 64)
+			if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+				return nil, false
+			}
+			n = f
+		default:
+			return nil, false
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, true
+}
+
+// timeValues returns the values as timestamps when all of them are; cached
+// results hold them as RFC 3339 strings
+func timeValues(values []interface{}) ([]time.Time, bool) {
+	times := make([]time.Time, 0, len(values))
+	for _, v := range values {
+		switch x := v.(type) {
+		case time.Time:
+			times = append(times, x)
+		case string:
+			t, err := time.Parse(time.RFC3339Nano, x)
+			if err != nil {
+				return nil, false
+			}
+			times = append(times, t)
+		default:
+			return nil, false
+		}
+	}
+	return times, true
+}
+
+func valueKind(v interface{}) string {
+	if _, ok := v.(bool); ok {
+		return "boolean"
+	}
+	return "text"
+}
+
+// mostFrequent lists the topValues most frequent values with their counts
+func mostFrequent(counts map[string]int) string {
+	values := make([]string, 0, len(counts))
+	for v := range counts {
+		values = append(values, v)
+	}
+	sort.Slice(values, func(a, b int) bool {
+		if counts[values[a]] != counts[values[b]] {
+			return counts[values[a]] > counts[values[b]]
+		}
+		return values[a] < values[b]
+	})
+	if len(values) > topValues {
+		values = values[:topValues]
+	}
+
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = fmt.Sprintf("%q (%d)", v, counts[v])
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatNumber prints integers exactly, other values with two decimals and
+// fractions below one with three significant digits
+func formatNumber(n float64) string {
+	switch {
+	case n == math.Trunc(n) && math.Abs(n) < 1e15:
+		return strconv.FormatFloat(n, 'f', 0, 64)
+	case math.Abs(n) < 1:
+		return strconv.FormatFloat(n, 'g', 3, 64)
+	}
+	return strconv.FormatFloat(math.Round(n*100)/100, 'f', -1, 64)
+}
+
+// truncateValue shortens s to at most limit runes
+func truncateValue(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return string(runes[:limit]) + "…"
+}
@@ -1,11 +1,13 @@
 package api
 
 import (
+	"d2t_server/internal/cache"
 	"d2t_server/internal/config"
+	"d2t_server/internal/embedding"
 	"d2t_server/internal/middleware"
 	"d2t_server/internal/routes"
 	"fmt"
-	"log"
+	"log/slog"
 
 	"github.com/gin-gonic/gin"
 )
@@ -18,13 +20,23 @@ type Server struct {
 
 // NewServer 创建一个新的服务器实例
 func NewServer(config *config.Config) *Server {
-	router := gin.Default()
+	// 不使用 gin.Default 自带的文本访问日志，由 middleware.AccessLog 输出结构化日志
+	router := gin.New()
 
 	// 添加中间件
-	middleware.RegisterMiddleware(router)
+	middleware.RegisterMiddleware(router, config)
+
+	if !config.Auth.Enabled {
+		slog.Warn("AUTH_ENABLED=false, every request is served with full permissions")
+	}
+
+	// 问答缓存，ANSWER_CACHE_BACKEND=none 时不缓存
+	cache.SetDefault(cache.New(config.Cache))
+	// 语义缓存，SEMANTIC_CACHE_EMBEDDER=none 时不查找
+	embedding.SetDefault(embedding.New(config.Embedding))
 
 	// 注册路由
-	routes.RegisterRoutes(router)
+	routes.RegisterRoutes(router, config)
 
 	return &Server{
 		router: router,
@@ -35,6 +47,6 @@ func NewServer(config *config.Config) *Server {
 // Start 启动服务器
 func (s *Server) Start() error {
 	addr := fmt.Sprintf(":%s", s.config.Server.Port)
-	log.Printf("Starting server on port %s ...", s.config.Server.Port)
+	slog.Info("starting server", "port", s.config.Server.Port)
 	return s.router.Run(addr)
 }
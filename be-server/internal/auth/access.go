@@ -0,0 +1,122 @@
+package auth
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrForbidden 调用方无权访问请求的数据
+var ErrForbidden = errors.New("access denied")
+
+// appTablePrefix 应用自身的表（查询历史、API Key、审计日志等）的名称前缀
+const appTablePrefix = "d2t_"
+
+// Restricted 是否需要按角色策略限制数据访问；只有用户受限。API Key 和匿名调用方没有角色，
+// 不受表、列和行级过滤限制，能读取所属工作区数据源的全部数据
+func (p *Principal) Restricted() bool {
+	return p != nil && p.Type == PrincipalUser
+}
+
+// AuthorizeDataSource 检查调用方的角色是否允许访问数据源
+func AuthorizeDataSource(p *Principal, policy *config.AccessPolicy, dataSource string) error {
+	if !p.Restricted() {
+		return nil
+	}
+	for _, role := range p.Roles {
+		if matchesAny(policy.Roles[role].DataSources, dataSource) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: data source %s is not allowed for roles [%s]", ErrForbidden, dataSource, strings.Join(p.Roles, ", "))
+}
+
+// roleAccess 多个角色权限的并集：任一角色允许即允许
+type roleAccess struct {
+	roles []config.RolePolicy
+}
+
+// ResolveAccess 返回调用方可访问的表和列；不受限的调用方返回 nil
+func ResolveAccess(p *Principal, policy *config.AccessPolicy) core.AccessChecker {
+	if !p.Restricted() {
+		return nil
+	}
+	access := &roleAccess{}
+	for _, role := range p.Roles {
+		if rp, ok := policy.Roles[role]; ok {
+			access.roles = append(access.roles, rp)
+		}
+	}
+	return access
+}
+
+// TableAllowed 表名不区分大小写
+func (a *roleAccess) TableAllowed(table string) bool {
+	for _, rp := range a.roles {
+		if matchesAny(rp.Tables, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// ColumnAllowed 角色未在 columns 中列出该表时允许该表全部列
+func (a *roleAccess) ColumnAllowed(table, column string) bool {
+	for _, rp := range a.roles {
+		if !matchesAny(rp.Tables, table) {
+			continue
+		}
+		columns, listed := lookupTable(rp.Columns, table)
+		if !listed || matchesAny(columns, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// appTableGuard 在角色权限之外拒绝应用自身的表。未配置连接串的数据源与应用表共用数据库，
+// 这些表存放着所有工作区的数据，因此对任何调用方（包括 API Key 和匿名调用方）都不可查询
+type appTableGuard struct {
+	roles core.AccessChecker // nil 表示不受角色限制
+}
+
+func (g appTableGuard) TableAllowed(table string) bool {
+	if strings.HasPrefix(strings.ToLower(table), appTablePrefix) {
+		return false
+	}
+	return g.roles == nil || g.roles.TableAllowed(table)
+}
+
+func (g appTableGuard) ColumnAllowed(table, column string) bool {
+	return g.roles == nil || g.roles.ColumnAllowed(table, column)
+}
+
+// AuthorizeSQL 检查SQL只访问了调用方角色允许的表和列，schema 为数据源的表结构。
+// 所有调用方的SQL都要经过检查：不受限的调用方同样不能访问应用自身的表，也不能写入或调用被禁止的函数
+func AuthorizeSQL(p *Principal, policy *config.AccessPolicy, schema *core.Schema, sqlStr string) error {
+	access := appTableGuard{roles: ResolveAccess(p, policy)}
+	if err := core.CheckSQLAccess(sqlStr, schema, access); err != nil {
+		return fmt.Errorf("%w: %v", ErrForbidden, err)
+	}
+	return nil
+}
+
+func lookupTable(columns map[string][]string, table string) ([]string, bool) {
+	for name, cols := range columns {
+		if strings.EqualFold(name, table) {
+			return cols, true
+		}
+	}
+	return nil, false
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, p := range patterns {
+		if p == "*" || strings.EqualFold(p, value) {
+			return true
+		}
+	}
+	return false
+}
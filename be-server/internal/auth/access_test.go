@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"errors"
+	"testing"
+)
+
+// TestAuthorizeSQLAppTables checks that the application tables, which data
+// sources without a DSN share with every workspace, are denied to every kind
+// of caller
+func TestAuthorizeSQLAppTables(t *testing.T) {
+	policy := &config.AccessPolicy{Roles: map[string]config.RolePolicy{
+		"analyst": {DataSources: []string{"*"}, Tables: []string{"*"}, Scopes: []string{ScopeAsk}},
+	}}
+	callers := map[string]*Principal{
+		"api key":   {Type: PrincipalAPIKey, ID: "key-1", Workspace: "sales"},
+		"anonymous": {Type: PrincipalAnonymous},
+		"nil":       nil,
+		"user":      {Type: PrincipalUser, ID: "user-1", Roles: []string{"analyst"}},
+	}
+	denied := []string{
+		"SELECT * FROM d2t_api_keys",
+		"SELECT key_hash FROM public.d2t_api_keys",
+		`SELECT "SQL" FROM "D2T_QUERY_HISTORY"`,
+		"SELECT cust_id FROM Customers WHERE EXISTS (SELECT 1 FROM d2t_audit_log)",
+		"SELECT c.cust_id FROM Customers c JOIN d2t_feedback f ON true",
+		"WITH h AS (SELECT * FROM d2t_query_history) SELECT * FROM h",
+		"TABLE d2t_token_usage",
+		"SELECT cust_id FROM Customers WHERE cust_id IN (TABLE d2t_examples)",
+		"SELECT query_to_xml('SELECT * FROM d2t_api_keys', true, true, '')",
+		"DELETE FROM d2t_api_keys",
+	}
+
+	schema := core.DefaultSchema()
+	for name, p := range callers {
+		for _, sqlStr := range denied {
+			if err := AuthorizeSQL(p, policy, schema, sqlStr); !errors.Is(err, ErrForbidden) {
+				t.Errorf("%s: %q got %v, want ErrForbidden", name, sqlStr, err)
+			}
+		}
+		if err := AuthorizeSQL(p, policy, schema, "SELECT cust_name FROM Customers"); err != nil {
+			t.Errorf("%s: business table denied: %v", name, err)
+		}
+	}
+}
+
+// TestAuthorizeSQLCatalog checks that callers without role limits cannot read
+// the PostgreSQL catalog, e.g. role password hashes or other sessions' SQL
+func TestAuthorizeSQLCatalog(t *testing.T) {
+	policy := &config.AccessPolicy{}
+	schema := core.DefaultSchema()
+	for name, p := range map[string]*Principal{
+		"api key":   {Type: PrincipalAPIKey, ID: "key-1", Workspace: "sales"},
+		"anonymous": {Type: PrincipalAnonymous},
+	} {
+		for _, sqlStr := range []string{
+			"SELECT a.rolpassword FROM pg_catalog.pg_authid a",
+			"SELECT a.query FROM pg_stat_activity a",
+			"SELECT * FROM pg_stat_activity",
+			"SELECT c.cust_name FROM tenant_b.Customers c",
+		} {
+			if err := AuthorizeSQL(p, policy, schema, sqlStr); !errors.Is(err, ErrForbidden) {
+				t.Errorf("%s: %q got %v, want ErrForbidden", name, sqlStr, err)
+			}
+		}
+	}
+}
+
+func TestAuthorizeSQLRoles(t *testing.T) {
+	policy := &config.AccessPolicy{Roles: map[string]config.RolePolicy{
+		"support": {
+			Tables:  []string{"Customers", "Orders"},
+			Columns: map[string][]string{"Customers": {"cust_id", "cust_name"}},
+		},
+		"catalog": {Tables: []string{"Products"}},
+	}}
+	schema := core.DefaultSchema()
+
+	tests := []struct {
+		name    string
+		roles   []string
+		sql     string
+		allowed bool
+	}{
+		{"listed column", []string{"support"}, "SELECT cust_name FROM Customers", true},
+		{"unlisted column", []string{"support"}, "SELECT cust_email FROM Customers", false},
+		{"table without column list", []string{"support"}, "SELECT * FROM Orders", true},
+		{"table of no role", []string{"support"}, "SELECT prod_name FROM Products", false},
+		{"union of roles", []string{"support", "catalog"}, "SELECT prod_name FROM Products", true},
+		{"unknown role", []string{"nobody"}, "SELECT cust_name FROM Customers", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := &Principal{Type: PrincipalUser, ID: "user-1", Roles: tt.roles}
+			err := AuthorizeSQL(p, policy, schema, tt.sql)
+			if tt.allowed && err != nil {
+				t.Fatalf("got %v, want nil", err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrForbidden) {
+				t.Fatalf("got %v, want ErrForbidden", err)
+			}
+		})
+	}
+}
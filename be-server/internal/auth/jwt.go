@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"d2t_server/internal/config"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// PrincipalUser 通过身份提供方登录的用户
+const PrincipalUser = "user"
+
+// ErrInvalidToken JWT校验失败
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// JWTValidator 使用JWKS校验身份提供方签发的JWT
+type JWTValidator struct {
+	cfg    config.JWTConfig
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+// NewJWTValidator 根据配置创建JWT校验器
+func NewJWTValidator(cfg config.JWTConfig) *JWTValidator {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &JWTValidator{
+		cfg:    cfg,
+		keys:   NewKeySet(cfg.JWKSFile, cfg.JWKSURL, cfg.RefreshInterval),
+		parser: jwt.NewParser(opts...),
+	}
+}
+
+// LooksLikeJWT 判断凭证是否为 JWT 格式（三段 base64url）
+func LooksLikeJWT(token string) bool {
+	return strings.Count(token, ".") == 2 && !strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// Validate 校验签名、有效期、issuer 和 audience，并把声明映射为调用方
+func (v *JWTValidator) Validate(token string) (*Principal, error) {
+	claims := jwt.MapClaims{}
+	_, err := v.parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return v.keys.Key(kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, _ := claims.GetSubject()
+	if subject == "" {
+		return nil, fmt.Errorf("%w: missing sub claim", ErrInvalidToken)
+	}
+
+	name := subject
+	for _, c := range []string{"preferred_username", "email", "name"} {
+		if value, ok := claims[c].(string); ok && value != "" {
+			name = value
+			break
+		}
+	}
+
+	var workspace string
+	if v.cfg.WorkspaceClaim != "" {
+		workspaces := stringsClaim(claims, v.cfg.WorkspaceClaim)
+		if len(workspaces) > 1 {
+			return nil, fmt.Errorf("%w: %s claim must name a single workspace", ErrInvalidToken, v.cfg.WorkspaceClaim)
+		}
+		if len(workspaces) == 1 {
+			workspace = workspaces[0]
+		}
+	}
+
+	roles := stringsClaim(claims, v.cfg.RolesClaim)
+	return &Principal{
+		Type:      PrincipalUser,
+		ID:        subject,
+		Name:      name,
+		Roles:     roles,
+		Scopes:    scopesFor(claims, roles),
+		Claims:    claims,
+		Workspace: workspace,
+	}, nil
+}
+
+// scopesFor 返回角色策略授予的访问范围。令牌带 scope 声明时只保留角色同样授予的范围
+// （角色拥有 admin 时视为授予全部范围），声明只能收窄、不能扩大角色的权限
+func scopesFor(claims jwt.MapClaims, roles []string) []string {
+	granted := &Principal{}
+	seen := make(map[string]bool)
+	policy := config.GetAccessPolicy()
+	for _, role := range roles {
+		for _, s := range policy.Roles[role].Scopes {
+			if !seen[s] {
+				seen[s] = true
+				granted.Scopes = append(granted.Scopes, s)
+			}
+		}
+	}
+
+	scope, ok := claims["scope"].(string)
+	if !ok {
+		return granted.Scopes
+	}
+	var scopes []string
+	kept := make(map[string]bool)
+	for _, s := range strings.Fields(scope) {
+		if !kept[s] && ValidateScopes([]string{s}) == nil && granted.HasScope(s) {
+			kept[s] = true
+			scopes = append(scopes, s)
+		}
+	}
+	return scopes
+}
+
+// stringsClaim 读取字符串或字符串数组类型的声明，path 可用点号访问嵌套对象，如 realm_access.roles
+func stringsClaim(claims jwt.MapClaims, path string) []string {
+	var value interface{} = map[string]interface{}(claims)
+	for _, part := range strings.Split(path, ".") {
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = obj[part]
+	}
+
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(strings.ReplaceAll(v, ",", " "))
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
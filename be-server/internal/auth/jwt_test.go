@@ -0,0 +1,175 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"d2t_server/internal/config"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestMain(m *testing.M) {
+	// roles and scopes come from the example policy: analyst (ask, execute-saved),
+	// support (ask), d2t-admin (admin)
+	os.Setenv("ACCESS_POLICY_FILE", filepath.Join("..", "..", "configs", "access_policy.example.json"))
+	// workspaces sales and support each have a default data source and one of their own
+	os.Setenv("WORKSPACES_FILE", filepath.Join("testdata", "workspaces.json"))
+	os.Exit(m.Run())
+}
+
+// testIssuer signs tokens with a locally generated key published as a JWKS file
+type testIssuer struct {
+	key       *rsa.PrivateKey
+	validator *JWTValidator
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test-key",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, jwks, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return &testIssuer{
+		key: key,
+		validator: NewJWTValidator(config.JWTConfig{
+			JWKSFile:        path,
+			Issuer:          "https://idp.example.com",
+			Audience:        "d2t",
+			RolesClaim:      "roles",
+			WorkspaceClaim:  "workspace",
+			RefreshInterval: time.Minute,
+		}),
+	}
+}
+
+// sign issues a token for user-1 with the given claims on top of valid defaults
+func (ti *testIssuer) sign(t *testing.T, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+	all := jwt.MapClaims{
+		"sub": "user-1",
+		"iss": "https://idp.example.com",
+		"aud": "d2t",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		all[k] = v
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, all)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(ti.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func TestJWTValidatorValidate(t *testing.T) {
+	ti := newTestIssuer(t)
+
+	principal, err := ti.validator.Validate(ti.sign(t, "test-key", jwt.MapClaims{
+		"roles":              []string{"analyst"},
+		"preferred_username": "jane",
+		"workspace":          "acme",
+	}))
+	if err != nil {
+		t.Fatalf("valid token rejected: %v", err)
+	}
+	if principal.Type != PrincipalUser || principal.ID != "user-1" || principal.Name != "jane" || principal.Workspace != "acme" {
+		t.Fatalf("unexpected principal %+v", principal)
+	}
+	if want := []string{ScopeAsk, ScopeExecuteSaved}; !reflect.DeepEqual(principal.Scopes, want) {
+		t.Fatalf("scopes = %v, want %v", principal.Scopes, want)
+	}
+}
+
+func TestJWTValidatorRejects(t *testing.T) {
+	ti := newTestIssuer(t)
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	foreign := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"sub": "user-1", "iss": "https://idp.example.com", "aud": "d2t", "exp": time.Now().Add(time.Hour).Unix(),
+	})
+	foreign.Header["kid"] = "test-key"
+	forged, err := foreign.SignedString(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", ti.sign(t, "test-key", jwt.MapClaims{"exp": time.Now().Add(-time.Hour).Unix()})},
+		{"no expiry", ti.sign(t, "test-key", jwt.MapClaims{"exp": nil})},
+		{"wrong audience", ti.sign(t, "test-key", jwt.MapClaims{"aud": "someone-else"})},
+		{"wrong issuer", ti.sign(t, "test-key", jwt.MapClaims{"iss": "https://evil.example.com"})},
+		{"unknown kid", ti.sign(t, "rotated-away", nil)},
+		{"wrong key", forged},
+		{"missing subject", ti.sign(t, "test-key", jwt.MapClaims{"sub": ""})},
+		{"several workspaces", ti.sign(t, "test-key", jwt.MapClaims{"workspace": []string{"a", "b"}})},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ti.validator.Validate(tt.token); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("got %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestJWTValidatorScopes(t *testing.T) {
+	ti := newTestIssuer(t)
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		want   []string
+	}{
+		{"role scopes", jwt.MapClaims{"roles": []string{"support"}}, []string{ScopeAsk}},
+		{"claim cannot add admin", jwt.MapClaims{"roles": []string{"support"}, "scope": "ask admin"}, []string{ScopeAsk}},
+		{"claim cannot add execute-saved", jwt.MapClaims{"roles": []string{"support"}, "scope": "execute-saved"}, nil},
+		{"claim without role grants nothing", jwt.MapClaims{"scope": "admin ask"}, nil},
+		{"claim narrows role scopes", jwt.MapClaims{"roles": []string{"analyst"}, "scope": "openid ask"}, []string{ScopeAsk}},
+		{"admin role covers every scope", jwt.MapClaims{"roles": []string{"d2t-admin"}, "scope": "ask"}, []string{ScopeAsk}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			principal, err := ti.validator.Validate(ti.sign(t, "test-key", tt.claims))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(principal.Scopes, tt.want) {
+				t.Fatalf("scopes = %v, want %v", principal.Scopes, tt.want)
+			}
+		})
+	}
+}
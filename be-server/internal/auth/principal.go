@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"d2t_server/internal/config"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// 访问范围
+const (
+	ScopeAsk          = "ask"
+	ScopeExecuteSaved = "execute-saved"
+	ScopeAdmin        = "admin"
+)
+
+// AllScopes 全部可分配的访问范围
+var AllScopes = []string{ScopeAsk, ScopeExecuteSaved, ScopeAdmin}
+
+// 调用方类型
+const (
+	PrincipalAPIKey    = "api_key"
+	PrincipalAnonymous = "anonymous"
+)
+
+// APIKeyPrefix 生成的API Key统一前缀，便于识别和扫描泄露
+const APIKeyPrefix = "d2t_"
+
+// Principal 经过认证的调用方
+type Principal struct {
+	Type   string                 `json:"type"`
+	ID     string                 `json:"id"`
+	Name   string                 `json:"name"`
+	Scopes []string               `json:"scopes"`
+	Roles  []string               `json:"roles,omitempty"`
+	Claims map[string]interface{} `json:"-"`
+	// Workspace 调用方所属的工作区，为空表示 default
+	Workspace string `json:"workspace,omitempty"`
+	// Operator 引导管理员Key，可以管理所有工作区的API Key
+	Operator bool `json:"-"`
+}
+
+// WorkspaceName 返回调用方所属的工作区名称
+func (p *Principal) WorkspaceName() string {
+	if p == nil || p.Workspace == "" {
+		return config.DefaultWorkspace
+	}
+	return p.Workspace
+}
+
+// HasScope 判断调用方是否拥有某个访问范围，admin 拥有全部范围
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil {
+		return false
+	}
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateScopes 检查访问范围是否合法
+func ValidateScopes(scopes []string) error {
+	if len(scopes) == 0 {
+		return fmt.Errorf("at least one scope is required")
+	}
+	for _, s := range scopes {
+		valid := false
+		for _, known := range AllScopes {
+			if s == known {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Errorf("unknown scope: %s (allowed: %s)", s, strings.Join(AllScopes, ", "))
+		}
+	}
+	return nil
+}
+
+// GenerateAPIKey 生成一个新的随机API Key，只在创建时返回明文
+func GenerateAPIKey() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成API Key失败: %w", err)
+	}
+	return APIKeyPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashAPIKey 返回API Key的SHA-256摘要，数据库中只保存摘要
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix 返回用于列表展示的Key前缀
+func DisplayPrefix(key string) string {
+	if len(key) <= len(APIKeyPrefix)+8 {
+		return key
+	}
+	return key[:len(APIKeyPrefix)+8]
+}
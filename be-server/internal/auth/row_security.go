@@ -0,0 +1,184 @@
+package auth
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	// rolesSetting 当前调用方的角色列表，格式为 ",role1,role2,"
+	rolesSetting = "d2t.roles"
+	// userSettingPrefix :user.<claim> 对应的会话变量前缀
+	userSettingPrefix = "d2t.user_"
+	// policyPrefix 由本系统管理的行级安全策略名前缀
+	policyPrefix = "d2t_"
+)
+
+// tableName 行级过滤只支持普通（不加引号的）表名
+var tableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// userPlaceholder 匹配行级过滤条件中的 :user.<claim>，不匹配 :: 类型转换
+var userPlaceholder = regexp.MustCompile(`(^|[^:]):user\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// RowSecurity 执行受行级安全约束的查询所需的数据库角色和会话变量
+type RowSecurity struct {
+	Role     string
+	Settings map[string]string
+}
+
+// ResolveRowSecurity 返回调用方执行查询时需要的行级安全上下文；
+// 策略没有配置行级过滤或调用方不受限时返回 nil
+func ResolveRowSecurity(p *Principal, policy *config.AccessPolicy) (*RowSecurity, error) {
+	if !p.Restricted() || !policy.HasRowFilters() {
+		return nil, nil
+	}
+
+	rs := &RowSecurity{
+		Role:     policy.DBRole(),
+		Settings: map[string]string{rolesSetting: "," + strings.Join(p.Roles, ",") + ","},
+	}
+
+	// 只为调用方角色实际用到的声明设置会话变量，缺少声明时拒绝而不是返回空结果
+	for _, role := range p.Roles {
+		for table, predicate := range policy.Roles[role].RowFilters {
+			for _, m := range userPlaceholder.FindAllStringSubmatch(predicate, -1) {
+				claim := m[2]
+				value, ok := claimValue(p, claim)
+				if !ok {
+					return nil, fmt.Errorf("%w: claim %s required by the row filter on %s is missing", ErrForbidden, claim, table)
+				}
+				rs.Settings[userSettingPrefix+strings.ToLower(claim)] = value
+			}
+		}
+	}
+	return rs, nil
+}
+
+// claimValue 把声明转换为会话变量的文本值，数组用逗号连接
+func claimValue(p *Principal, claim string) (string, bool) {
+	if claim == "sub" && p.ID != "" {
+		return p.ID, true
+	}
+	value, ok := p.Claims[claim]
+	if !ok || value == nil {
+		return "", false
+	}
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case []interface{}:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = fmt.Sprint(item)
+		}
+		return strings.Join(parts, ","), true
+	default:
+		return fmt.Sprint(v), true
+	}
+}
+
+// RowSecurityStatements 根据访问策略生成数据库角色、授权和行级安全策略的DDL，可重复执行。
+// 每张配置了过滤条件的表上，每个可访问该表的角色对应一条 permissive 策略：
+// 角色配置了过滤条件时为 "角色生效 AND 条件"，否则为 "角色生效"。
+// 由于过滤在数据库扫描表时生效，无论查询通过 JOIN、子查询还是 CTE 访问该表都无法绕过。
+// schema 为目标数据源的表结构，不存在于该数据源的表被跳过。
+func RowSecurityStatements(policy *config.AccessPolicy, schema *core.Schema) ([]string, error) {
+	dbRole := policy.DBRole()
+	roleIdent := pq.QuoteIdentifier(dbRole)
+
+	stmts := []string{
+		fmt.Sprintf(`DO $$ BEGIN
+	IF NOT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = %s) THEN
+		CREATE ROLE %s NOLOGIN;
+	END IF;
+END $$`, pq.QuoteLiteral(dbRole), roleIdent),
+		fmt.Sprintf("GRANT %s TO CURRENT_USER", roleIdent),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %s", roleIdent),
+	}
+
+	// 只授权业务表，应用自身的表（API Key、查询历史等）对该角色不可见
+	for _, t := range schema.Tables {
+		stmts = append(stmts, fmt.Sprintf("GRANT SELECT ON %s TO %s", t.Name, roleIdent))
+	}
+
+	for _, table := range filteredTables(policy) {
+		if !tableName.MatchString(table) {
+			return nil, fmt.Errorf("invalid table name in row_filters: %q", table)
+		}
+		if _, ok := schema.Table(table); !ok {
+			continue
+		}
+		stmts = append(stmts,
+			fmt.Sprintf("ALTER TABLE %s ENABLE ROW LEVEL SECURITY", table),
+			fmt.Sprintf(`DO $$
+DECLARE pol record;
+BEGIN
+	FOR pol IN SELECT policyname FROM pg_policies WHERE schemaname = 'public' AND tablename = lower(%s) AND policyname LIKE %s LOOP
+		EXECUTE format('DROP POLICY %%I ON %s', pol.policyname);
+	END LOOP;
+END $$`, pq.QuoteLiteral(table), pq.QuoteLiteral(policyPrefix+"%"), table),
+		)
+
+		for _, role := range sortedRoles(policy) {
+			rp := policy.Roles[role]
+			if !matchesAny(rp.Tables, table) {
+				continue
+			}
+			using := fmt.Sprintf("strpos(current_setting('%s', true), %s) > 0", rolesSetting, pq.QuoteLiteral(","+role+","))
+			if predicate, ok := lookupFilter(rp.RowFilters, table); ok {
+				using = fmt.Sprintf("%s AND (%s)", using, renderPredicate(predicate))
+			}
+			stmts = append(stmts, fmt.Sprintf("CREATE POLICY %s ON %s FOR SELECT TO %s USING (%s)",
+				pq.QuoteIdentifier(policyPrefix+role), table, roleIdent, using))
+		}
+	}
+	return stmts, nil
+}
+
+// renderPredicate 把 :user.<claim> 替换为读取会话变量的表达式
+func renderPredicate(predicate string) string {
+	return userPlaceholder.ReplaceAllStringFunc(predicate, func(m string) string {
+		sub := userPlaceholder.FindStringSubmatch(m)
+		return fmt.Sprintf("%scurrent_setting('%s%s', true)", sub[1], userSettingPrefix, strings.ToLower(sub[2]))
+	})
+}
+
+// filteredTables 返回任一角色配置了行级过滤的表，按名称排序
+func filteredTables(policy *config.AccessPolicy) []string {
+	seen := make(map[string]bool)
+	var tables []string
+	for _, rp := range policy.Roles {
+		for table := range rp.RowFilters {
+			if key := strings.ToLower(table); !seen[key] {
+				seen[key] = true
+				tables = append(tables, table)
+			}
+		}
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+func sortedRoles(policy *config.AccessPolicy) []string {
+	roles := make([]string, 0, len(policy.Roles))
+	for role := range policy.Roles {
+		roles = append(roles, role)
+	}
+	sort.Strings(roles)
+	return roles
+}
+
+func lookupFilter(filters map[string]string, table string) (string, bool) {
+	for name, predicate := range filters {
+		if strings.EqualFold(name, table) {
+			return predicate, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"database/sql"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// rlsDDL uses table names of its own so the integration test never touches
+// the business tables of the database it runs against
+const rlsDDL = `
+CREATE TABLE rls_customers
+(
+  cust_id    char(10) NOT NULL ,
+  cust_state char(5)
+);
+
+CREATE TABLE rls_orders
+(
+  order_num int      NOT NULL ,
+  cust_id   char(10) NOT NULL
+);
+`
+
+// rlsQueries read rls_customers through joins, subqueries and CTEs; want is
+// the row count a caller from CA must see
+var rlsQueries = []struct {
+	name string
+	sql  string
+	want int
+}{
+	{"table", "SELECT cust_id FROM rls_customers", 1},
+	{"join", "SELECT o.order_num FROM rls_orders o JOIN rls_customers c ON c.cust_id = o.cust_id", 1},
+	{"subquery", "SELECT order_num FROM rls_orders WHERE cust_id IN (SELECT cust_id FROM rls_customers WHERE cust_state = 'NY')", 0},
+	{"scalar subquery", "SELECT (SELECT count(*) FROM rls_customers) AS n WHERE (SELECT count(*) FROM rls_customers) = 1", 1},
+	{"cte", "WITH c AS (SELECT * FROM rls_customers) SELECT cust_id FROM c WHERE cust_state = 'NY'", 0},
+	{"union", "SELECT cust_id FROM rls_customers UNION ALL SELECT cust_id FROM rls_customers WHERE cust_state <> 'CA'", 1},
+}
+
+func rlsPolicy() *config.AccessPolicy {
+	return &config.AccessPolicy{
+		RowSecurityRole: "d2t_test_reader",
+		Roles: map[string]config.RolePolicy{
+			"regional": {
+				DataSources: []string{"*"},
+				Tables:      []string{"rls_customers", "rls_orders"},
+				RowFilters:  map[string]string{"rls_customers": "rls_customers.cust_state = :user.region"},
+				Scopes:      []string{ScopeAsk},
+			},
+			"global": {
+				DataSources: []string{"*"},
+				Tables:      []string{"*"},
+				Scopes:      []string{ScopeAsk},
+			},
+		},
+	}
+}
+
+func regionalUser(region interface{}) *Principal {
+	claims := map[string]interface{}{}
+	if region != nil {
+		claims["region"] = region
+	}
+	return &Principal{Type: PrincipalUser, ID: "user-1", Roles: []string{"regional"}, Claims: claims}
+}
+
+func TestResolveRowSecurity(t *testing.T) {
+	policy := rlsPolicy()
+
+	rs, err := ResolveRowSecurity(regionalUser("CA"), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rs.Role != "d2t_test_reader" || rs.Settings[rolesSetting] != ",regional," || rs.Settings[userSettingPrefix+"region"] != "CA" {
+		t.Fatalf("unexpected row security context %+v", rs)
+	}
+
+	if _, err := ResolveRowSecurity(regionalUser(nil), policy); !errors.Is(err, ErrForbidden) {
+		t.Fatalf("missing claim: got %v, want ErrForbidden", err)
+	}
+
+	// API keys are service credentials without roles: row filters do not apply
+	apiKey := &Principal{Type: PrincipalAPIKey, ID: "key-1"}
+	if rs, err := ResolveRowSecurity(apiKey, policy); rs != nil || err != nil {
+		t.Fatalf("api key: got %+v, %v", rs, err)
+	}
+}
+
+func TestRowSecurityStatements(t *testing.T) {
+	stmts, err := RowSecurityStatements(rlsPolicy(), core.ParseSchema(rlsDDL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	all := strings.Join(stmts, ";\n")
+
+	for _, want := range []string{
+		"GRANT SELECT ON rls_customers TO \"d2t_test_reader\"",
+		"GRANT SELECT ON rls_orders TO \"d2t_test_reader\"",
+		"ALTER TABLE rls_customers ENABLE ROW LEVEL SECURITY",
+		"CREATE POLICY \"d2t_regional\" ON rls_customers FOR SELECT TO \"d2t_test_reader\" USING (strpos(current_setting('d2t.roles', true), ',regional,') > 0 AND (rls_customers.cust_state = current_setting('d2t.user_region', true)))",
+		"CREATE POLICY \"d2t_global\" ON rls_customers FOR SELECT TO \"d2t_test_reader\" USING (strpos(current_setting('d2t.roles', true), ',global,') > 0)",
+	} {
+		if !strings.Contains(all, want) {
+			t.Errorf("missing statement %q", want)
+		}
+	}
+	if strings.Contains(all, "ALTER TABLE rls_orders") {
+		t.Errorf("unfiltered table should not get row level security")
+	}
+	if strings.Contains(strings.ToLower(all), "on d2t_") {
+		t.Errorf("application tables must not be granted to the reader role")
+	}
+
+	bad := rlsPolicy()
+	bad.Roles["regional"].RowFilters[`"rls_customers"; DROP TABLE x`] = "true"
+	if _, err := RowSecurityStatements(bad, core.ParseSchema(rlsDDL)); err == nil {
+		t.Fatalf("invalid table name in row_filters accepted")
+	}
+}
+
+// TestRowSecurityEscapes checks that SQL which would switch the role or
+// settings the row filters depend on, or run SQL the checks cannot see, is
+// rejected before it reaches the database
+func TestRowSecurityEscapes(t *testing.T) {
+	schema := core.ParseSchema(rlsDDL)
+	for _, sqlStr := range []string{
+		"SELECT set_config('d2t.user_region', 'NY', true)",
+		"SELECT cust_id FROM rls_customers WHERE set_config('d2t.roles', ',global,', true) IS NOT NULL",
+		"SET ROLE postgres",
+		"RESET ROLE",
+		"SELECT 1; RESET ROLE",
+		"SELECT query_to_xml('SELECT * FROM rls_customers', true, true, '')",
+		"SELECT * FROM dblink('dbname=d2t', 'SELECT cust_id FROM rls_customers') AS t(cust_id text)",
+	} {
+		if err := AuthorizeSQL(regionalUser("CA"), rlsPolicy(), schema, sqlStr); !errors.Is(err, ErrForbidden) {
+			t.Errorf("%q: got %v, want ErrForbidden", sqlStr, err)
+		}
+	}
+
+	// the queries of the integration test pass the checks and are left to PostgreSQL
+	for _, q := range rlsQueries {
+		if err := AuthorizeSQL(regionalUser("CA"), rlsPolicy(), schema, q.sql); err != nil {
+			t.Errorf("%s: %v", q.name, err)
+		}
+	}
+}
+
+// TestRowSecurityIntegration installs the policies in a disposable PostgreSQL
+// database given by TEST_DATABASE_DSN and checks that joins, subqueries and
+// CTEs only ever see the rows of the caller's region
+func TestRowSecurityIntegration(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	setup := []string{
+		"DROP TABLE IF EXISTS rls_orders, rls_customers",
+		rlsDDL,
+		"INSERT INTO rls_customers VALUES ('c1', 'CA'), ('c2', 'NY')",
+		"INSERT INTO rls_orders VALUES (1, 'c1'), (2, 'c2')",
+	}
+	policy := rlsPolicy()
+	stmts, err := RowSecurityStatements(policy, core.ParseSchema(rlsDDL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.ApplyStatements(db, append(setup, stmts...)); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Exec("DROP TABLE IF EXISTS rls_orders, rls_customers") })
+
+	rs, err := ResolveRowSecurity(regionalUser("CA"), policy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range rlsQueries {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := models.ExecuteSQLLimited(db, rs.Role, rs.Settings, models.ExecLimits{}, tt.sql)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(rows) != tt.want {
+				t.Fatalf("got %d rows %v, want %d", len(rows), rows, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"d2t_server/internal/config"
+	"fmt"
+)
+
+// ResolveWorkspace 返回调用方所属的工作区，工作区未配置时返回 ErrForbidden
+func ResolveWorkspace(p *Principal) (*config.Workspace, error) {
+	name := p.WorkspaceName()
+	ws, ok := config.GetWorkspaces().Get(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown workspace %s", ErrForbidden, name)
+	}
+	return ws, nil
+}
+
+// ResolveDataSource 返回调用方所属工作区中的数据源；其他工作区的同名数据源不可见，
+// 不存在时与无权访问一样返回 ErrForbidden，不泄露其他租户的信息
+func ResolveDataSource(p *Principal, dataSource string) (*config.Workspace, *config.DataSourceConfig, error) {
+	ws, err := ResolveWorkspace(p)
+	if err != nil {
+		return nil, nil, err
+	}
+	ds, ok := ws.DataSource(dataSource)
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: data source %s does not exist in workspace %s", ErrForbidden, dataSource, ws.Name)
+	}
+	return ws, ds, nil
+}
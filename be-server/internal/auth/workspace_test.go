@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestResolveDataSource(t *testing.T) {
+	sales := &Principal{Type: PrincipalAPIKey, ID: "key-1", Workspace: "sales"}
+	support := &Principal{Type: PrincipalAPIKey, ID: "key-2", Workspace: "support"}
+
+	ws, ds, err := ResolveDataSource(sales, "crm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Name != "sales" || ds.DSN != "host=crm.internal dbname=crm" {
+		t.Fatalf("got %s/%s (%s)", ws.Name, ds.Name, ds.DSN)
+	}
+
+	// a data source of the same name resolves within the caller's own workspace
+	if ws, _, err := ResolveDataSource(support, "default"); err != nil || ws.Name != "support" {
+		t.Fatalf("support/default: got %v, %v", ws, err)
+	}
+
+	denied := []struct {
+		name       string
+		principal  *Principal
+		dataSource string
+	}{
+		{"other workspace", support, "crm"},
+		{"other workspace reversed", sales, "tickets"},
+		{"default workspace", &Principal{Type: PrincipalAnonymous}, "crm"},
+		{"nil principal", nil, "tickets"},
+		{"unknown workspace", &Principal{Type: PrincipalAPIKey, ID: "key-3", Workspace: "gone"}, "default"},
+	}
+	for _, tt := range denied {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, ds, err := ResolveDataSource(tt.principal, tt.dataSource); !errors.Is(err, ErrForbidden) {
+				t.Fatalf("got %v, %v, want ErrForbidden", ds, err)
+			}
+		})
+	}
+}
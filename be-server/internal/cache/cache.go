@@ -0,0 +1,240 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"d2t_server/internal/metrics"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 缓存的两类内容
+const (
+	KindSQL    = "sql"
+	KindResult = "result"
+)
+
+// Record 存储中的一条缓存，Value 为 JSON；Workspace、DataSource、Question 用于失效
+type Record struct {
+	Key        string
+	Kind       string
+	Workspace  string
+	DataSource string
+	// Question 规范化后的问题
+	Question  string
+	Value     []byte
+	ExpiresAt time.Time
+}
+
+// Filter 失效条件，Workspace 为空表示全部工作区，DataSource、Question 为空表示不限
+type Filter struct {
+	Workspace  string
+	DataSource string
+	// Question 规范化后的问题
+	Question string
+}
+
+// matches 记录是否满足失效条件
+func (f Filter) matches(r *Record) bool {
+	return (f.Workspace == "" || r.Workspace == f.Workspace) &&
+		(f.DataSource == "" || r.DataSource == f.DataSource) &&
+		(f.Question == "" || r.Question == f.Question)
+}
+
+// Store 缓存存储：进程内 LRU 或 PostgreSQL
+type Store interface {
+	// Get 返回未过期的记录，不存在时为 nil
+	Get(key string) (*Record, error)
+	Put(r Record) error
+	// Invalidate 删除满足条件的记录，返回删除的条数
+	Invalidate(f Filter) (int64, error)
+}
+
+// SQLKey 生成SQL的缓存键：同一工作区、数据源下相同的规范化问题，在提示词模板版本和提示词上下文
+// （按调用方权限过滤后的表结构、few-shot 示例）都相同时得到相同的SQL
+type SQLKey struct {
+	Workspace     string
+	DataSource    string
+	Question      string
+	PromptVersion string
+	ContextHash   string
+	// Clarification 用户对澄清问题的回答（规范化后），同一问题不同的回答生成不同的SQL
+	Clarification string
+}
+
+// SQLEntry 缓存的生成结果
+type SQLEntry struct {
+	SQL           string                  `json:"sql"`
+	PromptVersion string                  `json:"prompt_version"`
+	Details       *core.GenerationDetails `json:"details,omitempty"`
+}
+
+// ResultKey 查询结果的缓存键：结果经过行级过滤和脱敏，只对同一调用方、同样的角色和行级过滤取值复用
+type ResultKey struct {
+	Workspace  string
+	DataSource string
+	Question   string
+	Principal  string
+	Roles      []string
+	// RowSettings 行级过滤使用的会话变量（调用方的角色和声明），声明变化后不再复用之前的结果
+	RowSettings map[string]string
+	SQL         string
+}
+
+// ResultEntry 缓存的查询结果和分析
+type ResultEntry struct {
+	Results  []map[string]interface{} `json:"results"`
+	Analysis string                   `json:"analysis"`
+}
+
+// Cache 问答缓存；为 nil 时所有操作都是空操作
+type Cache struct {
+	store     Store
+	sqlTTL    time.Duration
+	resultTTL time.Duration
+}
+
+// New 根据配置创建缓存，Backend 为 none 或 SQLTTL 为 0 时返回 nil（不缓存）
+func New(cfg config.CacheConfig) *Cache {
+	if cfg.Backend == "none" || cfg.SQLTTL <= 0 {
+		return nil
+	}
+
+	c := &Cache{sqlTTL: cfg.SQLTTL, resultTTL: cfg.ResultTTL}
+	switch cfg.Backend {
+	case "postgres":
+		c.store = &postgresStore{}
+	default:
+		if cfg.Backend != "memory" {
+			slog.Warn("unknown ANSWER_CACHE_BACKEND, using memory", "backend", cfg.Backend)
+		}
+		c.store = newMemoryStore(cfg.Size)
+	}
+	return c
+}
+
+var (
+	defaultCache   *Cache
+	defaultCacheMu sync.RWMutex
+)
+
+// SetDefault 设置服务层使用的缓存，启动时调用一次
+func SetDefault(c *Cache) {
+	defaultCacheMu.Lock()
+	defer defaultCacheMu.Unlock()
+	defaultCache = c
+}
+
+// Default 返回服务层使用的缓存，未设置时为 nil（不缓存）
+func Default() *Cache {
+	defaultCacheMu.RLock()
+	defer defaultCacheMu.RUnlock()
+	return defaultCache
+}
+
+// ResultsEnabled 是否缓存查询结果
+func (c *Cache) ResultsEnabled() bool {
+	return c != nil && c.resultTTL > 0
+}
+
+// GetSQL 查找缓存的SQL；存储不可用时视为未命中
+func (c *Cache) GetSQL(k SQLKey) (*SQLEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	var entry SQLEntry
+	ok := c.get(KindSQL, k.hash(), &entry)
+	return &entry, ok
+}
+
+// PutSQL 缓存生成的SQL
+func (c *Cache) PutSQL(k SQLKey, entry SQLEntry) {
+	if c == nil {
+		return
+	}
+	c.put(Record{Key: k.hash(), Kind: KindSQL, Workspace: k.Workspace, DataSource: k.DataSource, Question: k.Question}, entry, c.sqlTTL)
+}
+
+// GetResult 查找缓存的查询结果
+func (c *Cache) GetResult(k ResultKey) (*ResultEntry, bool) {
+	if !c.ResultsEnabled() {
+		return nil, false
+	}
+	var entry ResultEntry
+	ok := c.get(KindResult, k.hash(), &entry)
+	return &entry, ok
+}
+
+// PutResult 缓存查询结果和分析
+func (c *Cache) PutResult(k ResultKey, entry ResultEntry) {
+	if !c.ResultsEnabled() {
+		return
+	}
+	c.put(Record{Key: k.hash(), Kind: KindResult, Workspace: k.Workspace, DataSource: k.DataSource, Question: k.Question}, entry, c.resultTTL)
+}
+
+// Invalidate 删除满足条件的SQL和结果缓存
+func (c *Cache) Invalidate(f Filter) (int64, error) {
+	if c == nil {
+		return 0, nil
+	}
+	return c.store.Invalidate(f)
+}
+
+func (c *Cache) get(kind, key string, v interface{}) bool {
+	record, err := c.store.Get(key)
+	if err != nil {
+		slog.Warn("answer cache unavailable", "error", err)
+	}
+	hit := record != nil && decode(record.Value, v) == nil
+	metrics.ObserveCache(kind, hit)
+	return hit
+}
+
+func (c *Cache) put(r Record, v interface{}, ttl time.Duration) {
+	value, err := json.Marshal(v)
+	if err == nil {
+		r.Value = value
+		r.ExpiresAt = time.Now().Add(ttl)
+		err = c.store.Put(r)
+	}
+	if err != nil {
+		slog.Warn("failed to write answer cache", "kind", r.Kind, "error", err)
+	}
+}
+
+// decode 解析缓存的 JSON，数字保留为 json.Number 以免大整数丢失精度
+func decode(data []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
+
+func (k SQLKey) hash() string {
+	return hashParts(KindSQL, k.Workspace, k.DataSource, k.Question, k.PromptVersion, k.ContextHash, k.Clarification)
+}
+
+func (k ResultKey) hash() string {
+	roles := append([]string(nil), k.Roles...)
+	sort.Strings(roles)
+	// encoding/json 按键排序输出 map，相同的取值总是得到相同的文本
+	settings, _ := json.Marshal(k.RowSettings)
+	return hashParts(KindResult, k.Workspace, k.DataSource, k.Principal, strings.Join(roles, ","), string(settings), k.SQL)
+}
+
+// hashParts 以 NUL 分隔各部分后取 SHA-256
+func hashParts(parts ...string) string {
+	h := sha256.New()
+	for _, p := range parts {
+		h.Write([]byte(p))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
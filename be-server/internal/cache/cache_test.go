@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"d2t_server/internal/config"
+	"testing"
+	"time"
+)
+
+func newTestCache() *Cache {
+	return New(config.CacheConfig{Backend: "memory", Size: 100, SQLTTL: time.Minute, ResultTTL: time.Minute})
+}
+
+func TestCacheWorkspaceIsolation(t *testing.T) {
+	c := newTestCache()
+	sales := SQLKey{Workspace: "sales", DataSource: "default", Question: "top customers", PromptVersion: "v1"}
+	support := sales
+	support.Workspace = "support"
+
+	c.PutSQL(sales, SQLEntry{SQL: "SELECT 1"})
+	if _, ok := c.GetSQL(support); ok {
+		t.Fatalf("entry of workspace sales returned for support")
+	}
+	c.PutSQL(support, SQLEntry{SQL: "SELECT 2"})
+
+	// invalidating one workspace leaves the other untouched
+	n, err := c.Invalidate(Filter{Workspace: "support"})
+	if err != nil || n != 1 {
+		t.Fatalf("invalidate support: got %d, %v", n, err)
+	}
+	if _, ok := c.GetSQL(support); ok {
+		t.Fatalf("support entry survived invalidation")
+	}
+	if entry, ok := c.GetSQL(sales); !ok || entry.SQL != "SELECT 1" {
+		t.Fatalf("sales entry: got %+v, %v", entry, ok)
+	}
+}
+
+func TestFilterMatches(t *testing.T) {
+	record := &Record{Workspace: "sales", DataSource: "crm", Question: "top customers"}
+	tests := []struct {
+		name   string
+		filter Filter
+		want   bool
+	}{
+		{"all workspaces", Filter{}, true},
+		{"same workspace", Filter{Workspace: "sales"}, true},
+		{"other workspace", Filter{Workspace: "support"}, false},
+		{"other workspace same data source", Filter{Workspace: "support", DataSource: "crm"}, false},
+		{"other workspace same question", Filter{Workspace: "support", Question: "top customers"}, false},
+		{"same workspace other data source", Filter{Workspace: "sales", DataSource: "default"}, false},
+		{"same workspace and question", Filter{Workspace: "sales", DataSource: "crm", Question: "top customers"}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.matches(record); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestResultKeyRowSettings(t *testing.T) {
+	c := newTestCache()
+	key := ResultKey{
+		Workspace:   "sales",
+		DataSource:  "default",
+		Principal:   "user:u1",
+		Roles:       []string{"regional"},
+		RowSettings: map[string]string{"d2t.roles": ",regional,", "d2t.user_region": "CA"},
+		SQL:         "SELECT cust_id FROM Customers",
+	}
+	c.PutResult(key, ResultEntry{Results: []map[string]interface{}{{"cust_id": "c1"}}})
+
+	same := key
+	same.RowSettings = map[string]string{"d2t.user_region": "CA", "d2t.roles": ",regional,"}
+	if _, ok := c.GetResult(same); !ok {
+		t.Fatalf("equal row settings missed the cache")
+	}
+
+	// the user's region claim changed: the rows filtered for CA must not be reused
+	moved := key
+	moved.RowSettings = map[string]string{"d2t.roles": ",regional,", "d2t.user_region": "NY"}
+	if _, ok := c.GetResult(moved); ok {
+		t.Fatalf("result cached for region CA returned for region NY")
+	}
+}
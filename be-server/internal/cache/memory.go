@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// memoryStore 进程内 LRU，超过容量时淘汰最久未使用的记录，只适用于单实例部署
+type memoryStore struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	items    map[string]*list.Element
+}
+
+func newMemoryStore(capacity int) *memoryStore {
+	if capacity < 1 {
+		capacity = 1
+	}
+	return &memoryStore{capacity: capacity, order: list.New(), items: make(map[string]*list.Element)}
+}
+
+func (s *memoryStore) Get(key string) (*Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	elem, ok := s.items[key]
+	if !ok {
+		return nil, nil
+	}
+	record := elem.Value.(*Record)
+	if time.Now().After(record.ExpiresAt) {
+		s.remove(elem)
+		return nil, nil
+	}
+	s.order.MoveToFront(elem)
+	return record, nil
+}
+
+func (s *memoryStore) Put(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if elem, ok := s.items[r.Key]; ok {
+		elem.Value = &r
+		s.order.MoveToFront(elem)
+		return nil
+	}
+	s.items[r.Key] = s.order.PushFront(&r)
+	for s.order.Len() > s.capacity {
+		s.remove(s.order.Back())
+	}
+	return nil
+}
+
+func (s *memoryStore) Invalidate(f Filter) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for elem := s.order.Front(); elem != nil; {
+		next := elem.Next()
+		if f.matches(elem.Value.(*Record)) {
+			s.remove(elem)
+			n++
+		}
+		elem = next
+	}
+	return n, nil
+}
+
+func (s *memoryStore) remove(elem *list.Element) {
+	s.order.Remove(elem)
+	delete(s.items, elem.Value.(*Record).Key)
+}
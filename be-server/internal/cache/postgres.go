@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"d2t_server/internal/models"
+	"sync"
+	"time"
+)
+
+// pruneInterval 清理过期记录的最小间隔
+const pruneInterval = time.Minute
+
+// postgresStore 缓存保存在 d2t_answer_cache 表中，多实例共享
+type postgresStore struct {
+	mu         sync.Mutex
+	lastPruned time.Time
+}
+
+func (s *postgresStore) Get(key string) (*Record, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, err
+	}
+	value, err := models.GetAnswerCache(db, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+	return &Record{Key: key, Value: value}, nil
+}
+
+func (s *postgresStore) Put(r Record) error {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return err
+	}
+	s.prune()
+	return models.PutAnswerCache(db, models.AnswerCacheEntry{
+		Key:        r.Key,
+		Kind:       r.Kind,
+		Workspace:  r.Workspace,
+		DataSource: r.DataSource,
+		Question:   r.Question,
+		Value:      r.Value,
+		ExpiresAt:  r.ExpiresAt,
+	})
+}
+
+func (s *postgresStore) Invalidate(f Filter) (int64, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return 0, err
+	}
+	return models.DeleteAnswerCache(db, f.Workspace, f.DataSource, f.Question)
+}
+
+// prune 写入时顺带删除过期记录，每个实例至多每分钟一次
+func (s *postgresStore) prune() {
+	s.mu.Lock()
+	due := time.Since(s.lastPruned) >= pruneInterval
+	if due {
+		s.lastPruned = time.Now()
+	}
+	s.mu.Unlock()
+	if !due {
+		return
+	}
+
+	db, err := models.GetAppDB()
+	if err == nil {
+		err = models.DeleteExpiredAnswerCache(db)
+	}
+	if err != nil {
+		// 清理失败不影响写入，下次写入时重试
+		s.mu.Lock()
+		s.lastPruned = time.Time{}
+		s.mu.Unlock()
+	}
+}
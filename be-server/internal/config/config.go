@@ -1,10 +1,13 @@
 package config
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/joho/godotenv"
@@ -12,14 +15,29 @@ import (
 
 // Config 结构体包含应用程序的所有配置
 type Config struct {
-	Server ServerConfig
-	DB     DBConfig
-	API    APIConfig
+	Server    ServerConfig
+	DB        DBConfig
+	API       APIConfig
+	LLM       LLMConfig
+	Auth      AuthConfig
+	RateLimit RateLimitConfig
+	CORS      CORSConfig
+	Log       LogConfig
+	Metrics   MetricsConfig
+	Tracing   TracingConfig
+	Health    HealthConfig
+	Cache     CacheConfig
+	Embedding EmbeddingConfig
+	Analysis  AnalysisConfig
+	Voting    VotingConfig
 }
 
 // ServerConfig 服务器相关配置
 type ServerConfig struct {
 	Port string
+	// TrustedProxies 可信反向代理的 IP 或网段，只有来自这些地址的请求才使用 X-Forwarded-For 确定客户端 IP；
+	// 为空时客户端 IP 为连接的对端地址
+	TrustedProxies []string
 }
 
 // DBConfig 数据库相关配置
@@ -36,13 +54,208 @@ type APIConfig struct {
 	Timeout time.Duration
 }
 
-// LoadConfig 加载配置信息
+// LLMConfig 大模型服务相关配置
+type LLMConfig struct {
+	Provider string
+	APIURL   string
+	APIKey   string
+	Model    string
+	// JSONMode 模板要求 JSON 输出时是否通过 response_format 使用服务商的 JSON 模式，不支持的服务商需关闭
+	JSONMode bool
+}
+
+// ErrLLMAPIKeyMissing 未配置 LLM_API_KEY，没有内置的默认密钥
+var ErrLLMAPIKeyMissing = errors.New("LLM_API_KEY is not set")
+
+// Validate 检查调用大模型所需的配置是否齐全
+func (c LLMConfig) Validate() error {
+	if c.APIKey == "" {
+		return ErrLLMAPIKeyMissing
+	}
+	return nil
+}
+
+// AuthConfig 认证相关配置
+type AuthConfig struct {
+	// Enabled 为 false 时所有请求都以匿名身份拥有全部权限，仅用于本地开发
+	Enabled bool
+	// AdminAPIKey 引导用的管理员Key，用于创建第一批数据库中的API Key
+	AdminAPIKey string
+	JWT         JWTConfig
+}
+
+// LogConfig 日志配置
+type LogConfig struct {
+	// Level 最低输出级别：debug、info、warn 或 error
+	Level string
+	// Format 输出格式：json 或 text
+	Format string
+	// RedactResults 为 true 时不记录查询结果和大模型响应内容，只记录长度
+	RedactResults bool
+}
+
+// MetricsConfig Prometheus 指标配置
+type MetricsConfig struct {
+	// Enabled 为 true 时在 /metrics 输出指标
+	Enabled bool
+	// Token 不为空时抓取 /metrics 需要携带 Authorization: Bearer <Token>
+	Token string
+}
+
+// TracingConfig OpenTelemetry 追踪配置
+type TracingConfig struct {
+	// Exporter 导出方式：none、otlp（OTLP/HTTP，地址由 OTEL_EXPORTER_OTLP_* 配置）或 stdout（本地调试）
+	Exporter    string
+	ServiceName string
+	// SampleRatio 根 span 的采样比例，上游传入的 traceparent 的采样决定优先
+	SampleRatio float64
+}
+
+// HealthConfig 就绪检查配置
+type HealthConfig struct {
+	// Timeout 单项检查的超时时间
+	Timeout time.Duration
+	// CacheTTL 数据库和表结构检查结果的缓存时间，避免探针频繁访问依赖
+	CacheTTL time.Duration
+	// LLMCacheTTL 大模型服务检查结果的缓存时间
+	LLMCacheTTL time.Duration
+	// LLMURL 检查大模型服务可达和 API Key 有效时请求的地址，为空时不检查
+	LLMURL string
+	// LLMCritical 大模型服务不可用时 /readyz 是否返回 503
+	LLMCritical bool
+}
+
+// CacheConfig 问答缓存配置
+type CacheConfig struct {
+	// Backend 缓存存储：memory（进程内 LRU）、postgres（多实例共享）或 none
+	Backend string
+	// Size memory 存储最多保存的条数
+	Size int
+	// SQLTTL 生成的SQL的缓存时间，0 表示不缓存
+	SQLTTL time.Duration
+	// ResultTTL 查询结果和分析的缓存时间，0 表示不缓存结果
+	ResultTTL time.Duration
+}
+
+// 问答结果的分析方式
+const (
+	// AnalysisSummarize 根据问题、SQL、列统计和结果样例用自然语言回答问题
+	AnalysisSummarize = "summarize"
+	// AnalysisExplain 只解释SQL本身
+	AnalysisExplain = "analyze"
+)
+
+// AnalysisConfig 问答结果分析配置
+type AnalysisConfig struct {
+	// Mode summarize 或 analyze
+	Mode string
+	// SampleRows 总结时最多提供给大模型的结果行数
+	SampleRows int
+	// MaxInputChars 总结时列统计和结果样例的总字符数上限，控制提示词的 token 数
+	MaxInputChars int
+}
+
+// VotingConfig 多候选SQL生成和按执行结果投票的配置
+type VotingConfig struct {
+	// Candidates 默认生成的候选SQL数，1 表示只生成一条、不投票
+	Candidates int
+	// MaxCandidates 请求中 candidates 参数的上限
+	MaxCandidates int
+	// Temperatures 各候选依次使用的采样温度，候选多于温度时循环使用
+	Temperatures []float64
+	// Timeout 执行每条候选SQL的语句超时
+	Timeout time.Duration
+	// MaxRows 执行候选时最多读取的行数，超出的候选在选中后不限行数重新执行
+	MaxRows int
+}
+
+// EmbeddingConfig 语义缓存的问题向量化配置
+type EmbeddingConfig struct {
+	// Provider none（关闭语义缓存）、local（进程内词项哈希向量，不调用外部服务）或 api（OpenAI 兼容的 /embeddings 接口）
+	Provider string
+	APIURL   string
+	APIKey   string
+	Model    string
+	// Threshold 问题与已验证示例的余弦相似度不低于该值时直接复用示例的SQL
+	Threshold float64
+}
+
+// RateLimitConfig 请求限流和大模型 token 预算配置，按 API Key / 用户 / IP 分别计算
+type RateLimitConfig struct {
+	// Backend 限流和用量的存储：memory（单实例）或 postgres（多实例共享）
+	Backend string
+	// RequestsPerMinute 令牌桶每分钟补充的请求数，0 表示不限流
+	RequestsPerMinute float64
+	// Burst 令牌桶容量，即允许的突发请求数
+	Burst int
+	// DailyTokens / MonthlyTokens 每个调用方每天/每月可消耗的大模型 token 数，0 表示不限制
+	DailyTokens   int64
+	MonthlyTokens int64
+}
+
+// JWTConfig 身份提供方签发的JWT校验配置，JWKSFile 和 JWKSURL 都为空时不启用
+type JWTConfig struct {
+	JWKSFile   string
+	JWKSURL    string
+	Issuer     string
+	Audience   string
+	RolesClaim string
+	// WorkspaceClaim 令牌中表示所属工作区的声明，缺省时属于 default 工作区
+	WorkspaceClaim  string
+	RefreshInterval time.Duration
+}
+
+// Enabled 是否配置了JWT校验
+func (c JWTConfig) Enabled() bool {
+	return c.JWKSFile != "" || c.JWKSURL != ""
+}
+
+// defaultLLMAPIURL 默认的大模型 chat completions 地址
+const defaultLLMAPIURL = "https://api.deepseek.com/chat/completions"
+
+// defaultLLMHealthURL 由 chat completions 地址推出 OpenAI 兼容的模型列表地址，
+// 该接口不消耗 token，且在 API Key 无效时返回 401
+func defaultLLMHealthURL(apiURL string) string {
+	base, ok := strings.CutSuffix(strings.TrimSuffix(apiURL, "/"), "/chat/completions")
+	if !ok {
+		return ""
+	}
+	return base + "/models"
+}
+
+// defaultEmbeddingURL 由 chat completions 地址推出 OpenAI 兼容的向量化地址
+func defaultEmbeddingURL(apiURL string) string {
+	base, ok := strings.CutSuffix(strings.TrimSuffix(apiURL, "/"), "/chat/completions")
+	if !ok {
+		return ""
+	}
+	return base + "/embeddings"
+}
+
+var (
+	// current 最近一次 LoadConfig 的结果，GetXConfig 从中读取，不再每次重新加载 .env 和环境变量
+	current   *Config
+	currentMu sync.Mutex
+)
+
+// loadedConfig 返回已加载的配置，尚未加载时按默认位置加载一次
+func loadedConfig() (*Config, error) {
+	currentMu.Lock()
+	cfg := current
+	currentMu.Unlock()
+	if cfg != nil {
+		return cfg, nil
+	}
+	return LoadConfig("")
+}
+
+// LoadConfig 加载配置信息，结果同时作为 GetXConfig 使用的当前配置
 func LoadConfig(envFile string) (*Config, error) {
 	// 加载环境变量
 	if envFile != "" {
 		err := godotenv.Load(envFile)
 		if err != nil {
-			log.Printf("Warning: Error loading specified .env file (%s): %v", envFile, err)
+			slog.Warn("failed to load env file", "path", envFile, "error", err)
 		}
 	} else {
 		// 首先尝试直接加载当前目录下的.env
@@ -61,7 +274,7 @@ func LoadConfig(envFile string) (*Config, error) {
 
 			// 如果仍然失败，记录一条警告但不中断程序
 			if err != nil {
-				log.Printf("Warning: Error loading .env file: %v", err)
+				slog.Warn("failed to load .env file", "error", err)
 			}
 		}
 	}
@@ -70,14 +283,31 @@ func LoadConfig(envFile string) (*Config, error) {
 	apiTimeoutStr := getEnv("API_TIMEOUT_SECONDS", "300")
 	apiTimeout, err := strconv.Atoi(apiTimeoutStr)
 	if err != nil {
-		log.Printf("Warning: Invalid API_TIMEOUT_SECONDS value: %v, using default 300 seconds", err)
+		slog.Warn("invalid API_TIMEOUT_SECONDS, using default", "default", "300s", "error", err)
 		apiTimeout = 300
 	}
 
+	// 读取JWKS刷新间隔（默认10分钟）
+	jwksRefresh, err := time.ParseDuration(getEnv("JWT_JWKS_REFRESH", "10m"))
+	if err != nil {
+		slog.Warn("invalid JWT_JWKS_REFRESH, using default", "default", "10m", "error", err)
+		jwksRefresh = 10 * time.Minute
+	}
+
+	// 读取限流和 token 预算
+	rateLimit := RateLimitConfig{
+		Backend:           getEnv("RATE_LIMIT_BACKEND", "memory"),
+		RequestsPerMinute: parseFloatEnv("RATE_LIMIT_PER_MINUTE", 30),
+		Burst:             int(parseFloatEnv("RATE_LIMIT_BURST", 10)),
+		DailyTokens:       int64(parseFloatEnv("TOKEN_BUDGET_DAILY", 0)),
+		MonthlyTokens:     int64(parseFloatEnv("TOKEN_BUDGET_MONTHLY", 0)),
+	}
+
 	// 读取配置
 	config := &Config{
 		Server: ServerConfig{
-			Port: getEnv("PORT", "8080"),
+			Port:           getEnv("PORT", "8080"),
+			TrustedProxies: splitList(os.Getenv("TRUSTED_PROXIES")),
 		},
 		DB: DBConfig{
 			User:     os.Getenv("DB_USER"),
@@ -89,8 +319,79 @@ func LoadConfig(envFile string) (*Config, error) {
 		API: APIConfig{
 			Timeout: time.Duration(apiTimeout) * time.Second,
 		},
+		Auth: AuthConfig{
+			Enabled:     getEnv("AUTH_ENABLED", "true") != "false",
+			AdminAPIKey: os.Getenv("ADMIN_API_KEY"),
+			JWT: JWTConfig{
+				JWKSFile:        os.Getenv("JWT_JWKS_FILE"),
+				JWKSURL:         os.Getenv("JWT_JWKS_URL"),
+				Issuer:          os.Getenv("JWT_ISSUER"),
+				Audience:        os.Getenv("JWT_AUDIENCE"),
+				RolesClaim:      getEnv("JWT_ROLES_CLAIM", "roles"),
+				WorkspaceClaim:  getEnv("JWT_WORKSPACE_CLAIM", "workspace"),
+				RefreshInterval: jwksRefresh,
+			},
+		},
+		LLM: LLMConfig{
+			Provider: getEnv("LLM_PROVIDER", "deepseek"),
+			APIURL:   getEnv("LLM_API_URL", defaultLLMAPIURL),
+			APIKey:   os.Getenv("LLM_API_KEY"),
+			Model:    getEnv("LLM_MODEL", "deepseek-chat"),
+			JSONMode: getEnv("LLM_JSON_MODE", "true") != "false",
+		},
+		RateLimit: rateLimit,
+		CORS:      loadCORSConfig(),
+		Log: LogConfig{
+			Level:         getEnv("LOG_LEVEL", "info"),
+			Format:        getEnv("LOG_FORMAT", "json"),
+			RedactResults: getEnv("LOG_REDACT_RESULTS", "true") != "false",
+		},
+		Metrics: MetricsConfig{
+			Enabled: getEnv("METRICS_ENABLED", "true") != "false",
+			Token:   os.Getenv("METRICS_TOKEN"),
+		},
+		Health: HealthConfig{
+			Timeout:     parseDurationEnv("HEALTH_CHECK_TIMEOUT", 3*time.Second),
+			CacheTTL:    parseDurationEnv("HEALTH_CACHE_TTL", 10*time.Second),
+			LLMCacheTTL: parseDurationEnv("HEALTH_LLM_CACHE_TTL", time.Minute),
+			LLMURL:      getEnv("HEALTH_LLM_URL", defaultLLMHealthURL(getEnv("LLM_API_URL", defaultLLMAPIURL))),
+			LLMCritical: getEnv("HEALTH_LLM_CRITICAL", "true") != "false",
+		},
+		Cache: CacheConfig{
+			Backend:   getEnv("ANSWER_CACHE_BACKEND", "memory"),
+			Size:      int(parseFloatEnv("ANSWER_CACHE_SIZE", 1000)),
+			SQLTTL:    parseDurationEnv("ANSWER_CACHE_TTL", 24*time.Hour),
+			ResultTTL: parseDurationEnv("ANSWER_CACHE_RESULT_TTL", 0),
+		},
+		Embedding: EmbeddingConfig{
+			Provider:  getEnv("SEMANTIC_CACHE_EMBEDDER", "none"),
+			APIURL:    getEnv("EMBEDDING_API_URL", defaultEmbeddingURL(getEnv("LLM_API_URL", defaultLLMAPIURL))),
+			APIKey:    getEnv("EMBEDDING_API_KEY", os.Getenv("LLM_API_KEY")),
+			Model:     getEnv("EMBEDDING_MODEL", "text-embedding-3-small"),
+			Threshold: parseFloatEnv("SEMANTIC_CACHE_THRESHOLD", 0.9),
+		},
+		Analysis: AnalysisConfig{
+			Mode:          getEnv("ANALYSIS_MODE", AnalysisSummarize),
+			SampleRows:    int(parseFloatEnv("SUMMARY_SAMPLE_ROWS", 20)),
+			MaxInputChars: int(parseFloatEnv("SUMMARY_MAX_INPUT_CHARS", 6000)),
+		},
+		Voting: VotingConfig{
+			Candidates:    int(parseFloatEnv("SQL_CANDIDATES", 1)),
+			MaxCandidates: int(parseFloatEnv("SQL_MAX_CANDIDATES", 5)),
+			Temperatures:  parseFloatListEnv("SQL_CANDIDATE_TEMPERATURES", []float64{0, 0.5, 0.8, 1}),
+			Timeout:       parseDurationEnv("SQL_CANDIDATE_TIMEOUT", 10*time.Second),
+			MaxRows:       int(parseFloatEnv("SQL_CANDIDATE_MAX_ROWS", 1000)),
+		},
+		Tracing: TracingConfig{
+			Exporter:    getEnv("TRACING_EXPORTER", "none"),
+			ServiceName: getEnv("OTEL_SERVICE_NAME", "d2t-server"),
+			SampleRatio: parseFloatEnv("TRACING_SAMPLE_RATIO", 1),
+		},
 	}
 
+	currentMu.Lock()
+	current = config
+	currentMu.Unlock()
 	return config, nil
 }
 
@@ -103,15 +404,98 @@ func getEnv(key, defaultValue string) string {
 	return value
 }
 
+// parseFloatEnv 读取数值型环境变量，未设置或无效时返回默认值
+func parseFloatEnv(key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < 0 {
+		slog.Warn("invalid numeric setting, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return f
+}
+
+// parseFloatListEnv 读取逗号分隔的数值列表，未设置或含无效值时返回默认值
+func parseFloatListEnv(key string, defaultValue []float64) []float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var list []float64
+	for _, item := range splitList(value) {
+		f, err := strconv.ParseFloat(item, 64)
+		if err != nil || f < 0 {
+			slog.Warn("invalid numeric list setting, using default", "key", key, "value", value, "default", defaultValue)
+			return defaultValue
+		}
+		list = append(list, f)
+	}
+	if len(list) == 0 {
+		return defaultValue
+	}
+	return list
+}
+
+// parseDurationEnv 读取时长型环境变量（如 10s、1m），未设置或无效时返回默认值
+func parseDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		slog.Warn("invalid duration setting, using default", "key", key, "value", value, "default", defaultValue)
+		return defaultValue
+	}
+	return d
+}
+
 // GetAPIConfig returns the API configuration
 func GetAPIConfig() APIConfig {
-	// Load config if not already loaded
-	config, err := LoadConfig("")
+	config, err := loadedConfig()
 	if err != nil {
-		log.Printf("Warning: Failed to load config, using default API timeout (30s)")
+		slog.Warn("failed to load config, using default API timeout", "default", "30s", "error", err)
 		return APIConfig{
 			Timeout: 30 * time.Second,
 		}
 	}
 	return config.API
 }
+
+// GetAnalysisConfig returns how askQA results are analyzed
+func GetAnalysisConfig() AnalysisConfig {
+	config, err := loadedConfig()
+	if err != nil {
+		slog.Warn("failed to load config, using default analysis mode", "error", err)
+		return AnalysisConfig{Mode: AnalysisSummarize}
+	}
+	return config.Analysis
+}
+
+// GetVotingConfig returns the multi-candidate generation settings
+func GetVotingConfig() VotingConfig {
+	config, err := loadedConfig()
+	if err != nil {
+		slog.Warn("failed to load config, generating a single SQL candidate", "error", err)
+		return VotingConfig{Candidates: 1, MaxCandidates: 1}
+	}
+	return config.Voting
+}
+
+// GetLLMConfig returns the LLM provider configuration
+func GetLLMConfig() LLMConfig {
+	config, err := loadedConfig()
+	if err != nil {
+		slog.Warn("failed to load config, using default LLM provider", "error", err)
+		return LLMConfig{
+			Provider: "deepseek",
+			APIURL:   defaultLLMAPIURL,
+			Model:    "deepseek-chat",
+			JSONMode: true,
+		}
+	}
+	return config.LLM
+}
@@ -0,0 +1,119 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// AnyOrigin 允许任意来源，不能与 AllowCredentials 同时使用
+const AnyOrigin = "*"
+
+// CORSConfig 跨域策略配置
+type CORSConfig struct {
+	// Default 默认策略，适用于所有未被 Routes 覆盖的路径
+	Default CORSPolicy
+	// Routes 按路径覆盖默认策略，例如对 /health 等公开接口允许任意来源
+	Routes []CORSRoute
+}
+
+// CORSPolicy 一组跨域规则
+type CORSPolicy struct {
+	// AllowedOrigins 允许的来源，如 https://app.example.com；
+	// https://*.example.com 匹配任意子域名，* 匹配任意来源
+	AllowedOrigins []string
+	AllowedMethods []string
+	AllowedHeaders []string
+	// ExposedHeaders 浏览器脚本可以读取的响应头
+	ExposedHeaders []string
+	// AllowCredentials 是否允许携带 Cookie / Authorization 等凭据
+	AllowCredentials bool
+	// MaxAge 预检请求结果的缓存时间
+	MaxAge time.Duration
+}
+
+// CORSRoute 一个路径及其策略；Path 以 / 结尾时匹配该前缀下的所有路径
+type CORSRoute struct {
+	Path   string
+	Policy CORSPolicy
+}
+
+// MatchRoute 返回覆盖该路径的路由，多个同时匹配时取最长的路径；没有覆盖时返回 nil
+func (c CORSConfig) MatchRoute(path string) *CORSRoute {
+	var matched *CORSRoute
+	for i, route := range c.Routes {
+		if matched != nil && len(route.Path) <= len(matched.Path) {
+			continue
+		}
+		if path == route.Path || (strings.HasSuffix(route.Path, "/") && strings.HasPrefix(path, route.Path)) {
+			matched = &c.Routes[i]
+		}
+	}
+	return matched
+}
+
+// AllowsAnyOrigin 策略是否允许任意来源
+func (p CORSPolicy) AllowsAnyOrigin() bool {
+	for _, origin := range p.AllowedOrigins {
+		if origin == AnyOrigin {
+			return true
+		}
+	}
+	return false
+}
+
+// 默认允许的请求头、方法和对前端暴露的响应头
+var (
+	defaultCORSMethods = "GET, POST, PUT, DELETE, OPTIONS"
+	defaultCORSHeaders = "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, X-API-Key, Accept, Origin, Cache-Control, X-Requested-With, X-Request-ID"
+	defaultCORSExposed = "X-Request-ID, Retry-After, X-RateLimit-Limit, X-RateLimit-Remaining, X-Token-Budget-Daily-Remaining, X-Token-Budget-Monthly-Remaining, X-Workspace-Budget-Daily-Remaining, X-Workspace-Budget-Monthly-Remaining"
+)
+
+// loadCORSConfig 从环境变量读取跨域策略；CORS_PUBLIC_PATHS 中的路径允许任意来源的只读请求且不带凭据
+func loadCORSConfig() CORSConfig {
+	maxAge, err := time.ParseDuration(getEnv("CORS_MAX_AGE", "10m"))
+	if err != nil || maxAge < 0 {
+		slog.Warn("invalid CORS_MAX_AGE, using default", "value", os.Getenv("CORS_MAX_AGE"), "default", "10m")
+		maxAge = 10 * time.Minute
+	}
+
+	policy := CORSPolicy{
+		AllowedOrigins:   splitList(getEnv("CORS_ALLOWED_ORIGINS", "http://localhost:3000")),
+		AllowedMethods:   splitList(getEnv("CORS_ALLOWED_METHODS", defaultCORSMethods)),
+		AllowedHeaders:   splitList(getEnv("CORS_ALLOWED_HEADERS", defaultCORSHeaders)),
+		ExposedHeaders:   splitList(getEnv("CORS_EXPOSED_HEADERS", defaultCORSExposed)),
+		AllowCredentials: getEnv("CORS_ALLOW_CREDENTIALS", "false") == "true",
+		MaxAge:           maxAge,
+	}
+	// 浏览器拒绝 Access-Control-Allow-Origin: * 与凭据同时出现，任意来源时不允许凭据
+	if policy.AllowCredentials && policy.AllowsAnyOrigin() {
+		slog.Warn("CORS_ALLOW_CREDENTIALS is ignored because CORS_ALLOWED_ORIGINS allows any origin")
+		policy.AllowCredentials = false
+	}
+
+	public := CORSPolicy{
+		AllowedOrigins: []string{AnyOrigin},
+		AllowedMethods: []string{"GET", "HEAD", "OPTIONS"},
+		AllowedHeaders: policy.AllowedHeaders,
+		ExposedHeaders: policy.ExposedHeaders,
+		MaxAge:         maxAge,
+	}
+	var routes []CORSRoute
+	for _, path := range splitList(getEnv("CORS_PUBLIC_PATHS", "/health,/livez,/readyz,/ping")) {
+		routes = append(routes, CORSRoute{Path: path, Policy: public})
+	}
+
+	return CORSConfig{Default: policy, Routes: routes}
+}
+
+// splitList 拆分逗号分隔的列表，去掉空白和空项
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,88 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// DefaultDataSource 未指定数据源时使用的名称
+const DefaultDataSource = "default"
+
+// ExampleSeed 首次使用示例库时写入 default 工作区的问题→SQL示例
+type ExampleSeed struct {
+	DataSource string `json:"data_source"`
+	Question   string `json:"question"`
+	SQL        string `json:"sql"`
+}
+
+// DefaultExampleSeeds 针对内置 DatabaseSchema 的起步示例，只让示例库不为空；
+// 示例库应通过 POST /api/admin/feedback/:id/promote 把用户点赞或修正过的查询提升为示例来扩充
+var DefaultExampleSeeds = []ExampleSeed{
+	{
+		DataSource: DefaultDataSource,
+		Question:   "What is the total revenue per customer?",
+		SQL: `SELECT TRIM(c.cust_name) AS customer, SUM(oi.quantity * oi.item_price) AS revenue
+FROM Customers c
+JOIN Orders o ON o.cust_id = c.cust_id
+JOIN OrderItems oi ON oi.order_num = o.order_num
+GROUP BY TRIM(c.cust_name)
+ORDER BY revenue DESC;`,
+	},
+	{
+		DataSource: DefaultDataSource,
+		Question:   "Which products have never been ordered?",
+		SQL: `SELECT p.prod_id, TRIM(p.prod_name) AS product
+FROM Products p
+WHERE NOT EXISTS (SELECT 1 FROM OrderItems oi WHERE oi.prod_id = p.prod_id);`,
+	},
+	{
+		DataSource: DefaultDataSource,
+		Question:   "How many orders were placed each month?",
+		SQL: `SELECT DATE_TRUNC('month', o.order_date)::date AS order_month, COUNT(*) AS order_count
+FROM Orders o
+GROUP BY DATE_TRUNC('month', o.order_date)
+ORDER BY order_month;`,
+	},
+	{
+		DataSource: DefaultDataSource,
+		Question:   "List the number of products supplied by each vendor",
+		SQL: `SELECT TRIM(v.vend_name) AS vendor, COUNT(p.prod_id) AS product_count
+FROM Vendors v
+LEFT JOIN Products p ON p.vend_id = v.vend_id
+GROUP BY TRIM(v.vend_name)
+ORDER BY product_count DESC;`,
+	},
+	{
+		DataSource: DefaultDataSource,
+		Question:   "每个州有多少客户？",
+		SQL: `SELECT TRIM(cust_state) AS cust_state, COUNT(*) AS customer_count
+FROM Customers
+GROUP BY TRIM(cust_state)
+ORDER BY customer_count DESC;`,
+	},
+}
+
+// GetExampleSeeds 返回示例种子，EXAMPLES_SEED_FILE 指定时从 JSON 文件加载
+func GetExampleSeeds() ([]ExampleSeed, error) {
+	path := os.Getenv("EXAMPLES_SEED_FILE")
+	if path == "" {
+		return DefaultExampleSeeds, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取示例种子文件失败: %w", err)
+	}
+
+	var seeds []ExampleSeed
+	if err := json.Unmarshal(data, &seeds); err != nil {
+		return nil, fmt.Errorf("解析示例种子文件失败: %w", err)
+	}
+	for i := range seeds {
+		if seeds[i].DataSource == "" {
+			seeds[i].DataSource = DefaultDataSource
+		}
+	}
+	return seeds, nil
+}
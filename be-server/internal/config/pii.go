@@ -0,0 +1,144 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// 脱敏方式
+const (
+	MaskNone    = "none"    // 不脱敏
+	MaskPartial = "partial" // 部分遮盖，如 j***@x.com
+	MaskHash    = "hash"    // 确定性哈希，相同原值得到相同结果，可用于分组和关联
+	MaskFull    = "full"    // 完全遮盖
+)
+
+// maskStrictness 脱敏方式的严格程度，用于在多个角色或多个来源列之间取舍
+var maskStrictness = map[string]int{
+	MaskNone:    0,
+	MaskPartial: 1,
+	MaskHash:    2,
+	MaskFull:    3,
+}
+
+// PIIPolicy 敏感字段元数据及各角色的脱敏方式
+type PIIPolicy struct {
+	Columns []PIIColumn `json:"columns"`
+	// HashKey 确定性哈希使用的密钥，来自环境变量 PII_HASH_KEY
+	HashKey string `json:"-"`
+}
+
+// PIIColumn 被标记为个人信息的列；Strategy 为默认脱敏方式，Roles 按角色覆盖（如 "dpo": "none"）
+type PIIColumn struct {
+	Table    string            `json:"table"`
+	Column   string            `json:"column"`
+	Kind     string            `json:"kind"` // email / name / address / phone 等，决定部分遮盖的格式
+	Strategy string            `json:"strategy"`
+	Roles    map[string]string `json:"roles,omitempty"`
+}
+
+// DefaultPIIPolicy 基于 DatabaseSchema 的默认敏感字段
+var DefaultPIIPolicy = PIIPolicy{
+	Columns: []PIIColumn{
+		{Table: "Customers", Column: "cust_email", Kind: "email", Strategy: MaskPartial},
+		{Table: "Customers", Column: "cust_contact", Kind: "name", Strategy: MaskPartial},
+		{Table: "Customers", Column: "cust_address", Kind: "address", Strategy: MaskFull},
+	},
+}
+
+var (
+	piiPolicy     *PIIPolicy
+	piiPolicyOnce sync.Once
+)
+
+// GetPIIPolicy 返回敏感字段策略，PII_POLICY_FILE 指定时从 JSON 文件加载
+func GetPIIPolicy() *PIIPolicy {
+	piiPolicyOnce.Do(func() {
+		policy := DefaultPIIPolicy
+		if path := os.Getenv("PII_POLICY_FILE"); path != "" {
+			loaded, err := LoadPIIPolicy(path)
+			if err != nil {
+				slog.Warn("failed to load PII policy, using default", "path", path, "error", err)
+			} else {
+				policy = *loaded
+			}
+		}
+		policy.HashKey = os.Getenv("PII_HASH_KEY")
+		if policy.HashKey == "" {
+			slog.Warn("PII_HASH_KEY is not set, hashed PII values are unkeyed")
+		}
+		piiPolicy = &policy
+	})
+	return piiPolicy
+}
+
+// LoadPIIPolicy 从 JSON 文件加载敏感字段策略并校验
+func LoadPIIPolicy(path string) (*PIIPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取敏感字段策略文件失败: %w", err)
+	}
+
+	var policy PIIPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("解析敏感字段策略文件失败: %w", err)
+	}
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// Validate 检查每列都指定了表名、列名和合法的脱敏方式
+func (p *PIIPolicy) Validate() error {
+	for _, c := range p.Columns {
+		if c.Table == "" || c.Column == "" {
+			return fmt.Errorf("PII column must define table and column")
+		}
+		if _, ok := maskStrictness[c.Strategy]; !ok {
+			return fmt.Errorf("invalid strategy %q for %s.%s", c.Strategy, c.Table, c.Column)
+		}
+		for role, s := range c.Roles {
+			if _, ok := maskStrictness[s]; !ok {
+				return fmt.Errorf("invalid strategy %q for role %s on %s.%s", s, role, c.Table, c.Column)
+			}
+		}
+	}
+	return nil
+}
+
+// Find 按表名和列名（不区分大小写）查找敏感字段
+func (p *PIIPolicy) Find(table, column string) (PIIColumn, bool) {
+	for _, c := range p.Columns {
+		if strings.EqualFold(c.Table, table) && strings.EqualFold(c.Column, column) {
+			return c, true
+		}
+	}
+	return PIIColumn{}, false
+}
+
+// StrategyFor 返回调用方角色适用的脱敏方式；多个角色取最宽松的一个，没有角色覆盖时使用默认方式
+func (c PIIColumn) StrategyFor(roles []string) string {
+	strategy := ""
+	for _, role := range roles {
+		if s, ok := c.Roles[role]; ok && (strategy == "" || maskStrictness[s] < maskStrictness[strategy]) {
+			strategy = s
+		}
+	}
+	if strategy == "" {
+		return c.Strategy
+	}
+	return strategy
+}
+
+// StricterMask 返回两种脱敏方式中更严格的一种
+func StricterMask(a, b string) string {
+	if maskStrictness[b] > maskStrictness[a] {
+		return b
+	}
+	return a
+}
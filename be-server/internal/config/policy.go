@@ -0,0 +1,86 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// DefaultRowSecurityRole 执行带行级过滤的查询时切换到的数据库角色
+const DefaultRowSecurityRole = "d2t_reader"
+
+// AccessPolicy 基于角色的数据访问策略
+type AccessPolicy struct {
+	Roles map[string]RolePolicy `json:"roles"`
+	// RowSecurityRole 行级安全策略绑定的数据库角色，未设置时为 d2t_reader
+	RowSecurityRole string `json:"row_security_role,omitempty"`
+}
+
+// RolePolicy 某个角色可以访问的数据源和表，以及授予的访问范围；"*" 表示全部
+// Columns 按表名限制可访问的列，未列出的表可访问全部列
+// RowFilters 按表名配置行级过滤条件，可用 :user.<claim> 引用令牌声明，如 Customers.cust_state = :user.region
+type RolePolicy struct {
+	DataSources []string            `json:"data_sources"`
+	Tables      []string            `json:"tables"`
+	Columns     map[string][]string `json:"columns,omitempty"`
+	RowFilters  map[string]string   `json:"row_filters,omitempty"`
+	Scopes      []string            `json:"scopes"`
+}
+
+// DBRole 返回行级安全使用的数据库角色
+func (p *AccessPolicy) DBRole() string {
+	if p.RowSecurityRole != "" {
+		return p.RowSecurityRole
+	}
+	return DefaultRowSecurityRole
+}
+
+// HasRowFilters 是否有角色配置了行级过滤
+func (p *AccessPolicy) HasRowFilters() bool {
+	for _, rp := range p.Roles {
+		if len(rp.RowFilters) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	accessPolicy     *AccessPolicy
+	accessPolicyOnce sync.Once
+)
+
+// GetAccessPolicy 返回访问策略，ACCESS_POLICY_FILE 未设置或加载失败时为空策略（用户角色没有任何权限）
+func GetAccessPolicy() *AccessPolicy {
+	accessPolicyOnce.Do(func() {
+		accessPolicy = &AccessPolicy{Roles: map[string]RolePolicy{}}
+		if path := os.Getenv("ACCESS_POLICY_FILE"); path != "" {
+			loaded, err := LoadAccessPolicy(path)
+			if err != nil {
+				slog.Warn("failed to load access policy", "path", path, "error", err)
+				return
+			}
+			accessPolicy = loaded
+		}
+	})
+	return accessPolicy
+}
+
+// LoadAccessPolicy 从 JSON 文件加载访问策略
+func LoadAccessPolicy(path string) (*AccessPolicy, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取访问策略文件失败: %w", err)
+	}
+
+	var policy AccessPolicy
+	if err := json.Unmarshal(data, &policy); err != nil {
+		return nil, fmt.Errorf("解析访问策略文件失败: %w", err)
+	}
+	if policy.Roles == nil {
+		policy.Roles = map[string]RolePolicy{}
+	}
+	return &policy, nil
+}
@@ -0,0 +1,196 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// SemanticLayer 语义层定义：统一的指标、维度以及表之间的关联路径
+type SemanticLayer struct {
+	Metrics    []Metric    `json:"metrics"`
+	Dimensions []Dimension `json:"dimensions"`
+	Joins      []JoinPath  `json:"joins"`
+}
+
+// Metric 可复用的业务指标，例如 revenue = SUM(quantity * item_price)
+type Metric struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Description string   `json:"description"`
+	Table       string   `json:"table"`
+	Expression  string   `json:"expression"`
+	Synonyms    []string `json:"synonyms,omitempty"`
+}
+
+// Dimension 可复用的分组/过滤维度
+type Dimension struct {
+	Name        string   `json:"name"`
+	Label       string   `json:"label"`
+	Description string   `json:"description"`
+	Table       string   `json:"table"`
+	Expression  string   `json:"expression"`
+	Synonyms    []string `json:"synonyms,omitempty"`
+}
+
+// JoinPath 两张表之间的关联条件
+type JoinPath struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	On   string `json:"on"`
+}
+
+// DefaultSemanticLayer 基于 DatabaseSchema 的默认语义层
+var DefaultSemanticLayer = SemanticLayer{
+	Metrics: []Metric{
+		{
+			Name:        "revenue",
+			Label:       "Revenue",
+			Description: "Total sales amount of order items",
+			Table:       "OrderItems",
+			Expression:  "SUM(OrderItems.quantity * OrderItems.item_price)",
+			Synonyms:    []string{"sales", "turnover", "销售额", "收入"},
+		},
+		{
+			Name:        "order_count",
+			Label:       "Order count",
+			Description: "Number of distinct orders",
+			Table:       "Orders",
+			Expression:  "COUNT(DISTINCT Orders.order_num)",
+			Synonyms:    []string{"orders", "number of orders", "订单数"},
+		},
+		{
+			Name:        "items_sold",
+			Label:       "Items sold",
+			Description: "Total quantity of products sold",
+			Table:       "OrderItems",
+			Expression:  "SUM(OrderItems.quantity)",
+			Synonyms:    []string{"units sold", "quantity sold", "销量"},
+		},
+		{
+			Name:        "customer_count",
+			Label:       "Customer count",
+			Description: "Number of distinct customers",
+			Table:       "Customers",
+			Expression:  "COUNT(DISTINCT Customers.cust_id)",
+			Synonyms:    []string{"customers", "客户数"},
+		},
+		{
+			Name:        "average_order_value",
+			Label:       "Average order value",
+			Description: "Revenue divided by the number of distinct orders",
+			Table:       "OrderItems",
+			Expression:  "SUM(OrderItems.quantity * OrderItems.item_price) / NULLIF(COUNT(DISTINCT OrderItems.order_num), 0)",
+			Synonyms:    []string{"aov", "客单价"},
+		},
+	},
+	Dimensions: []Dimension{
+		{Name: "customer", Label: "Customer", Description: "Customer name", Table: "Customers", Expression: "TRIM(Customers.cust_name)"},
+		{Name: "customer_state", Label: "Customer state", Description: "State of the customer", Table: "Customers", Expression: "TRIM(Customers.cust_state)"},
+		{Name: "customer_country", Label: "Customer country", Description: "Country of the customer", Table: "Customers", Expression: "TRIM(Customers.cust_country)"},
+		{Name: "customer_city", Label: "Customer city", Description: "City of the customer", Table: "Customers", Expression: "TRIM(Customers.cust_city)"},
+		{Name: "product", Label: "Product", Description: "Product name", Table: "Products", Expression: "TRIM(Products.prod_name)"},
+		{Name: "vendor", Label: "Vendor", Description: "Vendor name", Table: "Vendors", Expression: "TRIM(Vendors.vend_name)"},
+		{Name: "order_date", Label: "Order date", Description: "Date the order was placed", Table: "Orders", Expression: "Orders.order_date"},
+		{Name: "order_month", Label: "Order month", Description: "Month the order was placed", Table: "Orders", Expression: "DATE_TRUNC('month', Orders.order_date)::date"},
+		{Name: "order_year", Label: "Order year", Description: "Year the order was placed", Table: "Orders", Expression: "EXTRACT(YEAR FROM Orders.order_date)::int"},
+	},
+	Joins: []JoinPath{
+		{From: "OrderItems", To: "Orders", On: "OrderItems.order_num = Orders.order_num"},
+		{From: "OrderItems", To: "Products", On: "OrderItems.prod_id = Products.prod_id"},
+		{From: "Orders", To: "Customers", On: "Orders.cust_id = Customers.cust_id"},
+		{From: "Products", To: "Vendors", On: "Products.vend_id = Vendors.vend_id"},
+	},
+}
+
+var (
+	semanticLayer     *SemanticLayer
+	semanticLayerOnce sync.Once
+)
+
+// GetSemanticLayer 返回当前生效的语义层，SEMANTIC_LAYER_FILE 指定时从 JSON 文件加载
+func GetSemanticLayer() *SemanticLayer {
+	semanticLayerOnce.Do(func() {
+		layer := DefaultSemanticLayer
+		if path := os.Getenv("SEMANTIC_LAYER_FILE"); path != "" {
+			loaded, err := LoadSemanticLayer(path)
+			if err != nil {
+				slog.Warn("failed to load semantic layer, using default", "path", path, "error", err)
+			} else {
+				layer = *loaded
+			}
+		}
+		semanticLayer = &layer
+	})
+	return semanticLayer
+}
+
+// LoadSemanticLayer 从 JSON 文件加载语义层定义并校验
+func LoadSemanticLayer(path string) (*SemanticLayer, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取语义层文件失败: %w", err)
+	}
+
+	var layer SemanticLayer
+	if err := json.Unmarshal(data, &layer); err != nil {
+		return nil, fmt.Errorf("解析语义层文件失败: %w", err)
+	}
+
+	if err := layer.Validate(); err != nil {
+		return nil, err
+	}
+	return &layer, nil
+}
+
+// Validate 检查语义层定义是否完整且没有重复名称
+func (l *SemanticLayer) Validate() error {
+	seen := make(map[string]bool)
+	for _, m := range l.Metrics {
+		if m.Name == "" || m.Table == "" || m.Expression == "" {
+			return fmt.Errorf("metric %q must define name, table and expression", m.Name)
+		}
+		if seen[m.Name] {
+			return fmt.Errorf("duplicate semantic name: %s", m.Name)
+		}
+		seen[m.Name] = true
+	}
+	for _, d := range l.Dimensions {
+		if d.Name == "" || d.Table == "" || d.Expression == "" {
+			return fmt.Errorf("dimension %q must define name, table and expression", d.Name)
+		}
+		if seen[d.Name] {
+			return fmt.Errorf("duplicate semantic name: %s", d.Name)
+		}
+		seen[d.Name] = true
+	}
+	for _, j := range l.Joins {
+		if j.From == "" || j.To == "" || j.On == "" {
+			return fmt.Errorf("join %s -> %s must define from, to and on", j.From, j.To)
+		}
+	}
+	return nil
+}
+
+// FindMetric 按名称（不区分大小写）查找指标
+func (l *SemanticLayer) FindMetric(name string) (Metric, bool) {
+	for _, m := range l.Metrics {
+		if strings.EqualFold(m.Name, name) {
+			return m, true
+		}
+	}
+	return Metric{}, false
+}
+
+// FindDimension 按名称（不区分大小写）查找维度
+func (l *SemanticLayer) FindDimension(name string) (Dimension, bool) {
+	for _, d := range l.Dimensions {
+		if strings.EqualFold(d.Name, name) {
+			return d, true
+		}
+	}
+	return Dimension{}, false
+}
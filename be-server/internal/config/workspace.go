@@ -0,0 +1,187 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+// SharedPool 共享数据库（DB_* 配置，也是应用库）连接池的名称
+const SharedPool = "shared"
+
+// DefaultWorkspace 未指定工作区的调用方（匿名、引导管理员Key、没有工作区声明的令牌）所属的工作区
+const DefaultWorkspace = "default"
+
+// workspaceName 工作区和数据源名称只允许小写字母、数字、- 和 _
+var workspaceName = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// WorkspaceRegistry 全部工作区（租户）
+type WorkspaceRegistry struct {
+	Workspaces map[string]*Workspace `json:"workspaces"`
+}
+
+// Workspace 一个租户：拥有自己的数据源及其表结构、提示词版本和 token 预算；
+// API Key、示例库、查询历史和审计日志都按工作区隔离
+type Workspace struct {
+	Name        string                       `json:"-"`
+	DataSources map[string]*DataSourceConfig `json:"data_sources"`
+	// PromptVersions 与 PROMPT_VERSIONS 格式相同，优先于全局配置
+	PromptVersions string `json:"prompt_versions,omitempty"`
+	// DailyTokens / MonthlyTokens 整个工作区每天/每月可消耗的大模型 token 数，0 表示不限制
+	DailyTokens   int64 `json:"daily_tokens,omitempty"`
+	MonthlyTokens int64 `json:"monthly_tokens,omitempty"`
+}
+
+// DataSourceConfig 工作区中的一个数据源
+type DataSourceConfig struct {
+	Name string `json:"-"`
+	// DSN PostgreSQL 连接串，可用 ${VAR} 引用环境变量；为空时使用 DB_* 配置的共享数据库
+	DSN string `json:"dsn,omitempty"`
+	// SchemaFile 提供给大模型和SQL检查使用的 DDL 文件，为空时使用内置的 DatabaseSchema
+	SchemaFile string `json:"schema_file,omitempty"`
+	// Schema 加载后的 DDL
+	Schema string `json:"-"`
+}
+
+// BuiltinSchema 数据源是否使用内置表结构（语义层和默认敏感字段基于内置表结构定义）
+func (d *DataSourceConfig) BuiltinSchema() bool {
+	return d.SchemaFile == ""
+}
+
+// Get 按名称返回工作区
+func (r *WorkspaceRegistry) Get(name string) (*Workspace, bool) {
+	ws, ok := r.Workspaces[name]
+	return ws, ok
+}
+
+// Names 返回排序后的工作区名称
+func (r *WorkspaceRegistry) Names() []string {
+	names := make([]string, 0, len(r.Workspaces))
+	for name := range r.Workspaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DataSource 按名称返回工作区中的数据源
+func (w *Workspace) DataSource(name string) (*DataSourceConfig, bool) {
+	ds, ok := w.DataSources[name]
+	return ds, ok
+}
+
+// DataSourceNames 返回排序后的数据源名称
+func (w *Workspace) DataSourceNames() []string {
+	names := make([]string, 0, len(w.DataSources))
+	for name := range w.DataSources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// PoolNames 把数据源连接串映射为连接池名称：共享数据库（空连接串）为 shared，其余为 "<工作区>/<数据源>"，
+// 多个数据源共用一个连接串时取排序后的第一个。用于在指标和健康检查中标识连接池而不暴露连接串
+func (r *WorkspaceRegistry) PoolNames() map[string]string {
+	names := map[string]string{"": SharedPool}
+	for _, wsName := range r.Names() {
+		ws := r.Workspaces[wsName]
+		for _, dsName := range ws.DataSourceNames() {
+			if dsn := ws.DataSources[dsName].DSN; names[dsn] == "" {
+				names[dsn] = wsName + "/" + dsName
+			}
+		}
+	}
+	return names
+}
+
+var (
+	workspaces     *WorkspaceRegistry
+	workspacesOnce sync.Once
+)
+
+// GetWorkspaces 返回工作区配置；WORKSPACES_FILE 未设置时只有 default 工作区，
+// 其中的 default 数据源使用共享数据库和内置表结构
+func GetWorkspaces() *WorkspaceRegistry {
+	workspacesOnce.Do(func() {
+		workspaces = defaultWorkspaces()
+		if path := os.Getenv("WORKSPACES_FILE"); path != "" {
+			loaded, err := LoadWorkspaces(path)
+			if err != nil {
+				slog.Warn("failed to load workspaces, using the default workspace only", "path", path, "error", err)
+				return
+			}
+			workspaces = loaded
+		}
+	})
+	return workspaces
+}
+
+func defaultWorkspaces() *WorkspaceRegistry {
+	registry := &WorkspaceRegistry{Workspaces: map[string]*Workspace{
+		DefaultWorkspace: {DataSources: map[string]*DataSourceConfig{DefaultDataSource: {}}},
+	}}
+	if err := registry.prepare(""); err != nil {
+		panic(err)
+	}
+	return registry
+}
+
+// LoadWorkspaces 从 JSON 文件加载工作区配置并读取各数据源的表结构文件；
+// 表结构文件的相对路径相对于配置文件所在目录
+func LoadWorkspaces(path string) (*WorkspaceRegistry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取工作区配置文件失败: %w", err)
+	}
+
+	var registry WorkspaceRegistry
+	if err := json.Unmarshal(data, &registry); err != nil {
+		return nil, fmt.Errorf("解析工作区配置文件失败: %w", err)
+	}
+	if len(registry.Workspaces) == 0 {
+		return nil, fmt.Errorf("工作区配置文件中没有工作区")
+	}
+	if err := registry.prepare(filepath.Dir(path)); err != nil {
+		return nil, err
+	}
+	return &registry, nil
+}
+
+// prepare 校验名称，填充名称字段，展开连接串中的环境变量并读取表结构
+func (r *WorkspaceRegistry) prepare(baseDir string) error {
+	for name, ws := range r.Workspaces {
+		if ws == nil || !workspaceName.MatchString(name) {
+			return fmt.Errorf("无效的工作区名称: %q", name)
+		}
+		if len(ws.DataSources) == 0 {
+			return fmt.Errorf("工作区 %s 没有数据源", name)
+		}
+		ws.Name = name
+		for dsName, ds := range ws.DataSources {
+			if ds == nil || !workspaceName.MatchString(dsName) {
+				return fmt.Errorf("工作区 %s 中的数据源名称无效: %q", name, dsName)
+			}
+			ds.Name = dsName
+			ds.DSN = os.ExpandEnv(ds.DSN)
+			ds.Schema = DatabaseSchema
+			if ds.SchemaFile != "" {
+				file := ds.SchemaFile
+				if !filepath.IsAbs(file) {
+					file = filepath.Join(baseDir, file)
+				}
+				ddl, err := os.ReadFile(file)
+				if err != nil {
+					return fmt.Errorf("读取工作区 %s 数据源 %s 的表结构失败: %w", name, dsName, err)
+				}
+				ds.Schema = string(ddl)
+			}
+		}
+	}
+	return nil
+}
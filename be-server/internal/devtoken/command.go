@@ -0,0 +1,133 @@
+package devtoken
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyID 本地签名钥匙的 kid
+const keyID = "d2t-dev"
+
+// Main 实现 `d2t devtoken` 子命令：生成本地签名钥匙和JWKS文件，并签发测试用JWT，返回进程退出码
+//
+//	d2t devtoken -dir ./devkeys -sub alice -roles analyst,support [-workspace sales] [-claims '{"region":"MI"}']
+//
+// 服务端配置 JWT_JWKS_FILE=<dir>/jwks.json 后即可用输出的令牌调用接口
+func Main(args []string) int {
+	fs := flag.NewFlagSet("devtoken", flag.ContinueOnError)
+	dir := fs.String("dir", "devkeys", "Directory holding the signing key and jwks.json (created when missing)")
+	subject := fs.String("sub", "dev-user", "Subject of the token")
+	roles := fs.String("roles", "", "Comma separated roles")
+	rolesClaim := fs.String("roles-claim", "roles", "Claim that carries the roles")
+	workspace := fs.String("workspace", "", "Workspace of the user")
+	workspaceClaim := fs.String("workspace-claim", "workspace", "Claim that carries the workspace")
+	issuer := fs.String("iss", "", "Issuer of the token")
+	audience := fs.String("aud", "", "Audience of the token")
+	extra := fs.String("claims", "", "Additional claims as a JSON object")
+	ttl := fs.Duration("ttl", time.Hour, "Token lifetime")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	key, err := loadOrCreateKey(*dir)
+	if err != nil {
+		log.Printf("devtoken: %v", err)
+		return 1
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"sub": *subject,
+		"iat": now.Unix(),
+		"exp": now.Add(*ttl).Unix(),
+	}
+	if *extra != "" {
+		if err := json.Unmarshal([]byte(*extra), &claims); err != nil {
+			log.Printf("devtoken: invalid -claims: %v", err)
+			return 2
+		}
+	}
+	if *roles != "" {
+		claims[*rolesClaim] = strings.Split(*roles, ",")
+	}
+	if *workspace != "" {
+		claims[*workspaceClaim] = *workspace
+	}
+	if *issuer != "" {
+		claims["iss"] = *issuer
+	}
+	if *audience != "" {
+		claims["aud"] = *audience
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = keyID
+	signed, err := token.SignedString(key)
+	if err != nil {
+		log.Printf("devtoken: failed to sign token: %v", err)
+		return 1
+	}
+
+	fmt.Println(signed)
+	return 0
+}
+
+// loadOrCreateKey 读取目录中的私钥，不存在时生成新的RSA钥匙并写出 jwks.json
+func loadOrCreateKey(dir string) (*rsa.PrivateKey, error) {
+	keyPath := filepath.Join(dir, "signing-key.pem")
+	if data, err := os.ReadFile(keyPath); err == nil {
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("invalid PEM in %s", keyPath)
+		}
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("创建目录失败: %w", err)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, fmt.Errorf("生成钥匙失败: %w", err)
+	}
+
+	pemData := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := os.WriteFile(keyPath, pemData, 0o600); err != nil {
+		return nil, fmt.Errorf("写入私钥失败: %w", err)
+	}
+
+	jwks := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": keyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}},
+	}
+	jwksData, err := json.MarshalIndent(jwks, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "jwks.json"), jwksData, 0o644); err != nil {
+		return nil, fmt.Errorf("写入JWKS失败: %w", err)
+	}
+	log.Printf("devtoken: created signing key and %s", filepath.Join(dir, "jwks.json"))
+	return key, nil
+}
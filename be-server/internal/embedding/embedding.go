@@ -0,0 +1,44 @@
+package embedding
+
+import (
+	"context"
+	"d2t_server/internal/config"
+	"d2t_server/utils"
+	"log/slog"
+)
+
+// Embedder 把问题转换为向量
+type Embedder interface {
+	// Embed 按输入顺序返回每段文本的向量，调用外部服务时 token 用量计入 meter
+	Embed(ctx context.Context, texts []string, meter *utils.UsageMeter) ([][]float64, error)
+	// Name 标识向量空间，不同向量化方式得到的向量不能互相比较
+	Name() string
+}
+
+// NewEmbedder 根据配置创建向量化方式，Provider 为 none 时返回 nil
+func NewEmbedder(cfg config.EmbeddingConfig) Embedder {
+	switch cfg.Provider {
+	case "none", "":
+		return nil
+	case "api":
+		return apiEmbedder{cfg: cfg}
+	default:
+		if cfg.Provider != "local" {
+			slog.Warn("unknown SEMANTIC_CACHE_EMBEDDER, using local", "embedder", cfg.Provider)
+		}
+		return localEmbedder{}
+	}
+}
+
+// apiEmbedder 调用 OpenAI 兼容的 /embeddings 接口
+type apiEmbedder struct {
+	cfg config.EmbeddingConfig
+}
+
+func (e apiEmbedder) Embed(ctx context.Context, texts []string, meter *utils.UsageMeter) ([][]float64, error) {
+	return utils.Embeddings(ctx, e.cfg, texts, meter)
+}
+
+func (e apiEmbedder) Name() string {
+	return "api:" + e.cfg.Model
+}
@@ -0,0 +1,172 @@
+package embedding
+
+import (
+	"context"
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"d2t_server/internal/metrics"
+	"d2t_server/utils"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// maxCachedVectors 进程内缓存的示例问题向量数量上限，超过后清空重新计算
+const maxCachedVectors = 10000
+
+// Candidate 可以复用的已验证问题→SQL
+type Candidate struct {
+	Question string
+	SQL      string
+}
+
+// Match 与问题语义最接近的已验证示例
+type Match struct {
+	Question   string  `json:"question"`
+	SQL        string  `json:"-"`
+	Similarity float64 `json:"similarity"`
+}
+
+// Index 在已验证的问题→SQL中查找与新问题语义相近的一条；为 nil 时不做查找。
+// 示例问题的向量缓存在进程内，示例库本身仍以数据库为准
+type Index struct {
+	embedder  Embedder
+	threshold float64
+
+	mu      sync.Mutex
+	vectors map[string][]float64
+}
+
+// New 根据配置创建索引，未启用语义缓存时返回 nil
+func New(cfg config.EmbeddingConfig) *Index {
+	embedder := NewEmbedder(cfg)
+	if embedder == nil {
+		return nil
+	}
+	return &Index{embedder: embedder, threshold: cfg.Threshold, vectors: make(map[string][]float64)}
+}
+
+var (
+	defaultIndex   *Index
+	defaultIndexMu sync.RWMutex
+)
+
+// SetDefault 设置服务层使用的索引，启动时调用一次
+func SetDefault(ix *Index) {
+	defaultIndexMu.Lock()
+	defer defaultIndexMu.Unlock()
+	defaultIndex = ix
+}
+
+// Default 返回服务层使用的索引，未设置时为 nil
+func Default() *Index {
+	defaultIndexMu.RLock()
+	defer defaultIndexMu.RUnlock()
+	return defaultIndex
+}
+
+// Nearest 返回相似度不低于阈值的最相近候选，没有时返回 nil；只为尚未缓存向量的候选调用向量化
+func (ix *Index) Nearest(ctx context.Context, question string, candidates []Candidate, meter *utils.UsageMeter) (*Match, error) {
+	if ix == nil || len(candidates) == 0 {
+		return nil, nil
+	}
+
+	vectors, err := ix.embed(ctx, question, candidates, meter)
+	if err != nil {
+		return nil, err
+	}
+
+	// 数字不同的问题（年份、前 N 名）向量仍然很接近，但SQL中的字面量不同，不能复用
+	numbers := numberSet(question)
+	var best *Match
+	for i, c := range candidates {
+		if numberSet(c.Question) != numbers {
+			continue
+		}
+		score := cosine(vectors[0], vectors[i+1])
+		if best == nil || score > best.Similarity {
+			best = &Match{Question: c.Question, SQL: c.SQL, Similarity: score}
+		}
+	}
+	hit := best != nil && best.Similarity >= ix.threshold
+	metrics.ObserveCache("semantic", hit)
+	if !hit {
+		return nil, nil
+	}
+	return best, nil
+}
+
+// embed 返回问题和各候选问题的向量，第一个为问题本身
+func (ix *Index) embed(ctx context.Context, question string, candidates []Candidate, meter *utils.UsageMeter) ([][]float64, error) {
+	prefix := ix.embedder.Name() + "\x00"
+	texts := make([]string, 0, len(candidates)+1)
+	texts = append(texts, question)
+	for _, c := range candidates {
+		texts = append(texts, c.Question)
+	}
+
+	vectors := make([][]float64, len(texts))
+	var missing []string
+	var missingAt []int
+	ix.mu.Lock()
+	for i, text := range texts {
+		if v, ok := ix.vectors[prefix+text]; ok {
+			vectors[i] = v
+			continue
+		}
+		missing = append(missing, text)
+		missingAt = append(missingAt, i)
+	}
+	ix.mu.Unlock()
+	if len(missing) == 0 {
+		return vectors, nil
+	}
+
+	embedded, err := ix.embedder.Embed(ctx, missing, meter)
+	if err != nil {
+		return nil, err
+	}
+
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	if len(ix.vectors)+len(missing) > maxCachedVectors {
+		ix.vectors = make(map[string][]float64)
+	}
+	for j, at := range missingAt {
+		vectors[at] = embedded[j]
+		ix.vectors[prefix+missing[j]] = embedded[j]
+	}
+	return vectors, nil
+}
+
+// numberSet 问题中出现的数字，排序去重后拼接
+func numberSet(question string) string {
+	var numbers []string
+	for _, token := range core.TokenizeQuestion(question) {
+		if strings.IndexFunc(token, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			numbers = append(numbers, token)
+		}
+	}
+	sort.Strings(numbers)
+	return strings.Join(slices.Compact(numbers), ",")
+}
+
+// cosine 两个向量的余弦相似度，维数不同时为 0
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
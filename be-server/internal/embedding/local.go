@@ -0,0 +1,65 @@
+package embedding
+
+import (
+	"context"
+	"d2t_server/core"
+	"d2t_server/utils"
+	"hash/fnv"
+	"math"
+)
+
+// localDimensions 本地向量的维数
+const localDimensions = 512
+
+// subwordWeight 词内字符三元组的权重，低于整词，用于匹配词形变化（revenue / revenues）
+const subwordWeight = 0.5
+
+// localEmbedder 把问题的词项和词内字符三元组哈希到固定维数的向量，不调用外部服务。
+// 只能识别用词相近的改写，真正的同义改写需要使用 api 向量化
+type localEmbedder struct{}
+
+func (localEmbedder) Embed(_ context.Context, texts []string, _ *utils.UsageMeter) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = localVector(text)
+	}
+	return vectors, nil
+}
+
+func (localEmbedder) Name() string {
+	return "local"
+}
+
+// localVector 使用带符号的特征哈希生成单位向量
+func localVector(text string) []float64 {
+	vec := make([]float64, localDimensions)
+	for _, token := range core.TokenizeQuestion(text) {
+		addFeature(vec, "w:"+token, 1)
+		runes := []rune(token)
+		for i := 0; i+3 <= len(runes); i++ {
+			addFeature(vec, "c:"+string(runes[i:i+3]), subwordWeight)
+		}
+	}
+
+	var norm float64
+	for _, v := range vec {
+		norm += v * v
+	}
+	if norm > 0 {
+		norm = math.Sqrt(norm)
+		for i := range vec {
+			vec[i] /= norm
+		}
+	}
+	return vec
+}
+
+func addFeature(vec []float64, feature string, weight float64) {
+	h := fnv.New64a()
+	h.Write([]byte(feature))
+	sum := h.Sum64()
+	if sum&(1<<63) != 0 {
+		weight = -weight
+	}
+	vec[sum%localDimensions] += weight
+}
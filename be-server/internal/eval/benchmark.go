@@ -0,0 +1,61 @@
+package eval
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// BenchmarkCase 一道评测题：问题及其标准SQL
+type BenchmarkCase struct {
+	ID         string `json:"id"`
+	Question   string `json:"question"`
+	GoldSQL    string `json:"gold_sql"`
+	DataSource string `json:"data_source,omitempty"`
+}
+
+// LoadBenchmark 读取评测集，支持 JSON 数组（.json）和逐行 JSON（.jsonl）
+func LoadBenchmark(path string) ([]BenchmarkCase, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取评测集失败: %w", err)
+	}
+
+	var cases []BenchmarkCase
+	if strings.EqualFold(filepath.Ext(path), ".jsonl") {
+		scanner := bufio.NewScanner(bytes.NewReader(data))
+		scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+		line := 0
+		for scanner.Scan() {
+			line++
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			var c BenchmarkCase
+			if err := json.Unmarshal([]byte(text), &c); err != nil {
+				return nil, fmt.Errorf("解析评测集第%d行失败: %w", line, err)
+			}
+			cases = append(cases, c)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("读取评测集失败: %w", err)
+		}
+	} else if err := json.Unmarshal(data, &cases); err != nil {
+		return nil, fmt.Errorf("解析评测集失败: %w", err)
+	}
+
+	for i := range cases {
+		if cases[i].ID == "" {
+			cases[i].ID = fmt.Sprintf("q%d", i+1)
+		}
+		if cases[i].Question == "" || cases[i].GoldSQL == "" {
+			return nil, fmt.Errorf("评测题 %s 缺少 question 或 gold_sql", cases[i].ID)
+		}
+	}
+	return cases, nil
+}
@@ -0,0 +1,124 @@
+package eval
+
+import (
+	"d2t_server/internal/config"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Main 实现 `d2t eval` 子命令，返回进程退出码
+//
+//	d2t eval -benchmark bench.json [-db "host=... dbname=..."] [-out-json report.json] [-out-md report.md]
+func Main(args []string) int {
+	fs := flag.NewFlagSet("eval", flag.ContinueOnError)
+	envFile := fs.String("env", "", "Path to .env file")
+	benchmarkPath := fs.String("benchmark", "", "Benchmark file (.json array or .jsonl) of {id, question, gold_sql}")
+	dsn := fs.String("db", "", "Connection string of the test database (defaults to the DB_* settings)")
+	model := fs.String("model", "", "Override LLM_MODEL for this run")
+	apiURL := fs.String("api-url", "", "Override LLM_API_URL for this run")
+	fewShot := fs.Bool("few-shot", true, "Include similar seed examples in the prompt")
+	concurrency := fs.Int("concurrency", 1, "Number of questions evaluated in parallel")
+	statementTimeout := fs.Duration("statement-timeout", 30*time.Second, "Timeout of each executed statement")
+	outJSON := fs.String("out-json", "", "Write the JSON report to this file (stdout when neither output is set)")
+	outMarkdown := fs.String("out-md", "", "Write the Markdown report to this file")
+	minAccuracy := fs.Float64("min-accuracy", 0, "Exit with status 1 when accuracy is below this value (0-1)")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *benchmarkPath == "" {
+		fmt.Fprintln(os.Stderr, "eval: -benchmark is required")
+		fs.Usage()
+		return 2
+	}
+
+	// 命令行参数通过环境变量覆盖大模型配置，先于加载配置设置，优先于 .env 中的值
+	if *model != "" {
+		os.Setenv("LLM_MODEL", *model)
+	}
+	if *apiURL != "" {
+		os.Setenv("LLM_API_URL", *apiURL)
+	}
+	cfg, err := config.LoadConfig(*envFile)
+	if err != nil {
+		log.Printf("eval: failed to load configuration: %v", err)
+		return 1
+	}
+
+	cases, err := LoadBenchmark(*benchmarkPath)
+	if err != nil {
+		log.Printf("eval: %v", err)
+		return 1
+	}
+
+	connStr := *dsn
+	if connStr == "" {
+		port := cfg.DB.Port
+		if port == "" {
+			port = "5432"
+		}
+		connStr = fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+			cfg.DB.Host, port, cfg.DB.User, cfg.DB.Password, cfg.DB.Name)
+	}
+	db, err := sql.Open("postgres", connStr)
+	if err != nil {
+		log.Printf("eval: failed to open test database: %v", err)
+		return 1
+	}
+	defer db.Close()
+	if err := db.Ping(); err != nil {
+		log.Printf("eval: failed to connect to test database: %v", err)
+		return 1
+	}
+
+	log.Printf("eval: running %d questions from %s", len(cases), *benchmarkPath)
+	report := Run(db, cases, nil, Options{
+		FewShot:        *fewShot,
+		Concurrency:    *concurrency,
+		StatementLimit: *statementTimeout,
+	})
+	report.Benchmark = filepath.Base(*benchmarkPath)
+
+	if *outJSON == "" && *outMarkdown == "" {
+		if err := WriteJSON(os.Stdout, report); err != nil {
+			log.Printf("eval: %v", err)
+			return 1
+		}
+	}
+	if *outJSON != "" {
+		if err := writeFile(*outJSON, func(f *os.File) error { return WriteJSON(f, report) }); err != nil {
+			log.Printf("eval: %v", err)
+			return 1
+		}
+	}
+	if *outMarkdown != "" {
+		if err := writeFile(*outMarkdown, func(f *os.File) error { return WriteMarkdown(f, report) }); err != nil {
+			log.Printf("eval: %v", err)
+			return 1
+		}
+	}
+
+	log.Printf("eval: accuracy %.1f%% (%d/%d), p50 latency %dms",
+		report.Accuracy*100, report.Correct, report.Total, report.Latency.P50Ms)
+	if report.Accuracy < *minAccuracy {
+		return 1
+	}
+	return 0
+}
+
+func writeFile(path string, write func(f *os.File) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("创建报告文件失败: %w", err)
+	}
+	if err := write(f); err != nil {
+		f.Close()
+		return fmt.Errorf("写入报告失败: %w", err)
+	}
+	return f.Close()
+}
@@ -0,0 +1,51 @@
+package eval
+
+import (
+	"d2t_server/utils"
+	"sort"
+)
+
+// maxDiffRows 每道题在报告中最多展示的差异行数
+const maxDiffRows = 5
+
+// ResultDiff 两个结果集的差异
+type ResultDiff struct {
+	Match      bool     `json:"match"`
+	GoldRows   int      `json:"gold_rows"`
+	PredRows   int      `json:"pred_rows"`
+	Missing    []string `json:"missing,omitempty"`
+	Unexpected []string `json:"unexpected,omitempty"`
+}
+
+// CompareResults 比较标准答案和预测的结果集：忽略行顺序、列顺序和列名，
+// 对数值、时间和字符串做归一化（utils.RowKeys）后按多重集合比较
+func CompareResults(gold, pred []map[string]interface{}) ResultDiff {
+	goldKeys := utils.RowKeys(gold)
+	predKeys := utils.RowKeys(pred)
+
+	counts := make(map[string]int)
+	for _, k := range goldKeys {
+		counts[k]++
+	}
+	for _, k := range predKeys {
+		counts[k]--
+	}
+
+	diff := ResultDiff{GoldRows: len(gold), PredRows: len(pred)}
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		for n := counts[k]; n > 0 && len(diff.Missing) < maxDiffRows; n-- {
+			diff.Missing = append(diff.Missing, k)
+		}
+		for n := counts[k]; n < 0 && len(diff.Unexpected) < maxDiffRows; n++ {
+			diff.Unexpected = append(diff.Unexpected, k)
+		}
+	}
+
+	diff.Match = len(diff.Missing) == 0 && len(diff.Unexpected) == 0
+	return diff
+}
@@ -0,0 +1,99 @@
+package eval
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteJSON 以JSON格式输出报告
+func WriteJSON(w io.Writer, report *Report) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
+
+// WriteMarkdown 以Markdown格式输出报告：汇总、逐题结果以及失败题目的差异
+func WriteMarkdown(w io.Writer, report *Report) error {
+	var sb strings.Builder
+
+	sb.WriteString("# NL-to-SQL evaluation\n\n")
+	sb.WriteString("| Benchmark | Provider | Model | Accuracy | Correct | Generation errors | Execution errors | Gold errors |\n")
+	sb.WriteString("|---|---|---|---|---|---|---|---|\n")
+	sb.WriteString(fmt.Sprintf("| %s | %s | %s | %.1f%% | %d/%d | %d | %d | %d |\n\n",
+		report.Benchmark, report.Provider, report.Model, report.Accuracy*100,
+		report.Correct, report.Total, report.GenerationErrors, report.ExecutionErrors, report.GoldErrors))
+
+	sb.WriteString("| Latency | avg | p50 | p95 | max |\n")
+	sb.WriteString("|---|---|---|---|---|\n")
+	sb.WriteString(fmt.Sprintf("| generation (ms) | %d | %d | %d | %d |\n\n",
+		report.Latency.AvgMs, report.Latency.P50Ms, report.Latency.P95Ms, report.Latency.MaxMs))
+
+	sb.WriteString("## Questions\n\n")
+	sb.WriteString("| ID | Result | Prompt | Latency (ms) | Gold rows | Predicted rows | Question |\n")
+	sb.WriteString("|---|---|---|---|---|---|---|\n")
+	for _, c := range report.Cases {
+		goldRows, predRows := "-", "-"
+		if c.Diff != nil {
+			goldRows = fmt.Sprint(c.Diff.GoldRows)
+			predRows = fmt.Sprint(c.Diff.PredRows)
+		}
+		sb.WriteString(fmt.Sprintf("| %s | %s | %s | %d | %s | %s | %s |\n",
+			c.ID, caseOutcome(c), c.PromptVersion, c.LatencyMs, goldRows, predRows, escapeCell(c.Question)))
+	}
+
+	var failed []CaseResult
+	for _, c := range report.Cases {
+		if !c.Match {
+			failed = append(failed, c)
+		}
+	}
+	if len(failed) > 0 {
+		sb.WriteString("\n## Failures\n")
+		for _, c := range failed {
+			sb.WriteString(fmt.Sprintf("\n### %s: %s\n\n", c.ID, c.Question))
+			sb.WriteString("Gold SQL:\n\n```sql\n" + strings.TrimSpace(c.GoldSQL) + "\n```\n\n")
+			if c.PredictedSQL != "" {
+				sb.WriteString("Predicted SQL:\n\n```sql\n" + strings.TrimSpace(c.PredictedSQL) + "\n```\n\n")
+			}
+			for _, msg := range []string{c.GenerationError, c.GoldError, c.PredictedError} {
+				if msg != "" {
+					sb.WriteString("Error: `" + escapeCell(msg) + "`\n\n")
+				}
+			}
+			if c.Diff != nil {
+				for _, row := range c.Diff.Missing {
+					sb.WriteString("- missing: `" + escapeCell(row) + "`\n")
+				}
+				for _, row := range c.Diff.Unexpected {
+					sb.WriteString("- unexpected: `" + escapeCell(row) + "`\n")
+				}
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+func caseOutcome(c CaseResult) string {
+	switch {
+	case c.Match:
+		return "pass"
+	case c.GenerationError != "":
+		return "generation error"
+	case c.GoldError != "":
+		return "gold error"
+	case c.PredictedError != "":
+		return "execution error"
+	default:
+		return "mismatch"
+	}
+}
+
+func escapeCell(s string) string {
+	s = strings.ReplaceAll(s, "|", "\\|")
+	s = strings.ReplaceAll(s, "`", "'")
+	return strings.ReplaceAll(s, "\n", " ")
+}
@@ -0,0 +1,232 @@
+package eval
+
+import (
+	"context"
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"d2t_server/utils"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Generator 将问题转换为SQL，默认使用 core.Generate
+type Generator func(req core.GenerateRequest) (*core.Generation, error)
+
+// Options 评测运行参数
+type Options struct {
+	FewShot        bool
+	Concurrency    int
+	StatementLimit time.Duration
+}
+
+// CaseResult 单道题的评测结果
+type CaseResult struct {
+	ID              string      `json:"id"`
+	Question        string      `json:"question"`
+	GoldSQL         string      `json:"gold_sql"`
+	PredictedSQL    string      `json:"predicted_sql"`
+	PromptVersion   string      `json:"prompt_version,omitempty"`
+	Match           bool        `json:"match"`
+	LatencyMs       int64       `json:"latency_ms"`
+	GenerationError string      `json:"generation_error,omitempty"`
+	GoldError       string      `json:"gold_error,omitempty"`
+	PredictedError  string      `json:"predicted_error,omitempty"`
+	Diff            *ResultDiff `json:"diff,omitempty"`
+}
+
+// LatencyStats 生成SQL耗时统计（毫秒）
+type LatencyStats struct {
+	AvgMs int64 `json:"avg_ms"`
+	P50Ms int64 `json:"p50_ms"`
+	P95Ms int64 `json:"p95_ms"`
+	MaxMs int64 `json:"max_ms"`
+}
+
+// Report 一次评测的汇总报告
+type Report struct {
+	Benchmark        string       `json:"benchmark"`
+	Provider         string       `json:"provider"`
+	Model            string       `json:"model"`
+	StartedAt        time.Time    `json:"started_at"`
+	DurationMs       int64        `json:"duration_ms"`
+	Total            int          `json:"total"`
+	Correct          int          `json:"correct"`
+	Accuracy         float64      `json:"accuracy"`
+	GenerationErrors int          `json:"generation_errors"`
+	ExecutionErrors  int          `json:"execution_errors"`
+	GoldErrors       int          `json:"gold_errors"`
+	Latency          LatencyStats `json:"latency"`
+	Cases            []CaseResult `json:"cases"`
+}
+
+// Run 对每道题生成SQL，在测试库中分别执行标准SQL和预测SQL并比较结果集
+func Run(db *sql.DB, cases []BenchmarkCase, generate Generator, opts Options) *Report {
+	if generate == nil {
+		generate = func(req core.GenerateRequest) (*core.Generation, error) {
+			return core.Generate(context.Background(), req)
+		}
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 1
+	}
+
+	var seeds []config.ExampleSeed
+	if opts.FewShot {
+		loaded, err := config.GetExampleSeeds()
+		if err == nil {
+			seeds = loaded
+		}
+	}
+
+	llmConfig := config.GetLLMConfig()
+	report := &Report{
+		Provider:  llmConfig.Provider,
+		Model:     llmConfig.Model,
+		StartedAt: time.Now(),
+		Total:     len(cases),
+		Cases:     make([]CaseResult, len(cases)),
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, opts.Concurrency)
+	for i, c := range cases {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, c BenchmarkCase) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			report.Cases[i] = runCase(db, c, generate, fewShotFor(c, seeds), opts)
+		}(i, c)
+	}
+	wg.Wait()
+
+	var latencies []int64
+	for _, r := range report.Cases {
+		if r.Match {
+			report.Correct++
+		}
+		switch {
+		case r.GenerationError != "":
+			report.GenerationErrors++
+		case r.GoldError != "":
+			report.GoldErrors++
+		case r.PredictedError != "":
+			report.ExecutionErrors++
+		}
+		if r.GenerationError == "" {
+			latencies = append(latencies, r.LatencyMs)
+		}
+	}
+	if report.Total > 0 {
+		report.Accuracy = float64(report.Correct) / float64(report.Total)
+	}
+	report.Latency = latencyStats(latencies)
+	report.DurationMs = time.Since(report.StartedAt).Milliseconds()
+
+	return report
+}
+
+// fewShotFor 从示例种子中挑选相似示例，排除与评测题相同的问题以免泄露答案
+func fewShotFor(c BenchmarkCase, seeds []config.ExampleSeed) []utils.FewShotExample {
+	dataSource := dataSourceOf(c)
+
+	var candidates []utils.FewShotExample
+	for _, s := range seeds {
+		if s.DataSource != dataSource || strings.EqualFold(strings.TrimSpace(s.Question), strings.TrimSpace(c.Question)) {
+			continue
+		}
+		candidates = append(candidates, utils.FewShotExample{Question: s.Question, SQL: s.SQL})
+	}
+	return core.SelectSimilarExamples(c.Question, candidates, 3)
+}
+
+func dataSourceOf(c BenchmarkCase) string {
+	if c.DataSource == "" {
+		return config.DefaultDataSource
+	}
+	return c.DataSource
+}
+
+func runCase(db *sql.DB, c BenchmarkCase, generate Generator, examples []utils.FewShotExample, opts Options) CaseResult {
+	result := CaseResult{ID: c.ID, Question: c.Question, GoldSQL: c.GoldSQL}
+
+	start := time.Now()
+	generation, err := generate(core.GenerateRequest{
+		Question:   c.Question,
+		DataSource: dataSourceOf(c),
+		Examples:   examples,
+	})
+	result.LatencyMs = time.Since(start).Milliseconds()
+	if err != nil {
+		result.GenerationError = err.Error()
+		return result
+	}
+	predicted := generation.SQL
+	result.PredictedSQL = predicted
+	result.PromptVersion = generation.PromptVersion
+
+	goldRows, err := executeReadOnly(db, c.GoldSQL, opts.StatementLimit)
+	if err != nil {
+		result.GoldError = err.Error()
+		return result
+	}
+
+	predRows, err := executeReadOnly(db, predicted, opts.StatementLimit)
+	if err != nil {
+		result.PredictedError = err.Error()
+		return result
+	}
+
+	diff := CompareResults(goldRows, predRows)
+	result.Match = diff.Match
+	result.Diff = &diff
+	return result
+}
+
+// executeReadOnly 在只读事务中执行查询并回滚，避免评测修改测试库
+func executeReadOnly(db *sql.DB, sqlQuery string, timeout time.Duration) ([]map[string]interface{}, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SET TRANSACTION READ ONLY"); err != nil {
+		return nil, fmt.Errorf("设置只读事务失败: %w", err)
+	}
+	if timeout > 0 {
+		if _, err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", timeout.Milliseconds())); err != nil {
+			return nil, fmt.Errorf("设置语句超时失败: %w", err)
+		}
+	}
+
+	return models.ExecuteSQL(tx, sqlQuery)
+}
+
+func latencyStats(latencies []int64) LatencyStats {
+	if len(latencies) == 0 {
+		return LatencyStats{}
+	}
+	sorted := append([]int64(nil), latencies...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+
+	var sum int64
+	for _, l := range sorted {
+		sum += l
+	}
+	percentile := func(p float64) int64 {
+		idx := int(float64(len(sorted)-1) * p)
+		return sorted[idx]
+	}
+	return LatencyStats{
+		AvgMs: sum / int64(len(sorted)),
+		P50Ms: percentile(0.5),
+		P95Ms: percentile(0.95),
+		MaxMs: sorted[len(sorted)-1],
+	}
+}
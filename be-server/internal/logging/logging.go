@@ -0,0 +1,142 @@
+package logging
+
+import (
+	"context"
+	"d2t_server/internal/config"
+	"d2t_server/internal/requestid"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Redacted 替换敏感值的占位符
+const Redacted = "[REDACTED]"
+
+// 结构化日志中约定的字段名
+const (
+	KeyRequestID = "request_id"
+	KeyTraceID   = "trace_id"
+	KeySpanID    = "span_id"
+	// KeyResults / KeyLLMResponse 可能包含业务数据，LOG_REDACT_RESULTS 开启时只记录长度
+	KeyResults     = "results"
+	KeyLLMResponse = "llm_response"
+)
+
+// sensitiveKeys 字段名包含这些片段时整个值被替换
+var sensitiveKeys = []string{"password", "passwd", "secret", "api_key", "apikey", "authorization", "cookie", "dsn", "hash_key"}
+
+// sensitiveValues 出现在任意字符串值（包括错误信息）中的凭据
+var sensitiveValues = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`d2t_[0-9a-fA-F]{8,}`), "d2t_" + Redacted},
+	{regexp.MustCompile(`sk-[A-Za-z0-9_-]{8,}`), "sk-" + Redacted},
+	{regexp.MustCompile(`(?i)(bearer\s+)[A-Za-z0-9._~+/=-]+`), "${1}" + Redacted},
+	{regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+`), Redacted},
+	{regexp.MustCompile(`(?i)(password\s*[=:]\s*)('[^']*'|"[^"]*"|\S+)`), "${1}" + Redacted},
+	{regexp.MustCompile(`(?i)(postgres(?:ql)?://[^:/@\s]+:)[^@\s]+@`), "${1}" + Redacted + "@"},
+}
+
+// Setup 按配置创建 JSON 或文本格式的 slog 日志并设为默认；
+// 标准库 log 包的输出也会经过它，因此同样带有请求ID并被脱敏
+func Setup(cfg config.LogConfig) {
+	slog.SetDefault(New(os.Stderr, cfg))
+}
+
+// New 创建写入 w 的日志：附加上下文中的请求ID，并对凭据和（可选）结果数据脱敏
+func New(w io.Writer, cfg config.LogConfig) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:       ParseLevel(cfg.Level),
+		ReplaceAttr: redactor(cfg.RedactResults),
+	}
+
+	var handler slog.Handler
+	if strings.EqualFold(cfg.Format, "text") {
+		handler = slog.NewTextHandler(w, opts)
+	} else {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(contextHandler{handler})
+}
+
+// ParseLevel 解析 debug / info / warn / error，无法识别时为 info
+func ParseLevel(level string) slog.Level {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo
+	}
+	return l
+}
+
+// Redact 去掉字符串中的API Key、令牌和密码
+func Redact(s string) string {
+	for _, sv := range sensitiveValues {
+		s = sv.pattern.ReplaceAllString(s, sv.replacement)
+	}
+	return s
+}
+
+// redactor 返回 slog 的 ReplaceAttr：按字段名替换敏感值，对其余字符串值做凭据脱敏
+func redactor(redactResults bool) func([]string, slog.Attr) slog.Attr {
+	return func(groups []string, a slog.Attr) slog.Attr {
+		if sensitiveKey(a.Key) {
+			return slog.String(a.Key, Redacted)
+		}
+		if redactResults && (a.Key == KeyResults || a.Key == KeyLLMResponse) {
+			return slog.String(a.Key, fmt.Sprintf("%s (%d bytes)", Redacted, len(a.Value.String())))
+		}
+
+		switch a.Value.Kind() {
+		case slog.KindString:
+			return slog.String(a.Key, Redact(a.Value.String()))
+		case slog.KindAny:
+			if err, ok := a.Value.Any().(error); ok {
+				return slog.String(a.Key, Redact(err.Error()))
+			}
+		}
+		return a
+	}
+}
+
+// sensitiveKey 字段名是否表示凭据；token 只匹配 token、xxx_token，不匹配 prompt_tokens 等用量字段
+func sensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	if key == "token" || strings.HasSuffix(key, "_token") {
+		return true
+	}
+	for _, k := range sensitiveKeys {
+		if strings.Contains(key, k) {
+			return true
+		}
+	}
+	return false
+}
+
+// contextHandler 为每条日志附加上下文中的请求ID以及追踪的 trace/span ID
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := requestid.FromContext(ctx); id != "" {
+		r.AddAttrs(slog.String(KeyRequestID, id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String(KeyTraceID, sc.TraceID().String()), slog.String(KeySpanID, sc.SpanID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	dbMaxOpen = prometheus.NewDesc(namespace+"_db_max_open_connections",
+		"Maximum number of open connections of the pool.", []string{"pool"}, nil)
+	dbOpen = prometheus.NewDesc(namespace+"_db_open_connections",
+		"Number of established connections, in use and idle.", []string{"pool"}, nil)
+	dbInUse = prometheus.NewDesc(namespace+"_db_in_use_connections",
+		"Number of connections currently in use.", []string{"pool"}, nil)
+	dbIdle = prometheus.NewDesc(namespace+"_db_idle_connections",
+		"Number of idle connections.", []string{"pool"}, nil)
+	dbWaitCount = prometheus.NewDesc(namespace+"_db_wait_count_total",
+		"Total number of connections waited for.", []string{"pool"}, nil)
+	dbWaitDuration = prometheus.NewDesc(namespace+"_db_wait_duration_seconds_total",
+		"Total time blocked waiting for a new connection.", []string{"pool"}, nil)
+)
+
+// dbStatsCollector 在抓取时读取已打开的连接池的统计信息；连接池按需创建，
+// 还没有打开的连接池不输出。标签不使用连接串，而是使用它所属的工作区和数据源名称
+type dbStatsCollector struct{}
+
+func (dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range []*prometheus.Desc{dbMaxOpen, dbOpen, dbInUse, dbIdle, dbWaitCount, dbWaitDuration} {
+		ch <- desc
+	}
+}
+
+func (dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	names := config.GetWorkspaces().PoolNames()
+	for dsn, stats := range models.PoolStats() {
+		pool, ok := names[dsn]
+		if !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(stats.MaxOpenConnections), pool)
+		ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(stats.OpenConnections), pool)
+		ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(stats.InUse), pool)
+		ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(stats.Idle), pool)
+		ch <- prometheus.MustNewConstMetric(dbWaitCount, prometheus.CounterValue, float64(stats.WaitCount), pool)
+		ch <- prometheus.MustNewConstMetric(dbWaitDuration, prometheus.CounterValue, stats.WaitDuration.Seconds(), pool)
+	}
+}
@@ -0,0 +1,175 @@
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// namespace 所有指标名称的前缀
+const namespace = "d2t"
+
+// 流水线出错的阶段
+const (
+	StageGeneration = "generation"
+	StageValidation = "validation"
+	StageExecution  = "execution"
+	StageAnalysis   = "analysis"
+)
+
+// 大模型调用和SQL执行的结果标签
+const (
+	StatusSuccess = "success"
+	StatusError   = "error"
+	// StatusDenied SQL 未通过访问检查，没有执行
+	StatusDenied = "denied"
+)
+
+// registry 独立的注册表，只包含本服务的指标以及 Go 运行时和进程指标
+var registry = prometheus.NewRegistry()
+
+var (
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template and status code.",
+		Buckets:   []float64{0.01, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"method", "route", "status"})
+
+	llmDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "Latency of LLM provider calls by prompt mode.",
+		Buckets:   []float64{0.25, 0.5, 1, 2, 4, 8, 15, 30, 60, 120, 300},
+	}, []string{"provider", "model", "mode", "status"})
+
+	llmTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "LLM tokens reported by the provider, by prompt mode and token type (prompt or completion).",
+	}, []string{"provider", "model", "mode", "type"})
+
+	sqlDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sql_execution_duration_seconds",
+		Help:      "Latency of authorising and executing SQL statements against a data source.",
+		Buckets:   []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30},
+	}, []string{"source", "data_source", "status"})
+
+	sqlRows = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sql_rows_returned",
+		Help:      "Number of rows returned by successful SQL statements.",
+		Buckets:   []float64{0, 1, 10, 100, 1000, 10000, 100000},
+	}, []string{"source", "data_source"})
+
+	cacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "answer_cache_requests_total",
+		Help:      "Answer cache lookups by kind (sql or result) and outcome (hit or miss).",
+	}, []string{"kind", "outcome"})
+
+	structuredFallbacks = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_structured_output_fallbacks_total",
+		Help:      "LLM answers that failed structured output validation and were parsed as free text, by prompt mode.",
+	}, []string{"mode"})
+
+	candidateAgreement = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "sql_candidate_agreement_ratio",
+		Help:      "Share of SQL candidates whose results agree with the chosen one, by number of candidates generated.",
+		Buckets:   []float64{0.2, 0.4, 0.5, 0.6, 0.8, 1},
+	}, []string{"candidates"})
+
+	pipelineErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "pipeline_errors_total",
+		Help:      "Failures of the NL-to-SQL pipeline by stage (generation, validation, execution, analysis).",
+	}, []string{"stage"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpDuration,
+		llmDuration,
+		llmTokens,
+		sqlDuration,
+		sqlRows,
+		pipelineErrors,
+		cacheRequests,
+		structuredFallbacks,
+		candidateAgreement,
+		dbStatsCollector{},
+	)
+	// 预先创建各阶段的计数，没有出错时也输出 0
+	for _, stage := range []string{StageGeneration, StageValidation, StageExecution, StageAnalysis} {
+		pipelineErrors.WithLabelValues(stage)
+	}
+}
+
+// Handler 以 Prometheus 文本格式输出全部指标
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// ObserveHTTP 记录一次HTTP请求；route 为路由模板（如 /api/history/:id/execute），未匹配路由时为空
+func ObserveHTTP(method, route string, status int, duration time.Duration) {
+	if route == "" {
+		route = "unmatched"
+	}
+	httpDuration.WithLabelValues(method, route, strconv.Itoa(status)).Observe(duration.Seconds())
+}
+
+// ObserveLLMCall 记录一次大模型调用的耗时和服务商报告的 token 用量
+func ObserveLLMCall(provider, model, mode string, duration time.Duration, err error, promptTokens, completionTokens int64) {
+	status := StatusSuccess
+	if err != nil {
+		status = StatusError
+	}
+	llmDuration.WithLabelValues(provider, model, mode, status).Observe(duration.Seconds())
+	if promptTokens > 0 {
+		llmTokens.WithLabelValues(provider, model, mode, "prompt").Add(float64(promptTokens))
+	}
+	if completionTokens > 0 {
+		llmTokens.WithLabelValues(provider, model, mode, "completion").Add(float64(completionTokens))
+	}
+}
+
+// ObserveSQL 记录一条SQL的执行耗时；成功时同时记录返回行数
+func ObserveSQL(source, dataSource, status string, duration time.Duration, rows int) {
+	sqlDuration.WithLabelValues(source, dataSource, status).Observe(duration.Seconds())
+	if status == StatusSuccess {
+		sqlRows.WithLabelValues(source, dataSource).Observe(float64(rows))
+	}
+}
+
+// StructuredOutputFallback 记录一次结构化输出校验失败、退回从自由文本中提取的情况
+func StructuredOutputFallback(mode string) {
+	structuredFallbacks.WithLabelValues(mode).Inc()
+}
+
+// ObserveVoting 记录一次多候选投票中与选中SQL结果一致的候选比例
+func ObserveVoting(candidates int, agreement float64) {
+	candidateAgreement.WithLabelValues(strconv.Itoa(candidates)).Observe(agreement)
+}
+
+// PipelineError 记录流水线某个阶段的一次失败
+func PipelineError(stage string) {
+	pipelineErrors.WithLabelValues(stage).Inc()
+}
+
+// ObserveCache 记录一次问答缓存查找
+func ObserveCache(kind string, hit bool) {
+	outcome := "miss"
+	if hit {
+		outcome = "hit"
+	}
+	cacheRequests.WithLabelValues(kind, outcome).Inc()
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"d2t_server/internal/services"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// principalKey gin上下文中保存调用方的键
+const principalKey = "principal"
+
+// Authenticate 认证调用方并写入上下文：Bearer 凭证为JWT且配置了JWKS时按身份提供方令牌校验，
+// 否则作为 Authorization: Bearer <key> 或 X-API-Key 头中的API Key校验
+func Authenticate(cfg config.AuthConfig) gin.HandlerFunc {
+	keyService := services.NewAPIKeyService()
+
+	var jwtValidator *auth.JWTValidator
+	if cfg.JWT.Enabled() {
+		jwtValidator = auth.NewJWTValidator(cfg.JWT)
+	}
+
+	return func(c *gin.Context) {
+		if !cfg.Enabled {
+			c.Set(principalKey, &auth.Principal{
+				Type:   auth.PrincipalAnonymous,
+				ID:     "anonymous",
+				Name:   "anonymous",
+				Scopes: auth.AllScopes,
+			})
+			c.Next()
+			return
+		}
+
+		key := extractAPIKey(c.Request)
+		if key == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "missing credentials"})
+			return
+		}
+
+		if jwtValidator != nil && auth.LooksLikeJWT(key) {
+			principal, err := jwtValidator.Validate(key)
+			if err != nil {
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+				return
+			}
+			setPrincipal(c, principal)
+			return
+		}
+
+		// 引导用的管理员Key不入库，使用常量时间比较
+		if cfg.AdminAPIKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(cfg.AdminAPIKey)) == 1 {
+			c.Set(principalKey, &auth.Principal{
+				Type:     auth.PrincipalAPIKey,
+				ID:       "bootstrap",
+				Name:     "bootstrap admin",
+				Scopes:   auth.AllScopes,
+				Operator: true,
+			})
+			c.Next()
+			return
+		}
+
+		principal, err := keyService.Authenticate(key)
+		if errors.Is(err, services.ErrInvalidAPIKey) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"error": "authentication unavailable"})
+			return
+		}
+
+		setPrincipal(c, principal)
+	}
+}
+
+// setPrincipal 确认调用方所属的工作区已配置后写入上下文，否则返回 403
+func setPrincipal(c *gin.Context, principal *auth.Principal) {
+	if _, err := auth.ResolveWorkspace(principal); err != nil {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	c.Set(principalKey, principal)
+	c.Next()
+}
+
+// RequireScope 要求调用方拥有指定的访问范围
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !GetPrincipal(c).HasScope(scope) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "missing scope: " + scope})
+			return
+		}
+		c.Next()
+	}
+}
+
+// GetPrincipal 返回当前请求的调用方，未认证时为 nil
+func GetPrincipal(c *gin.Context) *auth.Principal {
+	value, ok := c.Get(principalKey)
+	if !ok {
+		return nil
+	}
+	principal, _ := value.(*auth.Principal)
+	return principal
+}
+
+// extractAPIKey 从请求头中读取API Key
+func extractAPIKey(r *http.Request) string {
+	if key := strings.TrimSpace(r.Header.Get("X-API-Key")); key != "" {
+		return key
+	}
+	authorization := r.Header.Get("Authorization")
+	if token, ok := strings.CutPrefix(authorization, "Bearer "); ok {
+		return strings.TrimSpace(token)
+	}
+	return ""
+}
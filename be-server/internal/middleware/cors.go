@@ -0,0 +1,157 @@
+package middleware
+
+import (
+	"d2t_server/internal/config"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// corsPolicy 预先解析好的跨域策略
+type corsPolicy struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   []originPattern
+	methods     map[string]bool
+	allowMethod string
+	anyHeader   bool
+	allowHeader string
+	expose      string
+	credentials bool
+	maxAge      string
+}
+
+// originPattern 通配子域名来源，https://*.example.com 拆成 scheme "https://" 和后缀 ".example.com"
+type originPattern struct {
+	scheme string
+	suffix string
+}
+
+func newCORSPolicy(p config.CORSPolicy) *corsPolicy {
+	policy := &corsPolicy{
+		origins:     make(map[string]bool),
+		methods:     make(map[string]bool),
+		allowMethod: strings.ToUpper(strings.Join(p.AllowedMethods, ", ")),
+		allowHeader: strings.Join(p.AllowedHeaders, ", "),
+		expose:      strings.Join(p.ExposedHeaders, ", "),
+		credentials: p.AllowCredentials,
+		maxAge:      strconv.Itoa(int(p.MaxAge.Seconds())),
+	}
+	for _, origin := range p.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSuffix(origin, "/"))
+		switch {
+		case origin == config.AnyOrigin:
+			policy.anyOrigin = true
+		case strings.Contains(origin, "://*."):
+			i := strings.Index(origin, "://*.")
+			policy.wildcards = append(policy.wildcards, originPattern{scheme: origin[:i+3], suffix: origin[i+4:]})
+		default:
+			policy.origins[origin] = true
+		}
+	}
+	for _, method := range p.AllowedMethods {
+		policy.methods[strings.ToUpper(method)] = true
+	}
+	for _, header := range p.AllowedHeaders {
+		if header == "*" {
+			policy.anyHeader = true
+		}
+	}
+	// 凭据不能与任意来源同时使用
+	if policy.anyOrigin {
+		policy.credentials = false
+	}
+	return policy
+}
+
+// allowsOrigin 来源是否在允许列表中；通配只匹配子域名，不匹配裸域名本身
+func (p *corsPolicy) allowsOrigin(origin string) bool {
+	if p.anyOrigin {
+		return true
+	}
+	origin = strings.ToLower(origin)
+	if p.origins[origin] {
+		return true
+	}
+	for _, w := range p.wildcards {
+		host := strings.TrimPrefix(origin, w.scheme)
+		if len(host) < len(origin) && len(host) > len(w.suffix) && strings.HasSuffix(host, w.suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// CORS 按请求路径选择跨域策略：来源不被允许时不返回任何跨域响应头，预检请求直接返回 403；
+// 只有配置了具体来源时才回显 Origin 并允许携带凭据
+func CORS(cfg config.CORSConfig) gin.HandlerFunc {
+	defaultPolicy := newCORSPolicy(cfg.Default)
+	routePolicies := make(map[string]*corsPolicy, len(cfg.Routes))
+	for _, route := range cfg.Routes {
+		routePolicies[route.Path] = newCORSPolicy(route.Policy)
+	}
+
+	return func(c *gin.Context) {
+		origin := c.GetHeader("Origin")
+		preflight := c.Request.Method == http.MethodOptions && c.GetHeader("Access-Control-Request-Method") != ""
+		if origin == "" {
+			c.Next()
+			return
+		}
+
+		policy := defaultPolicy
+		if route := cfg.MatchRoute(c.Request.URL.Path); route != nil {
+			policy = routePolicies[route.Path]
+		}
+
+		header := c.Writer.Header()
+		header.Add("Vary", "Origin")
+		if preflight {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if !policy.allowsOrigin(origin) {
+			if preflight {
+				c.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			c.Next()
+			return
+		}
+
+		if policy.anyOrigin {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if policy.credentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			if policy.expose != "" {
+				header.Set("Access-Control-Expose-Headers", policy.expose)
+			}
+			c.Next()
+			return
+		}
+
+		if !policy.methods[strings.ToUpper(c.GetHeader("Access-Control-Request-Method"))] {
+			c.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		header.Set("Access-Control-Allow-Methods", policy.allowMethod)
+		if policy.anyHeader {
+			header.Set("Access-Control-Allow-Headers", c.GetHeader("Access-Control-Request-Headers"))
+		} else if policy.allowHeader != "" {
+			header.Set("Access-Control-Allow-Headers", policy.allowHeader)
+		}
+		if policy.maxAge != "0" {
+			header.Set("Access-Control-Max-Age", policy.maxAge)
+		}
+		c.AbortWithStatus(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,17 @@
+package middleware
+
+import (
+	"d2t_server/internal/metrics"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HTTPMetrics 按路由模板记录请求耗时和状态码，不使用实际路径以免路径参数造成标签膨胀
+func HTTPMetrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+		metrics.ObserveHTTP(c.Request.Method, c.FullPath(), c.Writer.Status(), time.Since(start))
+	}
+}
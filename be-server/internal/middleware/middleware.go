@@ -1,30 +1,50 @@
 package middleware
 
 import (
+	"d2t_server/internal/config"
+	"log/slog"
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 // RegisterMiddleware 注册所有中间件
-func RegisterMiddleware(r *gin.Engine) {
-	// 添加跨域中间件
-	r.Use(CORSMiddleware())
+func RegisterMiddleware(r *gin.Engine, cfg *config.Config) {
+	TrustProxies(r, cfg.Server.TrustedProxies)
+
+	// 每个请求一个根 span（沿用上游传入的 traceparent），健康检查和指标抓取不追踪
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithFilter(traced)))
+
+	// 添加跨域中间件，按路径选择跨域策略
+	r.Use(CORS(cfg.CORS))
+
+	// 请求ID
+	r.Use(RequestID())
+
+	// 结构化访问日志和 panic 恢复，放在请求ID之后以便日志带上请求ID
+	r.Use(AccessLog())
+	r.Use(HTTPMetrics())
+	r.Use(gin.CustomRecovery(recoverPanic))
 
 	// 其他中间件可以在这里添加
 }
 
-// CORSMiddleware 处理跨域请求的中间件
-func CORSMiddleware() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
-		}
+// TrustProxies 设置可信的反向代理。客户端 IP 用于匿名调用方的限流和访问日志，
+// 只采用可信代理转发的 X-Forwarded-For，否则客户端可以伪造该请求头换一个新的令牌桶；
+// 没有配置或配置无效时使用连接的对端地址
+func TrustProxies(r *gin.Engine, proxies []string) {
+	if err := r.SetTrustedProxies(proxies); err != nil {
+		slog.Error("invalid TRUSTED_PROXIES, trusting no proxy", "error", err)
+		r.SetTrustedProxies(nil)
+	}
+}
 
-		c.Next()
+// traced 请求是否需要追踪
+func traced(r *http.Request) bool {
+	switch r.URL.Path {
+	case "/health", "/livez", "/readyz", "/ping", "/metrics":
+		return false
 	}
+	return true
 }
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"d2t_server/internal/auth"
+	"d2t_server/internal/ratelimit"
+	"d2t_server/utils"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// usageMeterKey gin上下文中保存本次请求大模型用量计量器的键
+const usageMeterKey = "usage_meter"
+
+// RateLimit 按调用方（API Key / 用户 / 匿名时的IP）做令牌桶限流，超出时返回 429；
+// 限流存储不可用时放行，避免因限流故障导致服务不可用
+func RateLimit(limiter ratelimit.Limiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if limiter == nil {
+			c.Next()
+			return
+		}
+
+		decision, err := limiter.Allow(rateLimitSubject(c))
+		if err != nil {
+			slog.WarnContext(c.Request.Context(), "rate limiter unavailable", "error", err)
+			c.Next()
+			return
+		}
+
+		c.Header("X-RateLimit-Limit", strconv.Itoa(decision.Limit))
+		c.Header("X-RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+		if !decision.Allowed {
+			tooManyRequests(c, decision.RetryAfter, "rate limit exceeded")
+			return
+		}
+		c.Next()
+	}
+}
+
+// TokenBudget 检查调用方每天/每月的大模型 token 预算，用尽时返回 429；
+// 放行后把本次请求实际消耗的 token（来自服务商响应中的 usage）计入预算。
+// 响应头中的剩余额度为本次请求开始前的值。
+func TokenBudget(budget *ratelimit.Budget) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		enforceBudget(c, budget, rateLimitSubject(c), "X-Token-Budget", "token budget exhausted")
+	}
+}
+
+// WorkspaceTokenBudget 检查调用方所属工作区整体每天/每月的 token 预算（工作区配置的 daily_tokens / monthly_tokens），
+// 与 TokenBudget 共用同一个用量计量器
+func WorkspaceTokenBudget(store ratelimit.BudgetStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var budget *ratelimit.Budget
+		principal := GetPrincipal(c)
+		if ws, err := auth.ResolveWorkspace(principal); err == nil {
+			budget = ratelimit.NewLimitedBudget(store, ws.DailyTokens, ws.MonthlyTokens)
+		}
+		enforceBudget(c, budget, "workspace:"+principal.WorkspaceName(), "X-Workspace-Budget", "workspace token budget exhausted")
+	}
+}
+
+// enforceBudget 检查预算并在请求结束后记录用量，header 为剩余额度响应头的前缀
+func enforceBudget(c *gin.Context, budget *ratelimit.Budget, subject, header, message string) {
+	meter := GetUsageMeter(c)
+	if meter == nil {
+		meter = &utils.UsageMeter{}
+		c.Set(usageMeterKey, meter)
+	}
+	if budget == nil {
+		c.Next()
+		return
+	}
+
+	status, err := budget.Check(subject)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "token budget unavailable", "subject", subject, "error", err)
+		c.Next()
+		return
+	}
+
+	if status.DailyRemaining != ratelimit.Unlimited {
+		c.Header(header+"-Daily-Remaining", strconv.FormatInt(status.DailyRemaining, 10))
+	}
+	if status.MonthlyRemaining != ratelimit.Unlimited {
+		c.Header(header+"-Monthly-Remaining", strconv.FormatInt(status.MonthlyRemaining, 10))
+	}
+	if status.Exceeded {
+		tooManyRequests(c, status.RetryAfter, message)
+		return
+	}
+
+	c.Next()
+
+	if err := budget.Record(subject, meter.Total().TotalTokens); err != nil {
+		slog.WarnContext(c.Request.Context(), "failed to record token usage", "subject", subject, "error", err)
+	}
+}
+
+// GetUsageMeter 返回当前请求的大模型用量计量器，未经过预算中间件时为 nil
+func GetUsageMeter(c *gin.Context) *utils.UsageMeter {
+	value, ok := c.Get(usageMeterKey)
+	if !ok {
+		return nil
+	}
+	meter, _ := value.(*utils.UsageMeter)
+	return meter
+}
+
+// rateLimitSubject 限流和预算的计量对象，已认证的调用方按工作区区分
+func rateLimitSubject(c *gin.Context) string {
+	principal := GetPrincipal(c)
+	if principal == nil || principal.Type == auth.PrincipalAnonymous {
+		return "ip:" + c.ClientIP()
+	}
+	return principal.WorkspaceName() + "/" + principal.Type + ":" + principal.ID
+}
+
+func tooManyRequests(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+		"error":       message,
+		"retry_after": seconds,
+	})
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/internal/ratelimit"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRateLimitedRouter allows one anonymous request per caller
+func newRateLimitedRouter(proxies []string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	TrustProxies(r, proxies)
+	limiter := ratelimit.NewLimiter(config.RateLimitConfig{Backend: "memory", RequestsPerMinute: 1, Burst: 1})
+	r.GET("/api/ping", RateLimit(limiter), func(c *gin.Context) { c.String(http.StatusOK, "pong") })
+	return r
+}
+
+func get(r *gin.Engine, remoteAddr, forwardedFor string) int {
+	req := httptest.NewRequest(http.MethodGet, "/api/ping", nil)
+	req.RemoteAddr = remoteAddr
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w.Code
+}
+
+func TestRateLimitIgnoresSpoofedForwardedFor(t *testing.T) {
+	r := newRateLimitedRouter(nil)
+
+	if code := get(r, "203.0.113.7:40000", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request: status %d", code)
+	}
+	// a new X-Forwarded-For from the same peer must not get a fresh bucket
+	if code := get(r, "203.0.113.7:40001", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("spoofed X-Forwarded-For: status %d, want 429", code)
+	}
+	if code := get(r, "203.0.113.8:40000", ""); code != http.StatusOK {
+		t.Fatalf("other peer: status %d", code)
+	}
+}
+
+func TestRateLimitTrustedProxy(t *testing.T) {
+	r := newRateLimitedRouter([]string{"10.0.0.0/8"})
+
+	// behind a trusted proxy each forwarded client has its own bucket
+	if code := get(r, "10.0.0.5:40000", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first client: status %d", code)
+	}
+	if code := get(r, "10.0.0.5:40001", "198.51.100.2"); code != http.StatusOK {
+		t.Fatalf("second client: status %d", code)
+	}
+	if code := get(r, "10.0.0.5:40002", "198.51.100.1"); code != http.StatusTooManyRequests {
+		t.Fatalf("repeated client: status %d, want 429", code)
+	}
+}
+
+func TestTrustProxiesInvalid(t *testing.T) {
+	r := newRateLimitedRouter([]string{"not-an-ip"})
+
+	if code := get(r, "203.0.113.7:40000", "198.51.100.1"); code != http.StatusOK {
+		t.Fatalf("first request: status %d", code)
+	}
+	if code := get(r, "203.0.113.7:40001", "198.51.100.2"); code != http.StatusTooManyRequests {
+		t.Fatalf("invalid TRUSTED_PROXIES must trust no proxy: status %d, want 429", code)
+	}
+}
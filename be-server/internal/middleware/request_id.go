@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"d2t_server/internal/requestid"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// RequestID 为每个请求分配请求ID：沿用客户端传入的 X-Request-ID，否则生成新的；
+// 请求ID写入响应头、请求上下文和当前 span，供审计日志等使用
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := requestid.Sanitize(c.GetHeader(requestid.Header))
+		if id == "" {
+			id = requestid.New()
+		}
+		c.Header(requestid.Header, id)
+		trace.SpanFromContext(c.Request.Context()).SetAttributes(attribute.String("d2t.request_id", id))
+		c.Request = c.Request.WithContext(requestid.NewContext(c.Request.Context(), id))
+		c.Next()
+	}
+}
@@ -0,0 +1,67 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AnswerCacheEntry 问答缓存中的一条记录，Value 为 JSON
+type AnswerCacheEntry struct {
+	Key        string
+	Kind       string
+	Workspace  string
+	DataSource string
+	Question   string
+	Value      []byte
+	ExpiresAt  time.Time
+}
+
+// GetAnswerCache 返回未过期的缓存值，不存在时为 nil
+func GetAnswerCache(db *sql.DB, key string) ([]byte, error) {
+	var value []byte
+	err := db.QueryRow(`SELECT value FROM d2t_answer_cache WHERE cache_key = $1 AND expires_at > NOW()`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询问答缓存失败: %w", err)
+	}
+	return value, nil
+}
+
+// PutAnswerCache 写入或覆盖一条缓存
+func PutAnswerCache(db *sql.DB, e AnswerCacheEntry) error {
+	_, err := db.Exec(
+		`INSERT INTO d2t_answer_cache (cache_key, kind, workspace, data_source, question, value, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 ON CONFLICT (cache_key) DO UPDATE SET value = EXCLUDED.value, expires_at = EXCLUDED.expires_at, created_at = NOW()`,
+		e.Key, e.Kind, e.Workspace, e.DataSource, e.Question, e.Value, e.ExpiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("写入问答缓存失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteAnswerCache 删除缓存；workspace 为空表示全部工作区，dataSource、question 为空表示不限
+func DeleteAnswerCache(db *sql.DB, workspace, dataSource, question string) (int64, error) {
+	res, err := db.Exec(
+		`DELETE FROM d2t_answer_cache
+		 WHERE ($1::text = '' OR workspace = $1) AND ($2::text = '' OR data_source = $2) AND ($3::text = '' OR question = $3)`,
+		workspace, dataSource, question,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("删除问答缓存失败: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// DeleteExpiredAnswerCache 删除已过期的缓存
+func DeleteExpiredAnswerCache(db *sql.DB) error {
+	if _, err := db.Exec(`DELETE FROM d2t_answer_cache WHERE expires_at <= NOW()`); err != nil {
+		return fmt.Errorf("清理过期问答缓存失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey 数据库中保存的API Key（只有摘要，没有明文）
+type APIKey struct {
+	ID         int64      `json:"id"`
+	Workspace  string     `json:"workspace"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	KeyHash    string     `json:"-"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+const apiKeyColumns = `id, workspace, name, prefix, key_hash, scopes, created_at, last_used_at, revoked_at`
+
+func scanAPIKey(row interface{ Scan(...interface{}) error }) (*APIKey, error) {
+	var k APIKey
+	var lastUsed, revoked sql.NullTime
+	if err := row.Scan(&k.ID, &k.Workspace, &k.Name, &k.Prefix, &k.KeyHash, pq.Array(&k.Scopes), &k.CreatedAt, &lastUsed, &revoked); err != nil {
+		return nil, err
+	}
+	if lastUsed.Valid {
+		k.LastUsedAt = &lastUsed.Time
+	}
+	if revoked.Valid {
+		k.RevokedAt = &revoked.Time
+	}
+	return &k, nil
+}
+
+// InsertAPIKey 写入一个新的API Key
+func InsertAPIKey(db *sql.DB, k *APIKey) error {
+	err := db.QueryRow(
+		`INSERT INTO d2t_api_keys (workspace, name, prefix, key_hash, scopes)
+		 VALUES ($1, $2, $3, $4, $5)
+		 RETURNING id, created_at`,
+		k.Workspace, k.Name, k.Prefix, k.KeyHash, pq.Array(k.Scopes),
+	).Scan(&k.ID, &k.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("写入API Key失败: %w", err)
+	}
+	return nil
+}
+
+// FindActiveAPIKeyByHash 按摘要查找未吊销的API Key，不存在时返回 nil
+func FindActiveAPIKeyByHash(db *sql.DB, hash string) (*APIKey, error) {
+	k, err := scanAPIKey(db.QueryRow(
+		`SELECT `+apiKeyColumns+` FROM d2t_api_keys WHERE key_hash = $1 AND revoked_at IS NULL`, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("查询API Key失败: %w", err)
+	}
+	return k, nil
+}
+
+// ListAPIKeys 列出工作区的API Key，workspace 为空时列出全部
+func ListAPIKeys(db *sql.DB, workspace string) ([]APIKey, error) {
+	rows, err := db.Query(`SELECT `+apiKeyColumns+` FROM d2t_api_keys WHERE $1::text = '' OR workspace = $1 ORDER BY id`, workspace)
+	if err != nil {
+		return nil, fmt.Errorf("查询API Key失败: %w", err)
+	}
+	defer rows.Close()
+
+	var keys []APIKey
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("扫描API Key失败: %w", err)
+		}
+		keys = append(keys, *k)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历API Key失败: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey 吊销工作区的一个API Key（workspace 为空时不限工作区），返回是否存在且此前未被吊销
+func RevokeAPIKey(db *sql.DB, workspace string, id int64) (bool, error) {
+	res, err := db.Exec(`UPDATE d2t_api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND ($2::text = '' OR workspace = $2) AND revoked_at IS NULL`, id, workspace)
+	if err != nil {
+		return false, fmt.Errorf("吊销API Key失败: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("吊销API Key失败: %w", err)
+	}
+	return n > 0, nil
+}
+
+// TouchAPIKey 更新API Key的最近使用时间
+func TouchAPIKey(db *sql.DB, id int64) error {
+	if _, err := db.Exec(`UPDATE d2t_api_keys SET last_used_at = NOW() WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("更新API Key使用时间失败: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+)
+
+// appSchemaStatements 应用自身使用的表（与业务数据表共用同一个数据库）
+var appSchemaStatements = []string{
+	`CREATE TABLE IF NOT EXISTS d2t_examples (
+		id          BIGSERIAL PRIMARY KEY,
+		data_source TEXT        NOT NULL,
+		question    TEXT        NOT NULL,
+		sql_text    TEXT        NOT NULL,
+		source      TEXT        NOT NULL DEFAULT 'manual',
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (data_source, question)
+	)`,
+	`CREATE TABLE IF NOT EXISTS d2t_query_history (
+		id          BIGSERIAL PRIMARY KEY,
+		data_source TEXT        NOT NULL,
+		question    TEXT        NOT NULL,
+		sql_text    TEXT        NOT NULL DEFAULT '',
+		status      TEXT        NOT NULL,
+		error       TEXT        NOT NULL DEFAULT '',
+		row_count   INTEGER     NOT NULL DEFAULT 0,
+		duration_ms BIGINT      NOT NULL DEFAULT 0,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS d2t_feedback (
+		id            BIGSERIAL PRIMARY KEY,
+		history_id    BIGINT      NOT NULL REFERENCES d2t_query_history (id) ON DELETE CASCADE,
+		rating        TEXT        NOT NULL,
+		corrected_sql TEXT        NOT NULL DEFAULT '',
+		comment       TEXT        NOT NULL DEFAULT '',
+		promoted      BOOLEAN     NOT NULL DEFAULT FALSE,
+		created_at    TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_d2t_feedback_history ON d2t_feedback (history_id)`,
+	`ALTER TABLE d2t_query_history ADD COLUMN IF NOT EXISTS prompt_version TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS d2t_api_keys (
+		id           BIGSERIAL PRIMARY KEY,
+		name         TEXT        NOT NULL,
+		prefix       TEXT        NOT NULL,
+		key_hash     TEXT        NOT NULL UNIQUE,
+		scopes       TEXT[]      NOT NULL,
+		created_at   TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ,
+		revoked_at   TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS d2t_rate_limits (
+		bucket_key TEXT             PRIMARY KEY,
+		tokens     DOUBLE PRECISION NOT NULL,
+		allowed    BOOLEAN          NOT NULL,
+		updated_at TIMESTAMPTZ      NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE TABLE IF NOT EXISTS d2t_token_usage (
+		subject    TEXT   NOT NULL,
+		period     TEXT   NOT NULL,
+		tokens     BIGINT NOT NULL DEFAULT 0,
+		PRIMARY KEY (subject, period)
+	)`,
+	`CREATE TABLE IF NOT EXISTS d2t_audit_log (
+		id             BIGSERIAL PRIMARY KEY,
+		created_at     TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		request_id     TEXT        NOT NULL DEFAULT '',
+		principal_type TEXT        NOT NULL DEFAULT '',
+		principal_id   TEXT        NOT NULL DEFAULT '',
+		principal_name TEXT        NOT NULL DEFAULT '',
+		data_source    TEXT        NOT NULL,
+		source         TEXT        NOT NULL,
+		sql_text       TEXT        NOT NULL,
+		params         JSONB       NOT NULL DEFAULT '[]',
+		row_count      INTEGER     NOT NULL DEFAULT 0,
+		duration_ms    BIGINT      NOT NULL DEFAULT 0,
+		status         TEXT        NOT NULL,
+		error          TEXT        NOT NULL DEFAULT ''
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_d2t_audit_log_created ON d2t_audit_log (created_at)`,
+	`CREATE INDEX IF NOT EXISTS idx_d2t_audit_log_principal ON d2t_audit_log (principal_id, created_at)`,
+	// 审计日志只允许追加：拒绝对已有记录的修改、删除和清空
+	`CREATE OR REPLACE FUNCTION d2t_audit_log_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'd2t_audit_log is append-only';
+	END;
+	$$ LANGUAGE plpgsql`,
+	`CREATE OR REPLACE TRIGGER d2t_audit_log_no_update
+		BEFORE UPDATE OR DELETE ON d2t_audit_log
+		FOR EACH ROW EXECUTE FUNCTION d2t_audit_log_append_only()`,
+	`CREATE OR REPLACE TRIGGER d2t_audit_log_no_truncate
+		BEFORE TRUNCATE ON d2t_audit_log
+		FOR EACH STATEMENT EXECUTE FUNCTION d2t_audit_log_append_only()`,
+	// 多工作区：已有数据归入 default 工作区，示例的唯一约束改为在工作区内唯一
+	`ALTER TABLE d2t_api_keys ADD COLUMN IF NOT EXISTS workspace TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE d2t_examples ADD COLUMN IF NOT EXISTS workspace TEXT NOT NULL DEFAULT 'default'`,
+	`ALTER TABLE d2t_examples DROP CONSTRAINT IF EXISTS d2t_examples_data_source_question_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_d2t_examples_workspace_question ON d2t_examples (workspace, data_source, question)`,
+	`ALTER TABLE d2t_query_history ADD COLUMN IF NOT EXISTS workspace TEXT NOT NULL DEFAULT 'default'`,
+	`CREATE INDEX IF NOT EXISTS idx_d2t_query_history_workspace ON d2t_query_history (workspace, created_at)`,
+	`ALTER TABLE d2t_audit_log ADD COLUMN IF NOT EXISTS workspace TEXT NOT NULL DEFAULT 'default'`,
+	`CREATE INDEX IF NOT EXISTS idx_d2t_audit_log_workspace ON d2t_audit_log (workspace, created_at)`,
+	`CREATE TABLE IF NOT EXISTS d2t_answer_cache (
+		cache_key   TEXT        PRIMARY KEY,
+		kind        TEXT        NOT NULL,
+		workspace   TEXT        NOT NULL,
+		data_source TEXT        NOT NULL,
+		question    TEXT        NOT NULL,
+		value       JSONB       NOT NULL,
+		expires_at  TIMESTAMPTZ NOT NULL,
+		created_at  TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE INDEX IF NOT EXISTS idx_d2t_answer_cache_scope ON d2t_answer_cache (workspace, data_source, question)`,
+	`CREATE INDEX IF NOT EXISTS idx_d2t_answer_cache_expires ON d2t_answer_cache (expires_at)`,
+	`ALTER TABLE d2t_query_history ADD COLUMN IF NOT EXISTS clarification JSONB`,
+	`ALTER TABLE d2t_query_history ADD COLUMN IF NOT EXISTS parent_id BIGINT REFERENCES d2t_query_history (id) ON DELETE SET NULL`,
+}
+
+var (
+	appSchemaReady bool
+	appSchemaMu    sync.Mutex
+)
+
+// GetAppDB 返回应用库连接，并确保应用表已创建
+func GetAppDB() (*sql.DB, error) {
+	db, err := GetPGDBConnection()
+	if err != nil {
+		return nil, err
+	}
+
+	appSchemaMu.Lock()
+	defer appSchemaMu.Unlock()
+
+	if !appSchemaReady {
+		if err := MigrateAppSchema(db); err != nil {
+			return nil, err
+		}
+		appSchemaReady = true
+	}
+	return db, nil
+}
+
+// MigrateAppSchema 创建应用所需的表，可重复执行
+func MigrateAppSchema(db *sql.DB) error {
+	for _, stmt := range appSchemaStatements {
+		if _, err := db.Exec(stmt); err != nil {
+			return fmt.Errorf("初始化应用表失败: %w", err)
+		}
+	}
+	return nil
+}
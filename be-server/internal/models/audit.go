@@ -0,0 +1,168 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// 审计记录的执行结果
+const (
+	AuditStatusSuccess = "success"
+	AuditStatusError   = "error"
+	AuditStatusDenied  = "denied"
+	// AuditStatusCached 结果取自问答缓存，没有执行SQL
+	AuditStatusCached = "cached"
+)
+
+// 审计记录的执行来源
+const (
+	AuditSourceAsk     = "ask"
+	AuditSourceHistory = "history"
+	AuditSourceMetric  = "metric"
+	// AuditSourceCandidate 多候选生成时为投票执行的候选SQL
+	AuditSourceCandidate = "candidate"
+)
+
+// AuditEntry 一次SQL执行的审计记录
+type AuditEntry struct {
+	ID            int64         `json:"id"`
+	CreatedAt     time.Time     `json:"created_at"`
+	Workspace     string        `json:"workspace"`
+	RequestID     string        `json:"request_id"`
+	PrincipalType string        `json:"principal_type"`
+	PrincipalID   string        `json:"principal_id"`
+	PrincipalName string        `json:"principal_name"`
+	DataSource    string        `json:"data_source"`
+	Source        string        `json:"source"`
+	SQL           string        `json:"sql"`
+	Params        []interface{} `json:"params"`
+	RowCount      int           `json:"row_count"`
+	DurationMs    int64         `json:"duration_ms"`
+	Status        string        `json:"status"`
+	Error         string        `json:"error,omitempty"`
+}
+
+// AuditFilter 审计记录查询条件，零值字段不参与过滤
+type AuditFilter struct {
+	Workspace   string
+	PrincipalID string
+	DataSource  string
+	Source      string
+	Status      string
+	RequestID   string
+	Since       time.Time
+	Until       time.Time
+	// BeforeID 用于分页：只返回ID小于该值的记录
+	BeforeID int64
+	Limit    int
+}
+
+// InsertAuditEntry 追加一条审计记录
+func InsertAuditEntry(db *sql.DB, e *AuditEntry) error {
+	params := e.Params
+	if params == nil {
+		params = []interface{}{}
+	}
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("序列化审计参数失败: %w", err)
+	}
+
+	err = db.QueryRow(
+		`INSERT INTO d2t_audit_log (workspace, request_id, principal_type, principal_id, principal_name, data_source, source,
+			sql_text, params, row_count, duration_ms, status, error)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+		 RETURNING id, created_at`,
+		e.Workspace, e.RequestID, e.PrincipalType, e.PrincipalID, e.PrincipalName, e.DataSource, e.Source,
+		e.SQL, string(paramsJSON), e.RowCount, e.DurationMs, e.Status, e.Error,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("写入审计日志失败: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEntries 按条件倒序返回审计记录
+func ListAuditEntries(db *sql.DB, filter AuditFilter) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	err := StreamAuditEntries(db, filter, func(e *AuditEntry) error {
+		entries = append(entries, *e)
+		return nil
+	})
+	return entries, err
+}
+
+// StreamAuditEntries 按条件倒序逐条读取审计记录，用于导出大量数据而不占用内存
+func StreamAuditEntries(db *sql.DB, filter AuditFilter, fn func(*AuditEntry) error) error {
+	var where []string
+	var args []interface{}
+	add := func(clause string, value interface{}) {
+		args = append(args, value)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+	if filter.Workspace != "" {
+		add("workspace = $%d", filter.Workspace)
+	}
+	if filter.PrincipalID != "" {
+		add("principal_id = $%d", filter.PrincipalID)
+	}
+	if filter.DataSource != "" {
+		add("data_source = $%d", filter.DataSource)
+	}
+	if filter.Source != "" {
+		add("source = $%d", filter.Source)
+	}
+	if filter.Status != "" {
+		add("status = $%d", filter.Status)
+	}
+	if filter.RequestID != "" {
+		add("request_id = $%d", filter.RequestID)
+	}
+	if !filter.Since.IsZero() {
+		add("created_at >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		add("created_at < $%d", filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		add("id < $%d", filter.BeforeID)
+	}
+
+	query := `SELECT id, created_at, workspace, request_id, principal_type, principal_id, principal_name, data_source, source,
+		sql_text, params, row_count, duration_ms, status, error FROM d2t_audit_log`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("查询审计日志失败: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e AuditEntry
+		var params []byte
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Workspace, &e.RequestID, &e.PrincipalType, &e.PrincipalID, &e.PrincipalName,
+			&e.DataSource, &e.Source, &e.SQL, &params, &e.RowCount, &e.DurationMs, &e.Status, &e.Error); err != nil {
+			return fmt.Errorf("读取审计日志失败: %w", err)
+		}
+		if err := json.Unmarshal(params, &e.Params); err != nil {
+			return fmt.Errorf("解析审计参数失败: %w", err)
+		}
+		if err := fn(&e); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("读取审计日志失败: %w", err)
+	}
+	return nil
+}
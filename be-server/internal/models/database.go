@@ -1,16 +1,64 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
+	"sync"
 	"time"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 )
 
-// GetPGDBConnection 创建并返回一个PostgreSQL数据库连接
+var (
+	sharedDB   *sql.DB
+	sharedDBMu sync.Mutex
+
+	// dataSourceDBs 工作区数据源的连接池，按连接串缓存
+	dataSourceDBs = make(map[string]*sql.DB)
+)
+
+// GetPGDBConnection 返回共享的PostgreSQL连接池，首次调用时创建
 func GetPGDBConnection() (*sql.DB, error) {
+	sharedDBMu.Lock()
+	defer sharedDBMu.Unlock()
+
+	if sharedDB != nil {
+		return sharedDB, nil
+	}
+
+	db, err := openPGDBConnection()
+	if err != nil {
+		return nil, err
+	}
+	sharedDB = db
+	return sharedDB, nil
+}
+
+// GetDataSourceDB 返回数据源的连接池，dsn 为空时为共享数据库，其余按连接串缓存
+func GetDataSourceDB(dsn string) (*sql.DB, error) {
+	if dsn == "" {
+		return GetPGDBConnection()
+	}
+
+	sharedDBMu.Lock()
+	defer sharedDBMu.Unlock()
+
+	if db, ok := dataSourceDBs[dsn]; ok {
+		return db, nil
+	}
+	db, err := openDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+	dataSourceDBs[dsn] = db
+	return db, nil
+}
+
+// openPGDBConnection 创建一个新的PostgreSQL数据库连接
+func openPGDBConnection() (*sql.DB, error) {
 	// 从环境变量获取数据库连接信息
 	dbUser := os.Getenv("DB_USER")
 	dbPassword := os.Getenv("DB_PASSWORD")
@@ -27,6 +75,11 @@ func GetPGDBConnection() (*sql.DB, error) {
 	connStr := fmt.Sprintf("host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
 		dbHost, dbPort, dbUser, dbPassword, dbName)
 
+	return openDSN(connStr)
+}
+
+// openDSN 按连接串打开连接池并测试连接
+func openDSN(connStr string) (*sql.DB, error) {
 	// 打开数据库连接
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
@@ -41,15 +94,26 @@ func GetPGDBConnection() (*sql.DB, error) {
 	// 测试连接
 	err = db.Ping()
 	if err != nil {
+		db.Close()
 		return nil, fmt.Errorf("无法ping数据库: %w", err)
 	}
 
 	return db, nil
 }
 
-// ExecuteSQL 执行SQL语句并返回结果
-func ExecuteSQL(db *sql.DB, sqlQuery string) ([]map[string]interface{}, error) {
-	rows, err := db.Query(sqlQuery)
+// Queryer 可以执行查询的对象，*sql.DB 和 *sql.Tx 都满足
+type Queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// ExecuteSQL 执行SQL语句并返回结果，args 为可选的位置参数
+func ExecuteSQL(db Queryer, sqlQuery string, args ...interface{}) ([]map[string]interface{}, error) {
+	return queryRows(db, 0, sqlQuery, args...)
+}
+
+// queryRows 执行查询并读取结果，maxRows > 0 时最多读取 maxRows+1 行，调用方据此判断结果是否被截断
+func queryRows(db Queryer, maxRows int, sqlQuery string, args ...interface{}) ([]map[string]interface{}, error) {
+	rows, err := db.Query(sqlQuery, args...)
 	if err != nil {
 		return nil, fmt.Errorf("执行SQL错误: %w", err)
 	}
@@ -73,6 +137,9 @@ func ExecuteSQL(db *sql.DB, sqlQuery string) ([]map[string]interface{}, error) {
 
 	// 遍历结果集
 	for rows.Next() {
+		if maxRows > 0 && len(results) > maxRows {
+			break
+		}
 		// 扫描行数据到值容器
 		err := rows.Scan(valuePtrs...)
 		if err != nil {
@@ -101,3 +168,94 @@ func ExecuteSQL(db *sql.DB, sqlQuery string) ([]map[string]interface{}, error) {
 
 	return results, nil
 }
+
+// ExecLimits 执行不受信任的查询时的限制
+type ExecLimits struct {
+	// Timeout 语句超时，0 表示不限制
+	Timeout time.Duration
+	// MaxRows 最多返回 MaxRows+1 行，多出的一行表示结果被截断；0 表示不限制
+	MaxRows int
+}
+
+// ExecuteSQLLimited 在只读事务中按限制执行SQL，执行后回滚；role 不为空时切换到该数据库角色并设置会话变量，
+// 角色和变量只在该事务内生效（SET LOCAL），连接归还连接池时自动恢复
+func ExecuteSQLLimited(db *sql.DB, role string, settings map[string]string, limits ExecLimits, sqlQuery string, args ...interface{}) ([]map[string]interface{}, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("SET TRANSACTION READ ONLY"); err != nil {
+		return nil, fmt.Errorf("设置只读事务失败: %w", err)
+	}
+	if limits.Timeout > 0 {
+		if _, err := tx.Exec(fmt.Sprintf("SET LOCAL statement_timeout = %d", limits.Timeout.Milliseconds())); err != nil {
+			return nil, fmt.Errorf("设置语句超时失败: %w", err)
+		}
+	}
+	if role != "" {
+		if _, err := tx.Exec("SET LOCAL ROLE " + pq.QuoteIdentifier(role)); err != nil {
+			return nil, fmt.Errorf("切换数据库角色失败: %w", err)
+		}
+		for name, value := range settings {
+			if _, err := tx.Exec("SELECT set_config($1, $2, true)", name, value); err != nil {
+				return nil, fmt.Errorf("设置会话变量失败: %w", err)
+			}
+		}
+	}
+
+	return queryRows(tx, limits.MaxRows, sqlQuery, args...)
+}
+
+// ApplyStatements 在一个事务中依次执行DDL语句
+func ApplyStatements(db *sql.DB, stmts []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("开启事务失败: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("执行语句失败: %w", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// PoolStats 返回已打开的连接池的统计信息，共享数据库的键为空串，其余按连接串
+func PoolStats() map[string]sql.DBStats {
+	sharedDBMu.Lock()
+	defer sharedDBMu.Unlock()
+
+	stats := make(map[string]sql.DBStats, len(dataSourceDBs)+1)
+	if sharedDB != nil {
+		stats[""] = sharedDB.Stats()
+	}
+	for dsn, db := range dataSourceDBs {
+		stats[dsn] = db.Stats()
+	}
+	return stats
+}
+
+// ListTables 返回当前数据库中用户可见的表和视图名称（小写），同时包含 "表名" 和 "模式.表名" 两种形式
+func ListTables(ctx context.Context, db *sql.DB) (map[string]bool, error) {
+	rows, err := db.QueryContext(ctx, `SELECT table_schema, table_name FROM information_schema.tables
+		WHERE table_schema NOT IN ('pg_catalog', 'information_schema')`)
+	if err != nil {
+		return nil, fmt.Errorf("查询表列表失败: %w", err)
+	}
+	defer rows.Close()
+
+	tables := make(map[string]bool)
+	for rows.Next() {
+		var schema, name string
+		if err := rows.Scan(&schema, &name); err != nil {
+			return nil, fmt.Errorf("读取表列表失败: %w", err)
+		}
+		tables[strings.ToLower(name)] = true
+		tables[strings.ToLower(schema+"."+name)] = true
+	}
+	return tables, rows.Err()
+}
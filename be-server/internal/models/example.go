@@ -0,0 +1,85 @@
+package models
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// Example 已验证的问题→SQL示例，用于few-shot提示
+type Example struct {
+	ID         int64     `json:"id"`
+	Workspace  string    `json:"workspace"`
+	DataSource string    `json:"data_source"`
+	Question   string    `json:"question"`
+	SQL        string    `json:"sql"`
+	Source     string    `json:"source"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ListExamples 返回工作区中某个数据源下的全部示例
+func ListExamples(db *sql.DB, workspace, dataSource string) ([]Example, error) {
+	rows, err := db.Query(
+		`SELECT id, workspace, data_source, question, sql_text, source, created_at
+		 FROM d2t_examples WHERE workspace = $1 AND data_source = $2 ORDER BY id`, workspace, dataSource)
+	if err != nil {
+		return nil, fmt.Errorf("查询示例失败: %w", err)
+	}
+	defer rows.Close()
+
+	var examples []Example
+	for rows.Next() {
+		var e Example
+		if err := rows.Scan(&e.ID, &e.Workspace, &e.DataSource, &e.Question, &e.SQL, &e.Source, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("扫描示例失败: %w", err)
+		}
+		examples = append(examples, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历示例失败: %w", err)
+	}
+	return examples, nil
+}
+
+// InsertExample 写入一个示例，同一工作区同一数据源下相同问题会覆盖原有SQL
+func InsertExample(db *sql.DB, e *Example) error {
+	err := db.QueryRow(
+		`INSERT INTO d2t_examples (workspace, data_source, question, sql_text, source)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (workspace, data_source, question)
+		 DO UPDATE SET sql_text = EXCLUDED.sql_text, source = EXCLUDED.source
+		 RETURNING id, created_at`,
+		e.Workspace, e.DataSource, e.Question, e.SQL, e.Source,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("写入示例失败: %w", err)
+	}
+	return nil
+}
+
+// SeedExample 写入一个示例，已存在时保持不变
+func SeedExample(db *sql.DB, e Example) error {
+	_, err := db.Exec(
+		`INSERT INTO d2t_examples (workspace, data_source, question, sql_text, source)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (workspace, data_source, question) DO NOTHING`,
+		e.Workspace, e.DataSource, e.Question, e.SQL, e.Source,
+	)
+	if err != nil {
+		return fmt.Errorf("写入种子示例失败: %w", err)
+	}
+	return nil
+}
+
+// DeleteExample 删除工作区中的一个示例，返回是否存在
+func DeleteExample(db *sql.DB, workspace string, id int64) (bool, error) {
+	res, err := db.Exec(`DELETE FROM d2t_examples WHERE id = $1 AND workspace = $2`, id, workspace)
+	if err != nil {
+		return false, fmt.Errorf("删除示例失败: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("删除示例失败: %w", err)
+	}
+	return n > 0, nil
+}
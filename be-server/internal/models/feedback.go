@@ -0,0 +1,120 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 反馈评分
+const (
+	RatingUp   = "up"
+	RatingDown = "down"
+)
+
+// Feedback 用户对一次生成结果的反馈
+type Feedback struct {
+	ID           int64     `json:"id"`
+	HistoryID    int64     `json:"history_id"`
+	Rating       string    `json:"rating"`
+	CorrectedSQL string    `json:"corrected_sql,omitempty"`
+	Comment      string    `json:"comment,omitempty"`
+	Promoted     bool      `json:"promoted"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// FeedbackRecord 反馈报表使用的一行：查询历史及其（可能为空的）反馈
+type FeedbackRecord struct {
+	History  QueryHistory
+	Feedback *Feedback
+}
+
+// InsertFeedback 写入一条反馈
+func InsertFeedback(db *sql.DB, f *Feedback) error {
+	err := db.QueryRow(
+		`INSERT INTO d2t_feedback (history_id, rating, corrected_sql, comment)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING id, promoted, created_at`,
+		f.HistoryID, f.Rating, f.CorrectedSQL, f.Comment,
+	).Scan(&f.ID, &f.Promoted, &f.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("写入反馈失败: %w", err)
+	}
+	return nil
+}
+
+// GetFeedback 按ID读取工作区中的反馈（按所属查询历史的工作区判断），不存在时返回 nil
+func GetFeedback(db *sql.DB, workspace string, id int64) (*Feedback, error) {
+	var f Feedback
+	err := db.QueryRow(
+		`SELECT f.id, f.history_id, f.rating, f.corrected_sql, f.comment, f.promoted, f.created_at
+		 FROM d2t_feedback f JOIN d2t_query_history h ON h.id = f.history_id
+		 WHERE f.id = $1 AND h.workspace = $2`, id, workspace,
+	).Scan(&f.ID, &f.HistoryID, &f.Rating, &f.CorrectedSQL, &f.Comment, &f.Promoted, &f.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取反馈失败: %w", err)
+	}
+	return &f, nil
+}
+
+// MarkFeedbackPromoted 标记反馈已加入示例库
+func MarkFeedbackPromoted(db *sql.DB, id int64) error {
+	if _, err := db.Exec(`UPDATE d2t_feedback SET promoted = TRUE WHERE id = $1`, id); err != nil {
+		return fmt.Errorf("更新反馈失败: %w", err)
+	}
+	return nil
+}
+
+// ListFeedbackRecords 返回工作区中指定时间之后的查询历史及其反馈，供报表统计
+func ListFeedbackRecords(db *sql.DB, workspace string, since time.Time) ([]FeedbackRecord, error) {
+	rows, err := db.Query(
+		`SELECT h.id, h.workspace, h.data_source, h.question, h.sql_text, h.prompt_version, h.status, h.error, h.row_count, h.duration_ms, h.created_at,
+		        f.id, f.rating, f.corrected_sql, f.comment, f.promoted, f.created_at
+		 FROM d2t_query_history h
+		 LEFT JOIN d2t_feedback f ON f.history_id = h.id
+		 WHERE h.workspace = $1 AND h.created_at >= $2
+		 ORDER BY h.id`, workspace, since)
+	if err != nil {
+		return nil, fmt.Errorf("查询反馈记录失败: %w", err)
+	}
+	defer rows.Close()
+
+	var records []FeedbackRecord
+	for rows.Next() {
+		var r FeedbackRecord
+		var (
+			fID           sql.NullInt64
+			fRating       sql.NullString
+			fCorrectedSQL sql.NullString
+			fComment      sql.NullString
+			fPromoted     sql.NullBool
+			fCreatedAt    sql.NullTime
+		)
+		h := &r.History
+		err := rows.Scan(&h.ID, &h.Workspace, &h.DataSource, &h.Question, &h.SQL, &h.PromptVersion, &h.Status, &h.Error, &h.RowCount, &h.DurationMs, &h.CreatedAt,
+			&fID, &fRating, &fCorrectedSQL, &fComment, &fPromoted, &fCreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("扫描反馈记录失败: %w", err)
+		}
+		if fID.Valid {
+			r.Feedback = &Feedback{
+				ID:           fID.Int64,
+				HistoryID:    h.ID,
+				Rating:       fRating.String,
+				CorrectedSQL: fCorrectedSQL.String,
+				Comment:      fComment.String,
+				Promoted:     fPromoted.Bool,
+				CreatedAt:    fCreatedAt.Time,
+			}
+		}
+		records = append(records, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("遍历反馈记录失败: %w", err)
+	}
+	return records, nil
+}
@@ -0,0 +1,91 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// 查询历史状态
+const (
+	HistoryStatusSuccess = "success"
+	HistoryStatusError   = "error"
+	// HistoryStatusClarification 问题有歧义，等待用户回答澄清问题
+	HistoryStatusClarification = "needs_clarification"
+)
+
+// Clarification 大模型提出的澄清问题、建议的选项，以及用户的回答（继续问答时填写）
+type Clarification struct {
+	Question string   `json:"question"`
+	Options  []string `json:"options"`
+	Answer   string   `json:"answer,omitempty"`
+}
+
+// QueryHistory 一次问答的执行记录
+type QueryHistory struct {
+	ID            int64  `json:"id"`
+	Workspace     string `json:"workspace"`
+	DataSource    string `json:"data_source"`
+	Question      string `json:"question"`
+	SQL           string `json:"sql"`
+	PromptVersion string `json:"prompt_version"`
+	Status        string `json:"status"`
+	Error         string `json:"error,omitempty"`
+	RowCount      int    `json:"row_count"`
+	DurationMs    int64  `json:"duration_ms"`
+	// Clarification 等待澄清时为提出的问题；继续问答时为问题和用户的回答
+	Clarification *Clarification `json:"clarification,omitempty"`
+	// ParentID 继续问答时为等待澄清的那条历史的ID
+	ParentID  int64     `json:"parent_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InsertQueryHistory 写入一条查询历史
+func InsertQueryHistory(db *sql.DB, h *QueryHistory) error {
+	// 以文本传入，lib/pq 会把 []byte 编码为 bytea
+	var clarification sql.NullString
+	if h.Clarification != nil {
+		data, err := json.Marshal(h.Clarification)
+		if err != nil {
+			return fmt.Errorf("写入查询历史失败: %w", err)
+		}
+		clarification = sql.NullString{String: string(data), Valid: true}
+	}
+	err := db.QueryRow(
+		`INSERT INTO d2t_query_history (workspace, data_source, question, sql_text, prompt_version, status, error, row_count, duration_ms, clarification, parent_id)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11::bigint, 0))
+		 RETURNING id, created_at`,
+		h.Workspace, h.DataSource, h.Question, h.SQL, h.PromptVersion, h.Status, h.Error, h.RowCount, h.DurationMs, clarification, h.ParentID,
+	).Scan(&h.ID, &h.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("写入查询历史失败: %w", err)
+	}
+	return nil
+}
+
+// GetQueryHistory 按ID读取工作区中的查询历史，不存在或属于其他工作区时返回 nil
+func GetQueryHistory(db *sql.DB, workspace string, id int64) (*QueryHistory, error) {
+	var h QueryHistory
+	var clarification []byte
+	var parentID sql.NullInt64
+	err := db.QueryRow(
+		`SELECT id, workspace, data_source, question, sql_text, prompt_version, status, error, row_count, duration_ms, clarification, parent_id, created_at
+		 FROM d2t_query_history WHERE id = $1 AND workspace = $2`, id, workspace,
+	).Scan(&h.ID, &h.Workspace, &h.DataSource, &h.Question, &h.SQL, &h.PromptVersion, &h.Status, &h.Error, &h.RowCount, &h.DurationMs, &clarification, &parentID, &h.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取查询历史失败: %w", err)
+	}
+	if len(clarification) > 0 {
+		h.Clarification = &Clarification{}
+		if err := json.Unmarshal(clarification, h.Clarification); err != nil {
+			return nil, fmt.Errorf("读取查询历史失败: %w", err)
+		}
+	}
+	h.ParentID = parentID.Int64
+	return &h, nil
+}
@@ -0,0 +1,56 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// refilledTokens 令牌桶按距上次更新的时间补充后的令牌数，$2 为容量，$3 为每秒补充数
+const refilledTokens = `LEAST($2::float8, d2t_rate_limits.tokens + EXTRACT(EPOCH FROM (NOW() - d2t_rate_limits.updated_at))::float8 * $3::float8)`
+
+// TakeRateLimitToken 原子地从令牌桶中取一个令牌，返回是否成功以及剩余令牌数
+func TakeRateLimitToken(db *sql.DB, key string, capacity, perSecond float64) (bool, float64, error) {
+	var allowed bool
+	var tokens float64
+	err := db.QueryRow(
+		`INSERT INTO d2t_rate_limits (bucket_key, tokens, allowed, updated_at)
+		 VALUES ($1, $2::float8 - 1, TRUE, NOW())
+		 ON CONFLICT (bucket_key) DO UPDATE SET
+			tokens = CASE WHEN `+refilledTokens+` >= 1 THEN `+refilledTokens+` - 1 ELSE `+refilledTokens+` END,
+			allowed = `+refilledTokens+` >= 1,
+			updated_at = NOW()
+		 RETURNING allowed, tokens`,
+		key, capacity, perSecond,
+	).Scan(&allowed, &tokens)
+	if err != nil {
+		return false, 0, fmt.Errorf("更新限流令牌桶失败: %w", err)
+	}
+	return allowed, tokens, nil
+}
+
+// AddTokenUsage 累加调用方在某个周期内消耗的 token
+func AddTokenUsage(db *sql.DB, subject, period string, tokens int64) error {
+	_, err := db.Exec(
+		`INSERT INTO d2t_token_usage (subject, period, tokens) VALUES ($1, $2, $3)
+		 ON CONFLICT (subject, period) DO UPDATE SET tokens = d2t_token_usage.tokens + EXCLUDED.tokens`,
+		subject, period, tokens,
+	)
+	if err != nil {
+		return fmt.Errorf("记录token用量失败: %w", err)
+	}
+	return nil
+}
+
+// GetTokenUsage 返回调用方在某个周期内已消耗的 token，没有记录时为 0
+func GetTokenUsage(db *sql.DB, subject, period string) (int64, error) {
+	var tokens int64
+	err := db.QueryRow(`SELECT tokens FROM d2t_token_usage WHERE subject = $1 AND period = $2`, subject, period).Scan(&tokens)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("读取token用量失败: %w", err)
+	}
+	return tokens, nil
+}
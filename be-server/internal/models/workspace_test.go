@@ -0,0 +1,88 @@
+package models
+
+import (
+	"database/sql"
+	"os"
+	"testing"
+
+	_ "github.com/lib/pq"
+)
+
+// testDB opens the disposable PostgreSQL database given by TEST_DATABASE_DSN
+// and creates the application tables
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := MigrateAppSchema(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+// TestWorkspaceIsolation checks that lookups by ID never return or change a
+// record of another workspace
+func TestWorkspaceIsolation(t *testing.T) {
+	db := testDB(t)
+	const wsA, wsB = "test-iso-a", "test-iso-b"
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM d2t_feedback WHERE history_id IN (SELECT id FROM d2t_query_history WHERE workspace IN ($1, $2))`, wsA, wsB)
+		db.Exec(`DELETE FROM d2t_query_history WHERE workspace IN ($1, $2)`, wsA, wsB)
+		db.Exec(`DELETE FROM d2t_api_keys WHERE workspace IN ($1, $2)`, wsA, wsB)
+	})
+
+	history := &QueryHistory{Workspace: wsA, DataSource: "default", Question: "q", SQL: "SELECT 1", Status: HistoryStatusSuccess}
+	if err := InsertQueryHistory(db, history); err != nil {
+		t.Fatal(err)
+	}
+	feedback := &Feedback{HistoryID: history.ID, Rating: RatingUp}
+	if err := InsertFeedback(db, feedback); err != nil {
+		t.Fatal(err)
+	}
+	key := &APIKey{Workspace: wsA, Name: "a", Prefix: "d2t_test", KeyHash: "test-iso-hash", Scopes: []string{"ask"}}
+	if err := InsertAPIKey(db, key); err != nil {
+		t.Fatal(err)
+	}
+
+	if h, err := GetQueryHistory(db, wsA, history.ID); err != nil || h == nil {
+		t.Fatalf("own history: got %v, %v", h, err)
+	}
+	if h, err := GetQueryHistory(db, wsB, history.ID); err != nil || h != nil {
+		t.Fatalf("history of another workspace: got %+v, %v", h, err)
+	}
+
+	if f, err := GetFeedback(db, wsA, feedback.ID); err != nil || f == nil {
+		t.Fatalf("own feedback: got %v, %v", f, err)
+	}
+	if f, err := GetFeedback(db, wsB, feedback.ID); err != nil || f != nil {
+		t.Fatalf("feedback of another workspace: got %+v, %v", f, err)
+	}
+
+	keys, err := ListAPIKeys(db, wsB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 0 {
+		t.Fatalf("keys of another workspace listed: %+v", keys)
+	}
+	if keys, err := ListAPIKeys(db, wsA); err != nil || len(keys) != 1 || keys[0].ID != key.ID {
+		t.Fatalf("own keys: got %+v, %v", keys, err)
+	}
+
+	if revoked, err := RevokeAPIKey(db, wsB, key.ID); err != nil || revoked {
+		t.Fatalf("revoke from another workspace: got %v, %v", revoked, err)
+	}
+	if k, err := FindActiveAPIKeyByHash(db, key.KeyHash); err != nil || k == nil {
+		t.Fatalf("key revoked by another workspace: got %v, %v", k, err)
+	}
+	if revoked, err := RevokeAPIKey(db, wsA, key.ID); err != nil || !revoked {
+		t.Fatalf("revoke own key: got %v, %v", revoked, err)
+	}
+}
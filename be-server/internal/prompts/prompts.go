@@ -0,0 +1,280 @@
+package prompts
+
+import (
+	"bytes"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// DefaultVersion 未配置时每种模式使用的模板版本
+const DefaultVersion = "v1"
+
+// defaultVersions 未配置时默认版本不是 DefaultVersion 的模式；生成SQL默认使用要求 JSON 输出的 v2
+var defaultVersions = map[string]string{
+	"nl2sql_with_schema": "v2",
+}
+
+// ResponseFormatJSON 要求大模型输出 JSON 对象的模板，在 response_format 块中声明
+const ResponseFormatJSON = "json_object"
+
+// funcs 模板中可用的函数：json 把值编码为 JSON，用于在示例中写出结构化回答
+var funcs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+//go:embed templates
+var embeddedTemplates embed.FS
+
+// Example 放入提示词的问题→SQL示例
+type Example struct {
+	Question string `json:"question"`
+	SQL      string `json:"sql"`
+	// Tables SQL引用的表，供结构化输出的示例回答使用
+	Tables []string `json:"tables,omitempty"`
+}
+
+// Clarification 大模型之前提出的澄清问题和用户的回答
+type Clarification struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+// Vars 模板可用的变量
+type Vars struct {
+	Input    string
+	Schema   string
+	Dialect  string
+	Examples []Example
+	// Clarification 用户对澄清问题的回答，继续问答时才有
+	Clarification *Clarification
+	// Results 查询结果样例（已脱敏），供分析类模板使用
+	Results string
+	// SQL、Columns、RowCount 供总结结果的模板使用：执行的SQL、各列的类型和统计、结果总行数
+	SQL      string
+	Columns  string
+	RowCount int
+}
+
+// Message 渲染后的一条对话消息
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Template 某个模式下的一个模板版本，文件中通过 define 定义以下块：
+// system（可选）、user（必需）、example_user / example_assistant（可选，示例渲染为多轮对话）、
+// response_format（可选，内容为 json_object 时要求大模型输出 JSON 对象）
+type Template struct {
+	Mode    string
+	Version string
+	tmpl    *template.Template
+}
+
+var (
+	registry     map[string]map[string]*Template
+	registryErr  error
+	registryOnce sync.Once
+)
+
+// load 加载内置模板，PROMPT_TEMPLATE_DIR 中同样结构（<mode>/<version>.tmpl）的文件可新增或覆盖版本
+func load() {
+	registry = make(map[string]map[string]*Template)
+	if err := loadFS(embeddedTemplates, "templates"); err != nil {
+		registryErr = err
+		return
+	}
+	if dir := os.Getenv("PROMPT_TEMPLATE_DIR"); dir != "" {
+		if err := loadFS(os.DirFS(dir), "."); err != nil {
+			slog.Warn("failed to load prompt templates", "dir", dir, "error", err)
+		}
+	}
+}
+
+func loadFS(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path.Ext(p) != ".tmpl" {
+			return nil
+		}
+
+		mode := path.Base(path.Dir(p))
+		version := strings.TrimSuffix(path.Base(p), ".tmpl")
+		content, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("读取提示词模板 %s 失败: %w", p, err)
+		}
+
+		tmpl, err := template.New(mode + "/" + version).Option("missingkey=error").Funcs(funcs).Parse(string(content))
+		if err != nil {
+			return fmt.Errorf("解析提示词模板 %s 失败: %w", p, err)
+		}
+		if tmpl.Lookup("user") == nil {
+			return fmt.Errorf("提示词模板 %s 缺少 user 块", p)
+		}
+
+		if registry[mode] == nil {
+			registry[mode] = make(map[string]*Template)
+		}
+		registry[mode][version] = &Template{Mode: mode, Version: version, tmpl: tmpl}
+		return nil
+	})
+}
+
+// Get 返回指定模式和版本的模板
+func Get(mode, version string) (*Template, error) {
+	registryOnce.Do(load)
+	if registryErr != nil {
+		return nil, registryErr
+	}
+
+	versions, ok := registry[mode]
+	if !ok {
+		return nil, fmt.Errorf("未知的操作模式: %s", mode)
+	}
+	t, ok := versions[version]
+	if !ok {
+		return nil, fmt.Errorf("模式 %s 没有版本为 %s 的提示词模板", mode, version)
+	}
+	return t, nil
+}
+
+// Resolve 返回某个数据源在指定模式下生效的模板
+func Resolve(mode, dataSource string) (*Template, error) {
+	return Get(mode, ActiveVersion(mode, dataSource))
+}
+
+// ResolveFor 与 Resolve 相同，但先按工作区的版本配置选择
+func ResolveFor(mode, dataSource, workspaceVersions string) (*Template, error) {
+	return Get(mode, ActiveVersionFor(mode, dataSource, workspaceVersions))
+}
+
+// ActiveVersion 按 PROMPT_VERSIONS 选择版本，格式为逗号分隔的 <数据源>.<模式>=<版本>，
+// 数据源可写 * 表示全部，例如 "*.nl2sql_with_schema=v2,sales.analyze=v3"
+func ActiveVersion(mode, dataSource string) string {
+	return ActiveVersionFor(mode, dataSource, "")
+}
+
+// ActiveVersionFor 先在工作区的版本配置（格式同 PROMPT_VERSIONS）中查找，没有匹配时再按 PROMPT_VERSIONS 选择
+func ActiveVersionFor(mode, dataSource, workspaceVersions string) string {
+	if version, ok := matchVersion(workspaceVersions, mode, dataSource); ok {
+		return version
+	}
+	if version, ok := matchVersion(os.Getenv("PROMPT_VERSIONS"), mode, dataSource); ok {
+		return version
+	}
+	if version, ok := defaultVersions[mode]; ok {
+		return version
+	}
+	return DefaultVersion
+}
+
+// matchVersion 在版本配置中查找，精确的数据源优先于 *
+func matchVersion(spec, mode, dataSource string) (string, bool) {
+	selected, found := "", false
+	for _, entry := range strings.Split(spec, ",") {
+		key, version, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			continue
+		}
+		ds, m, ok := strings.Cut(strings.TrimSpace(key), ".")
+		if !ok || m != mode {
+			continue
+		}
+		switch ds {
+		case dataSource:
+			return strings.TrimSpace(version), true
+		case "*":
+			selected, found = strings.TrimSpace(version), true
+		}
+	}
+	return selected, found
+}
+
+// Versions 列出每种模式可用的模板版本
+func Versions() (map[string][]string, error) {
+	registryOnce.Do(load)
+	if registryErr != nil {
+		return nil, registryErr
+	}
+
+	result := make(map[string][]string)
+	for mode, versions := range registry {
+		for v := range versions {
+			result[mode] = append(result[mode], v)
+		}
+		sort.Strings(result[mode])
+	}
+	return result, nil
+}
+
+// Render 渲染为对话消息：system、每个示例一轮 user/assistant（模板定义了示例块时），最后是 user
+func (t *Template) Render(vars Vars) ([]Message, error) {
+	var messages []Message
+
+	if t.tmpl.Lookup("system") != nil {
+		content, err := t.execute("system", vars)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, Message{Role: "system", Content: content})
+	}
+
+	if t.tmpl.Lookup("example_user") != nil && t.tmpl.Lookup("example_assistant") != nil {
+		for _, example := range vars.Examples {
+			question, err := t.execute("example_user", example)
+			if err != nil {
+				return nil, err
+			}
+			answer, err := t.execute("example_assistant", example)
+			if err != nil {
+				return nil, err
+			}
+			messages = append(messages,
+				Message{Role: "user", Content: question},
+				Message{Role: "assistant", Content: answer},
+			)
+		}
+	}
+
+	content, err := t.execute("user", vars)
+	if err != nil {
+		return nil, err
+	}
+	messages = append(messages, Message{Role: "user", Content: content})
+
+	return messages, nil
+}
+
+// ResponseFormat 模板要求的输出格式，未声明时为空（自由文本）
+func (t *Template) ResponseFormat() string {
+	if t.tmpl.Lookup("response_format") == nil {
+		return ""
+	}
+	format, err := t.execute("response_format", nil)
+	if err != nil {
+		return ""
+	}
+	return format
+}
+
+func (t *Template) execute(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := t.tmpl.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", fmt.Errorf("渲染提示词模板 %s/%s 失败: %w", t.Mode, t.Version, err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
@@ -0,0 +1,158 @@
+package ratelimit
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Unlimited 表示没有配置预算时的剩余额度
+const Unlimited int64 = -1
+
+// BudgetStore 记录调用方在每个周期内消耗的 token
+type BudgetStore interface {
+	Used(subject, period string) (int64, error)
+	Add(subject, period string, tokens int64) error
+}
+
+// BudgetStatus 调用方当前的预算余量
+type BudgetStatus struct {
+	DailyRemaining   int64
+	MonthlyRemaining int64
+	Exceeded         bool
+	RetryAfter       time.Duration
+}
+
+// Budget 每个调用方每天/每月的大模型 token 预算
+type Budget struct {
+	store   BudgetStore
+	daily   int64
+	monthly int64
+	now     func() time.Time
+}
+
+// NewBudget 根据配置创建每个调用方的 token 预算，日预算和月预算都为 0 时返回 nil（不限制）
+func NewBudget(cfg config.RateLimitConfig) *Budget {
+	return NewLimitedBudget(NewBudgetStore(cfg), cfg.DailyTokens, cfg.MonthlyTokens)
+}
+
+// NewBudgetStore 按 RATE_LIMIT_BACKEND 创建用量存储
+func NewBudgetStore(cfg config.RateLimitConfig) BudgetStore {
+	if cfg.Backend == "postgres" {
+		return postgresBudgetStore{}
+	}
+	return &memoryBudgetStore{used: make(map[string]int64), current: make(map[string]string)}
+}
+
+// NewLimitedBudget 在已有的用量存储上创建指定额度的预算，都为 0 时返回 nil（不限制）
+func NewLimitedBudget(store BudgetStore, daily, monthly int64) *Budget {
+	if daily <= 0 && monthly <= 0 {
+		return nil
+	}
+	return &Budget{store: store, daily: daily, monthly: monthly, now: time.Now}
+}
+
+// 周期键，按 UTC 计算
+func dayPeriod(t time.Time) string   { return "day:" + t.UTC().Format("2006-01-02") }
+func monthPeriod(t time.Time) string { return "month:" + t.UTC().Format("2006-01") }
+
+// Check 返回调用方的剩余额度；任一周期用尽时 Exceeded 为 true，RetryAfter 为该周期结束的时间
+func (b *Budget) Check(subject string) (BudgetStatus, error) {
+	now := b.now().UTC()
+	status := BudgetStatus{DailyRemaining: Unlimited, MonthlyRemaining: Unlimited}
+
+	if b.daily > 0 {
+		used, err := b.store.Used(subject, dayPeriod(now))
+		if err != nil {
+			return status, err
+		}
+		status.DailyRemaining = max(0, b.daily-used)
+		if status.DailyRemaining == 0 {
+			status.Exceeded = true
+			status.RetryAfter = time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC).Sub(now)
+		}
+	}
+	if b.monthly > 0 {
+		used, err := b.store.Used(subject, monthPeriod(now))
+		if err != nil {
+			return status, err
+		}
+		status.MonthlyRemaining = max(0, b.monthly-used)
+		if status.MonthlyRemaining == 0 {
+			status.Exceeded = true
+			status.RetryAfter = time.Date(now.Year(), now.Month()+1, 1, 0, 0, 0, 0, time.UTC).Sub(now)
+		}
+	}
+	return status, nil
+}
+
+// Record 把一次请求消耗的 token 计入当天和当月
+func (b *Budget) Record(subject string, tokens int64) error {
+	if tokens <= 0 {
+		return nil
+	}
+	now := b.now()
+	if b.daily > 0 {
+		if err := b.store.Add(subject, dayPeriod(now), tokens); err != nil {
+			return err
+		}
+	}
+	if b.monthly > 0 {
+		if err := b.store.Add(subject, monthPeriod(now), tokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// memoryBudgetStore 进程内用量，只保留当前周期
+type memoryBudgetStore struct {
+	mu      sync.Mutex
+	used    map[string]int64
+	current map[string]string // 周期类型（day:/month:）-> 当前周期
+}
+
+func (s *memoryBudgetStore) Used(subject, period string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.used[subject+"|"+period], nil
+}
+
+func (s *memoryBudgetStore) Add(subject, period string, tokens int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 新周期开始时丢弃上一周期的记录
+	kind := period[:strings.Index(period, ":")+1]
+	if previous, ok := s.current[kind]; ok && previous != period {
+		for key := range s.used {
+			if strings.HasSuffix(key, "|"+previous) {
+				delete(s.used, key)
+			}
+		}
+	}
+	s.current[kind] = period
+	s.used[subject+"|"+period] += tokens
+	return nil
+}
+
+// postgresBudgetStore 用量保存在 d2t_token_usage 表中，多实例共享
+type postgresBudgetStore struct{}
+
+func (postgresBudgetStore) Used(subject, period string) (int64, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return 0, err
+	}
+	return models.GetTokenUsage(db, subject, period)
+}
+
+func (postgresBudgetStore) Add(subject, period string, tokens int64) error {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return err
+	}
+	return models.AddTokenUsage(db, subject, period, tokens)
+}
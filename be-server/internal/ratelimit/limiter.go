@@ -0,0 +1,122 @@
+package ratelimit
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"log/slog"
+	"math"
+	"sync"
+	"time"
+)
+
+// Decision 一次限流判断的结果
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration
+}
+
+// Limiter 按调用方标识做令牌桶限流
+type Limiter interface {
+	Allow(subject string) (Decision, error)
+}
+
+// NewLimiter 根据配置创建限流器，RequestsPerMinute 为 0 时返回 nil（不限流）
+func NewLimiter(cfg config.RateLimitConfig) Limiter {
+	if cfg.RequestsPerMinute <= 0 {
+		return nil
+	}
+	burst := cfg.Burst
+	if burst < 1 {
+		burst = 1
+	}
+	perSecond := cfg.RequestsPerMinute / 60
+
+	if cfg.Backend == "postgres" {
+		return &postgresLimiter{capacity: float64(burst), perSecond: perSecond}
+	}
+	if cfg.Backend != "memory" {
+		slog.Warn("unknown RATE_LIMIT_BACKEND, using memory", "backend", cfg.Backend)
+	}
+	return &memoryLimiter{capacity: float64(burst), perSecond: perSecond, buckets: make(map[string]*bucket)}
+}
+
+// decide 根据取令牌后的剩余数量生成判断结果
+func decide(allowed bool, tokens, capacity, perSecond float64) Decision {
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     int(capacity),
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+	}
+	if !allowed {
+		d.RetryAfter = time.Duration((1 - tokens) / perSecond * float64(time.Second))
+	}
+	return d
+}
+
+// maxIdleBuckets 内存中的令牌桶超过该数量时清理已补满的桶
+const maxIdleBuckets = 10000
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// memoryLimiter 进程内令牌桶，只适用于单实例部署
+type memoryLimiter struct {
+	mu        sync.Mutex
+	capacity  float64
+	perSecond float64
+	buckets   map[string]*bucket
+}
+
+func (l *memoryLimiter) Allow(subject string) (Decision, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b, ok := l.buckets[subject]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.prune(now)
+		}
+		b = &bucket{tokens: l.capacity, updated: now}
+		l.buckets[subject] = b
+	}
+
+	b.tokens = math.Min(l.capacity, b.tokens+now.Sub(b.updated).Seconds()*l.perSecond)
+	b.updated = now
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+	return decide(allowed, b.tokens, l.capacity, l.perSecond), nil
+}
+
+// prune 删除已经补满的桶，它们与新建的桶没有区别
+func (l *memoryLimiter) prune(now time.Time) {
+	for subject, b := range l.buckets {
+		if b.tokens+now.Sub(b.updated).Seconds()*l.perSecond >= l.capacity {
+			delete(l.buckets, subject)
+		}
+	}
+}
+
+// postgresLimiter 令牌桶保存在 d2t_rate_limits 表中，多实例共享
+type postgresLimiter struct {
+	capacity  float64
+	perSecond float64
+}
+
+func (l *postgresLimiter) Allow(subject string) (Decision, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return Decision{}, err
+	}
+	allowed, tokens, err := models.TakeRateLimitToken(db, subject, l.capacity, l.perSecond)
+	if err != nil {
+		return Decision{}, err
+	}
+	return decide(allowed, tokens, l.capacity, l.perSecond), nil
+}
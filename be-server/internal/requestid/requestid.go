@@ -0,0 +1,51 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Header 请求ID使用的HTTP头
+const Header = "X-Request-ID"
+
+// maxLength 客户端传入的请求ID超过该长度时重新生成
+const maxLength = 128
+
+type contextKey struct{}
+
+// New 生成一个新的请求ID（16字节随机数的十六进制）
+func New() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "unknown"
+	}
+	return hex.EncodeToString(b)
+}
+
+// Sanitize 校验客户端传入的请求ID，只接受可打印ASCII，否则返回空
+func Sanitize(id string) string {
+	if id == "" || len(id) > maxLength {
+		return ""
+	}
+	for _, r := range id {
+		if r < 0x21 || r > 0x7e {
+			return ""
+		}
+	}
+	return id
+}
+
+// NewContext 返回携带请求ID的上下文
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext 返回上下文中的请求ID，没有时为空
+func FromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,83 @@
+package routes
+
+import (
+	"d2t_server/internal/middleware"
+	"d2t_server/internal/services"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAPIKeysHandler 列出调用方工作区的API Key（不含明文）
+func ListAPIKeysHandler(c *gin.Context) {
+	workspace, ok := adminWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	keys, err := services.NewAPIKeyService().List(workspace)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"api_keys": keys})
+}
+
+// CreateAPIKeyHandler 在调用方工作区创建API Key，明文只在响应中返回一次；
+// 引导管理员Key可以用 workspace 字段为其他工作区创建
+func CreateAPIKeyHandler(c *gin.Context) {
+	var req struct {
+		Name      string   `json:"name" binding:"required"`
+		Scopes    []string `json:"scopes" binding:"required"`
+		Workspace string   `json:"workspace"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	workspace, err := services.AdminWorkspace(middleware.GetPrincipal(c), req.Workspace, false)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+
+	plaintext, key, err := services.NewAPIKeyService().Create(workspace, req.Name, req.Scopes)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"key":     plaintext,
+		"api_key": key,
+	})
+}
+
+// RevokeAPIKeyHandler 吊销调用方工作区的API Key，其他工作区的Key视为不存在
+func RevokeAPIKeyHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid API key id"})
+		return
+	}
+	workspace, ok := adminWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	found, err := services.NewAPIKeyService().Revoke(workspace, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found or already revoked"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,99 @@
+package routes
+
+import (
+	"d2t_server/internal/models"
+	"d2t_server/internal/services"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListAuditHandler 按条件查询调用方工作区的审计日志，支持 before_id 分页
+func ListAuditHandler(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var ok bool
+	if filter.Workspace, ok = adminWorkspace(c, true); !ok {
+		return
+	}
+
+	entries, err := services.NewAuditService().List(filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// 下一页从本页最后一条之前开始，返回空列表时说明已到末尾
+	response := gin.H{"entries": entries}
+	if len(entries) > 0 {
+		response["next_before_id"] = entries[len(entries)-1].ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ExportAuditHandler 以 NDJSON 流式导出调用方工作区中符合条件的审计日志
+func ExportAuditHandler(c *gin.Context) {
+	filter, err := parseAuditFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var ok bool
+	if filter.Workspace, ok = adminWorkspace(c, true); !ok {
+		return
+	}
+
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="d2t-audit-%s.ndjson"`, time.Now().UTC().Format("20060102T150405Z")))
+	c.Status(http.StatusOK)
+
+	// 响应头已发出，导出中途出错只能记录日志并截断输出
+	if err := services.NewAuditService().Export(filter, c.Writer); err != nil {
+		slog.ErrorContext(c.Request.Context(), "audit export failed", "error", err)
+	}
+}
+
+// parseAuditFilter 解析查询参数：principal_id、data_source、source、status、request_id、
+// since/until（RFC3339）、before_id、limit
+func parseAuditFilter(c *gin.Context) (models.AuditFilter, error) {
+	filter := models.AuditFilter{
+		PrincipalID: c.Query("principal_id"),
+		DataSource:  c.Query("data_source"),
+		Source:      c.Query("source"),
+		Status:      c.Query("status"),
+		RequestID:   c.Query("request_id"),
+	}
+
+	for name, target := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := c.Query(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s: %w", name, err)
+			}
+			*target = t
+		}
+	}
+
+	if value := c.Query("before_id"); value != "" {
+		id, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid before_id")
+		}
+		filter.BeforeID = id
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return filter, fmt.Errorf("invalid limit")
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
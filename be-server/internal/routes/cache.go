@@ -0,0 +1,25 @@
+package routes
+
+import (
+	"d2t_server/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// InvalidateCacheHandler 删除调用方工作区中缓存的SQL和查询结果，可按数据源和问题过滤；
+// 引导管理员Key可以用 workspace=* 清空全部工作区
+func InvalidateCacheHandler(c *gin.Context) {
+	workspace, ok := adminWorkspace(c, true)
+	if !ok {
+		return
+	}
+
+	deleted, err := services.NewCacheService().Invalidate(workspace, c.Query("data_source"), c.Query("question"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
+}
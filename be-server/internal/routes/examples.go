@@ -0,0 +1,91 @@
+package routes
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"d2t_server/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListExamplesHandler 列出调用方工作区中某个数据源下的few-shot示例
+func ListExamplesHandler(c *gin.Context) {
+	dataSource := c.DefaultQuery("data_source", config.DefaultDataSource)
+	workspace, ok := adminWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	examples, err := services.NewExampleService().List(workspace, dataSource)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"examples": examples})
+}
+
+// AddExampleHandler 在调用方工作区中新增一个已验证的问题→SQL示例
+func AddExampleHandler(c *gin.Context) {
+	var req struct {
+		DataSource string `json:"data_source"`
+		Question   string `json:"question" binding:"required"`
+		SQL        string `json:"sql" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	workspace, ok := adminWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	example := &models.Example{
+		Workspace:  workspace,
+		DataSource: req.DataSource,
+		Question:   req.Question,
+		SQL:        req.SQL,
+		Source:     "manual",
+	}
+	err := services.NewExampleService().Add(example)
+	switch {
+	case errors.Is(err, services.ErrInvalidExample):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, example)
+}
+
+// DeleteExampleHandler 删除调用方工作区中的一个示例
+func DeleteExampleHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid example id"})
+		return
+	}
+	workspace, ok := adminWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	found, err := services.NewExampleService().Remove(workspace, id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if !found {
+		c.JSON(http.StatusNotFound, gin.H{"error": "example not found"})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,97 @@
+package routes
+
+import (
+	"d2t_server/internal/middleware"
+	"d2t_server/internal/services"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SubmitFeedbackHandler 记录用户对某次问答的反馈（点赞/点踩、修正SQL、评论）
+func SubmitFeedbackHandler(c *gin.Context) {
+	historyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid history id"})
+		return
+	}
+
+	var req services.FeedbackInput
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	feedback, err := services.NewFeedbackService().Submit(middleware.GetPrincipal(c).WorkspaceName(), historyID, req)
+	switch {
+	case errors.Is(err, services.ErrInvalidRating):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrHistoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, feedback)
+}
+
+// FeedbackReportHandler 返回按表和问题模式统计的失败率，days 默认 30
+func FeedbackReportHandler(c *gin.Context) {
+	days, err := strconv.Atoi(c.DefaultQuery("days", "30"))
+	if err != nil || days <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "days must be a positive integer"})
+		return
+	}
+
+	workspace, ok := adminWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	since := time.Now().AddDate(0, 0, -days)
+	report, err := services.NewFeedbackService().Report(workspace, since)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
+
+// PromoteFeedbackHandler 将反馈中的修正SQL加入few-shot示例库
+func PromoteFeedbackHandler(c *gin.Context) {
+	feedbackID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid feedback id"})
+		return
+	}
+
+	workspace, ok := adminWorkspace(c, false)
+	if !ok {
+		return
+	}
+
+	example, err := services.NewFeedbackService().Promote(workspace, feedbackID)
+	switch {
+	case errors.Is(err, services.ErrFeedbackNotFound), errors.Is(err, services.ErrHistoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNothingToPromote):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrInvalidExample):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, example)
+}
@@ -0,0 +1,52 @@
+package routes
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/internal/services"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startedAt 进程启动时间
+var startedAt = time.Now()
+
+// LivezHandler 存活检查：进程能处理请求即返回 200，不检查任何依赖
+func LivezHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status":         services.HealthOK,
+		"timestamp":      time.Now().Format(time.RFC3339),
+		"uptime_seconds": int64(time.Since(startedAt).Seconds()),
+	})
+}
+
+// ReadyzHandler 就绪检查：关键依赖失败时返回 503。接口不需要认证，只返回整体状态，
+// 各组件的名称和错误信息通过 AdminHealthHandler 查看
+func ReadyzHandler(cfg *config.Config) gin.HandlerFunc {
+	health := services.NewHealthService(cfg.Health, cfg.LLM)
+	return func(c *gin.Context) {
+		report := health.Check(c.Request.Context())
+		status := http.StatusOK
+		if !report.Ready() {
+			status = http.StatusServiceUnavailable
+		}
+		c.JSON(status, gin.H{
+			"status":    report.Status,
+			"timestamp": report.Timestamp,
+		})
+	}
+}
+
+// AdminHealthHandler 返回各依赖的检查结果，只包含共享依赖和调用方工作区的数据源；
+// 引导管理员Key可以用 workspace 参数查看其他工作区，* 表示全部
+func AdminHealthHandler(cfg *config.Config) gin.HandlerFunc {
+	health := services.NewHealthService(cfg.Health, cfg.LLM)
+	return func(c *gin.Context) {
+		workspace, ok := adminWorkspace(c, true)
+		if !ok {
+			return
+		}
+		c.JSON(http.StatusOK, health.Check(c.Request.Context()).ForWorkspace(workspace))
+	}
+}
@@ -0,0 +1,72 @@
+package routes
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/middleware"
+	"d2t_server/internal/services"
+	"d2t_server/utils"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListMetricsHandler 返回语义层中定义的指标、维度和关联路径
+func ListMetricsHandler(c *gin.Context) {
+	catalog := services.NewMetricService().Catalog()
+
+	c.JSON(http.StatusOK, gin.H{
+		"metrics":    catalog.Metrics,
+		"dimensions": catalog.Dimensions,
+		"joins":      catalog.Joins,
+	})
+}
+
+// MetricQueryHandler 将指标请求确定性地编译为SQL并执行
+// 请求体中 dry_run 为 true 时只返回编译后的SQL
+func MetricQueryHandler(c *gin.Context) {
+	var req struct {
+		core.MetricQuery
+		DryRun bool `json:"dry_run"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	metricService := services.NewMetricService()
+	var sqlStr string
+	var args []interface{}
+	var results []map[string]interface{}
+	var err error
+	if req.DryRun {
+		sqlStr, args, err = metricService.Compile(req.MetricQuery)
+	} else {
+		sqlStr, results, err = metricService.Query(c.Request.Context(), middleware.GetPrincipal(c), req.MetricQuery)
+	}
+	switch {
+	case errors.Is(err, services.ErrInvalidMetricQuery):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, auth.ErrForbidden):
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNoSemanticLayer):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.DryRun {
+		c.JSON(http.StatusOK, gin.H{"sql": sqlStr, "args": args})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"results": utils.TrimStringValues(results),
+		"sql":     sqlStr,
+	})
+}
@@ -0,0 +1,60 @@
+package routes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricQueryHandlerValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/metrics/query", MetricQueryHandler)
+
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"unknown metric", `{"metrics": ["profit"]}`},
+		{"unknown dimension", `{"metrics": ["revenue"], "dimensions": ["planet"]}`},
+		{"unknown filter dimension", `{"metrics": ["revenue"], "filters": [{"dimension": "planet", "value": "x"}]}`},
+		{"unsupported operator", `{"metrics": ["revenue"], "filters": [{"dimension": "customer_state", "operator": "~", "value": "x"}]}`},
+		{"no metric", `{"metrics": []}`},
+	}
+
+	for _, tt := range tests {
+		for _, dryRun := range []bool{true, false} {
+			body := tt.body
+			if dryRun {
+				body = strings.Replace(body, "{", `{"dry_run": true, `, 1)
+			}
+			req := httptest.NewRequest(http.MethodPost, "/api/metrics/query", strings.NewReader(body))
+			req.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("%s (dry_run=%v): status %d, want 400: %s", tt.name, dryRun, w.Code, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestMetricQueryHandlerDryRun(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/metrics/query", MetricQueryHandler)
+
+	body := `{"metrics": ["revenue"], "dimensions": ["customer_state"], "dry_run": true}`
+	req := httptest.NewRequest(http.MethodPost, "/api/metrics/query", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "SELECT") {
+		t.Fatalf("status %d, body %s", w.Code, w.Body.String())
+	}
+}
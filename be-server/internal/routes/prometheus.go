@@ -0,0 +1,27 @@
+package routes
+
+import (
+	"crypto/subtle"
+	"d2t_server/internal/config"
+	"d2t_server/internal/metrics"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PrometheusHandler 输出 Prometheus 指标；配置了 METRICS_TOKEN 时要求 Authorization: Bearer <token>
+func PrometheusHandler(cfg config.MetricsConfig) gin.HandlerFunc {
+	handler := metrics.Handler()
+	return func(c *gin.Context) {
+		if cfg.Token != "" {
+			token, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+				c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+				c.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+		}
+		handler.ServeHTTP(c.Writer, c.Request)
+	}
+}
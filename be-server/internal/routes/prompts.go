@@ -0,0 +1,37 @@
+package routes
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/internal/prompts"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListPromptsHandler 列出可用的提示词模板版本，以及调用方工作区中某个数据源当前生效的版本
+func ListPromptsHandler(c *gin.Context) {
+	dataSource := c.DefaultQuery("data_source", config.DefaultDataSource)
+	workspace, ok := adminWorkspace(c, false)
+	if !ok {
+		return
+	}
+	ws, _ := config.GetWorkspaces().Get(workspace)
+
+	versions, err := prompts.Versions()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	active := make(map[string]string, len(versions))
+	for mode := range versions {
+		active[mode] = prompts.ActiveVersionFor(mode, dataSource, ws.PromptVersions)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"workspace":   workspace,
+		"data_source": dataSource,
+		"versions":    versions,
+		"active":      active,
+	})
+}
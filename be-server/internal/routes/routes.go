@@ -1,28 +1,105 @@
 package routes
 
 import (
+	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"d2t_server/internal/middleware"
+	"d2t_server/internal/models"
+	"d2t_server/internal/ratelimit"
 	"d2t_server/internal/services"
 	"d2t_server/utils"
-	"fmt"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
+// statusAnswer 问答响应的 status：已回答；需要澄清时为 models.HistoryStatusClarification
+const statusAnswer = "answer"
+
 // RegisterRoutes 注册所有路由
-func RegisterRoutes(r *gin.Engine) {
-	// 健康检查路由
+func RegisterRoutes(r *gin.Engine, cfg *config.Config) {
+	// 健康检查路由：/livez 只表示进程存活，/readyz 检查依赖（各组件详情见 /api/admin/health），/health 为兼容保留
 	r.GET("/health", HealthCheckHandler)
+	r.GET("/livez", LivezHandler)
+	r.GET("/readyz", ReadyzHandler(cfg))
 	r.GET("/ping", PingHandler)
 
-	// API 路由
-	api := r.Group("/api")
+	// Prometheus 指标
+	if cfg.Metrics.Enabled {
+		r.GET("/metrics", PrometheusHandler(cfg.Metrics))
+	}
+
+	// API 路由，全部需要认证，并按调用方限流
+	api := r.Group("/api", middleware.Authenticate(cfg.Auth), middleware.RateLimit(ratelimit.NewLimiter(cfg.RateLimit)))
+	{
+		ask := middleware.RequireScope(auth.ScopeAsk)
+		// 会调用大模型的接口受调用方和所属工作区的 token 预算限制
+		budget := middleware.TokenBudget(ratelimit.NewBudget(cfg.RateLimit))
+		workspaceBudget := middleware.WorkspaceTokenBudget(ratelimit.NewBudgetStore(cfg.RateLimit))
+		api.POST("/askQA", ask, budget, workspaceBudget, AskQAHandler)
+		api.POST("/history/:id/clarify", ask, budget, workspaceBudget, ClarifyHandler)
+		api.POST("/history/:id/feedback", ask, SubmitFeedbackHandler)
+		api.POST("/history/:id/execute", middleware.RequireScope(auth.ScopeExecuteSaved), ExecuteHistoryHandler)
+
+		// 语义层指标
+		api.GET("/metrics", ask, ListMetricsHandler)
+		api.POST("/metrics/query", ask, MetricQueryHandler)
+	}
+
+	// 管理接口
+	admin := api.Group("/admin", middleware.RequireScope(auth.ScopeAdmin))
 	{
-		api.POST("/askQA", AskQAHandler)
+		admin.GET("/api-keys", ListAPIKeysHandler)
+		admin.POST("/api-keys", CreateAPIKeyHandler)
+		admin.DELETE("/api-keys/:id", RevokeAPIKeyHandler)
+
+		admin.GET("/examples", ListExamplesHandler)
+		admin.POST("/examples", AddExampleHandler)
+		admin.DELETE("/examples/:id", DeleteExampleHandler)
+		admin.GET("/feedback/report", FeedbackReportHandler)
+		admin.POST("/feedback/:id/promote", PromoteFeedbackHandler)
+		admin.GET("/prompts", ListPromptsHandler)
+		admin.GET("/audit", ListAuditHandler)
+		admin.GET("/audit/export", ExportAuditHandler)
+		admin.DELETE("/cache", InvalidateCacheHandler)
+		admin.GET("/health", AdminHealthHandler(cfg))
 		// 其他API路由可以添加在这里
 	}
 }
 
+// ExecuteHistoryHandler 重新执行一条成功的查询历史中保存的SQL，不再调用大模型
+func ExecuteHistoryHandler(c *gin.Context) {
+	historyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid history id"})
+		return
+	}
+
+	history, results, err := services.NewQAService().ExecuteHistory(c.Request.Context(), middleware.GetPrincipal(c), historyID)
+	if errors.Is(err, services.ErrHistoryNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if errors.Is(err, auth.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"results":    utils.TrimStringValues(results),
+		"sql":        history.SQL,
+		"history_id": history.ID,
+	})
+}
+
 // PingHandler 处理Ping请求
 func PingHandler(c *gin.Context) {
 	c.String(http.StatusOK, "pong")
@@ -35,11 +112,12 @@ func HealthCheckHandler(c *gin.Context) {
 
 // AskQAHandler 处理问答请求
 func AskQAHandler(c *gin.Context) {
-	fmt.Println("==== /api/askQA was called ====")
-
 	// 定义请求结构体
 	var req struct {
-		Question string `json:"question"`
+		Question   string `json:"question"`
+		DataSource string `json:"data_source"`
+		// Candidates 生成的候选SQL数，大于 1 时按执行结果投票，不超过 SQL_MAX_CANDIDATES
+		Candidates int `json:"candidates" binding:"min=0"`
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -48,16 +126,91 @@ func AskQAHandler(c *gin.Context) {
 	}
 
 	// 使用服务层处理问题
-	qaService := services.NewQAService()
-	sqlStr, analysisResult, results, err := qaService.ProcessQuestion(req.Question)
+	result, err := services.NewQAService().ProcessQuestion(c.Request.Context(), services.QARequest{
+		Question:   req.Question,
+		DataSource: req.DataSource,
+		Candidates: req.Candidates,
+		Principal:  middleware.GetPrincipal(c),
+		Meter:      middleware.GetUsageMeter(c),
+	})
+	writeQAResult(c, result, err)
+}
+
+// ClarifyHandler 用用户对澄清问题的回答继续一次需要澄清的问答
+func ClarifyHandler(c *gin.Context) {
+	historyID, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid history id"})
+		return
+	}
+
+	// choice 可以是建议的选项之一，也可以是用户自己的回答
+	var req struct {
+		Choice string `json:"choice" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	choice := strings.TrimSpace(req.Choice)
+	if choice == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "choice must not be empty"})
+		return
+	}
+
+	result, err := services.NewQAService().ResumeClarification(c.Request.Context(), middleware.GetPrincipal(c), historyID, choice, middleware.GetUsageMeter(c))
+	switch {
+	case errors.Is(err, services.ErrHistoryNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	case errors.Is(err, services.ErrNotAwaitingClarification):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	writeQAResult(c, result, err)
+}
+
+// writeQAResult 写出问答结果：status 为 answer 时返回结果，为 needs_clarification 时返回澄清问题和建议选项
+func writeQAResult(c *gin.Context, result *services.QAResult, err error) {
+	if errors.Is(err, auth.ErrForbidden) {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":      err.Error(),
+			"history_id": result.HistoryID,
+		})
+		return
+	}
+	if errors.Is(err, core.ErrClarificationNeeded) {
+		c.JSON(http.StatusOK, gin.H{
+			"status": models.HistoryStatusClarification,
+			"clarification": gin.H{
+				"question": result.Details.Clarification,
+				"options":  result.Details.Options,
+			},
+			"history_id":     result.HistoryID,
+			"prompt_version": result.PromptVersion,
+			"usage":          result.Usage,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error":      err.Error(),
+			"history_id": result.HistoryID,
+		})
 		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"results":  utils.TrimStringValues(results),
-		"sql":      sqlStr,
-		"analysis": analysisResult,
+		"status":         statusAnswer,
+		"results":        utils.TrimStringValues(result.Results),
+		"sql":            result.SQL,
+		"analysis":       result.Analysis,
+		"history_id":     result.HistoryID,
+		"prompt_version": result.PromptVersion,
+		"usage":          result.Usage,
+		"cache":          result.Cache,
+		"generation":     result.Details,
+		"chart":          result.Chart,
+		"voting":         result.Voting,
 	})
 }
@@ -0,0 +1,19 @@
+package routes
+
+import (
+	"d2t_server/internal/middleware"
+	"d2t_server/internal/services"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// adminWorkspace 解析管理接口的 workspace 查询参数，无权访问时写入 403 响应并返回 false
+func adminWorkspace(c *gin.Context, allowAll bool) (string, bool) {
+	workspace, err := services.AdminWorkspace(middleware.GetPrincipal(c), c.Query("workspace"), allowAll)
+	if err != nil {
+		c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return "", false
+	}
+	return workspace, true
+}
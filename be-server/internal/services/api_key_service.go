@@ -0,0 +1,104 @@
+package services
+
+import (
+	"d2t_server/internal/auth"
+	"d2t_server/internal/models"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidAPIKey API Key不存在或已被吊销
+var ErrInvalidAPIKey = errors.New("invalid or revoked API key")
+
+// APIKeyService 管理API Key并校验调用方
+type APIKeyService struct {
+}
+
+// NewAPIKeyService 创建一个新的APIKeyService实例
+func NewAPIKeyService() *APIKeyService {
+	return &APIKeyService{}
+}
+
+// Create 在工作区中创建API Key，返回的明文只出现这一次
+func (s *APIKeyService) Create(workspace, name string, scopes []string) (string, *models.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, fmt.Errorf("name 不能为空")
+	}
+	if err := auth.ValidateScopes(scopes); err != nil {
+		return "", nil, err
+	}
+
+	plaintext, err := auth.GenerateAPIKey()
+	if err != nil {
+		return "", nil, err
+	}
+
+	db, err := models.GetAppDB()
+	if err != nil {
+		return "", nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	key := &models.APIKey{
+		Workspace: workspace,
+		Name:      name,
+		Prefix:    auth.DisplayPrefix(plaintext),
+		KeyHash:   auth.HashAPIKey(plaintext),
+		Scopes:    scopes,
+	}
+	if err := models.InsertAPIKey(db, key); err != nil {
+		return "", nil, err
+	}
+	return plaintext, key, nil
+}
+
+// List 列出工作区的API Key，workspace 为空时列出全部
+func (s *APIKeyService) List(workspace string) ([]models.APIKey, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+	return models.ListAPIKeys(db, workspace)
+}
+
+// Revoke 吊销工作区的API Key，workspace 为空时不限工作区
+func (s *APIKeyService) Revoke(workspace string, id int64) (bool, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return false, fmt.Errorf("数据库连接失败: %w", err)
+	}
+	return models.RevokeAPIKey(db, workspace, id)
+}
+
+// Authenticate 校验API Key明文并返回对应的调用方
+func (s *APIKeyService) Authenticate(plaintext string) (*auth.Principal, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	key, err := models.FindActiveAPIKeyByHash(db, auth.HashAPIKey(plaintext))
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, ErrInvalidAPIKey
+	}
+
+	go func(id int64) {
+		if err := models.TouchAPIKey(db, id); err != nil {
+			slog.Warn("failed to update api key last use", "api_key_id", id, "error", err)
+		}
+	}(key.ID)
+
+	return &auth.Principal{
+		Type:      auth.PrincipalAPIKey,
+		ID:        strconv.FormatInt(key.ID, 10),
+		Name:      key.Name,
+		Scopes:    key.Scopes,
+		Workspace: key.Workspace,
+	}, nil
+}
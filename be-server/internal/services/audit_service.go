@@ -0,0 +1,53 @@
+package services
+
+import (
+	"d2t_server/internal/models"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// 审计日志查询的默认和最大条数
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// AuditService 查询和导出审计日志
+type AuditService struct {
+}
+
+// NewAuditService 创建一个新的AuditService实例
+func NewAuditService() *AuditService {
+	return &AuditService{}
+}
+
+// List 按条件倒序返回审计记录，条数限制在 1..1000，默认 100
+func (s *AuditService) List(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+	return models.ListAuditEntries(db, filter)
+}
+
+// Export 以 NDJSON（每行一条 JSON 记录）格式把符合条件的全部审计记录写入 w，
+// filter.Limit 为 0 时不限制条数
+func (s *AuditService) Export(filter models.AuditFilter, w io.Writer) error {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	encoder := json.NewEncoder(w)
+	return models.StreamAuditEntries(db, filter, func(e *models.AuditEntry) error {
+		return encoder.Encode(e)
+	})
+}
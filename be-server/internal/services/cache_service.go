@@ -0,0 +1,39 @@
+package services
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/cache"
+	"d2t_server/internal/models"
+	"log/slog"
+)
+
+// CacheService 管理问答缓存
+type CacheService struct {
+}
+
+// NewCacheService 创建一个新的CacheService实例
+func NewCacheService() *CacheService {
+	return &CacheService{}
+}
+
+// Invalidate 删除工作区中缓存的SQL和查询结果；workspace 为空表示全部工作区，
+// dataSource、question 为空表示不限，question 按问答时的规则规范化后匹配
+func (s *CacheService) Invalidate(workspace, dataSource, question string) (int64, error) {
+	return cache.Default().Invalidate(cache.Filter{
+		Workspace:  workspace,
+		DataSource: dataSource,
+		Question:   core.NormalizeQuestion(question),
+	})
+}
+
+// invalidateAnswer 用户反馈某次回答有误时删除该问题的缓存，下次提问重新生成；失败只记录日志
+func invalidateAnswer(history *models.QueryHistory) {
+	n, err := NewCacheService().Invalidate(history.Workspace, history.DataSource, history.Question)
+	if err != nil {
+		slog.Warn("failed to invalidate answer cache", "history_id", history.ID, "error", err)
+		return
+	}
+	if n > 0 {
+		slog.Info("answer cache invalidated by feedback", "history_id", history.ID, "entries", n)
+	}
+}
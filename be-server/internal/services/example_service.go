@@ -0,0 +1,159 @@
+package services
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"d2t_server/utils"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+)
+
+// defaultExampleCount 每个问题最多放入提示词的示例数量
+const defaultExampleCount = 3
+
+// exampleExplainTimeout 校验示例SQL时 EXPLAIN 的语句超时
+const exampleExplainTimeout = 5 * time.Second
+
+// ErrInvalidExample 示例缺少问题或SQL、数据源不存在，或SQL未通过检查，路由层据此返回 400
+var ErrInvalidExample = errors.New("invalid example")
+
+var seedExamplesOnce sync.Once
+
+// ExampleService 管理few-shot示例库并为问题挑选相似示例
+type ExampleService struct {
+}
+
+// NewExampleService 创建一个新的ExampleService实例
+func NewExampleService() *ExampleService {
+	return &ExampleService{}
+}
+
+// seed 进程内首次使用示例库时向 default 工作区写入种子示例（已存在的问题不会被覆盖）
+func (s *ExampleService) seed() {
+	seedExamplesOnce.Do(func() {
+		seeds, err := config.GetExampleSeeds()
+		if err != nil {
+			slog.Warn("failed to load example seeds", "error", err)
+			return
+		}
+
+		db, err := models.GetAppDB()
+		if err != nil {
+			slog.Warn("failed to seed examples", "error", err)
+			return
+		}
+
+		for _, seed := range seeds {
+			err := models.SeedExample(db, models.Example{
+				Workspace:  config.DefaultWorkspace,
+				DataSource: seed.DataSource,
+				Question:   seed.Question,
+				SQL:        seed.SQL,
+				Source:     "seed",
+			})
+			if err != nil {
+				slog.Warn("failed to seed example", "data_source", seed.DataSource, "error", err)
+			}
+		}
+	})
+}
+
+// List 返回工作区中某个数据源下的全部示例
+func (s *ExampleService) List(workspace, dataSource string) ([]models.Example, error) {
+	s.seed()
+
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+	return models.ListExamples(db, workspace, dataSource)
+}
+
+// Add 在 example.Workspace 中新增或更新一个已验证的示例，数据源必须属于该工作区
+func (s *ExampleService) Add(example *models.Example) error {
+	example.Question = strings.TrimSpace(example.Question)
+	example.SQL = strings.TrimSpace(example.SQL)
+	if example.Question == "" || example.SQL == "" {
+		return fmt.Errorf("%w: question 和 sql 不能为空", ErrInvalidExample)
+	}
+	if example.DataSource == "" {
+		example.DataSource = config.DefaultDataSource
+	}
+	if example.Source == "" {
+		example.Source = "manual"
+	}
+	ws, ok := config.GetWorkspaces().Get(example.Workspace)
+	if !ok {
+		return fmt.Errorf("%w: 未知的工作区: %s", ErrInvalidExample, example.Workspace)
+	}
+	ds, ok := ws.DataSource(example.DataSource)
+	if !ok {
+		return fmt.Errorf("%w: 工作区 %s 中没有数据源 %s", ErrInvalidExample, ws.Name, example.DataSource)
+	}
+	if err := validateExampleSQL(ds, example.SQL); err != nil {
+		return err
+	}
+
+	db, err := models.GetAppDB()
+	if err != nil {
+		return fmt.Errorf("数据库连接失败: %w", err)
+	}
+	return models.InsertExample(db, example)
+}
+
+// validateExampleSQL 示例会进入工作区所有调用方的提示词，并被语义缓存原样复用，
+// 因此SQL必须通过与生成SQL相同的检查（不按角色限制），并能在数据源上通过 EXPLAIN（只规划、不执行）
+func validateExampleSQL(ds *config.DataSourceConfig, sqlStr string) error {
+	if err := auth.AuthorizeSQL(nil, config.GetAccessPolicy(), core.SchemaFor(ds.Schema), sqlStr); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExample, err)
+	}
+
+	db, err := models.GetDataSourceDB(ds.DSN)
+	if err != nil {
+		return fmt.Errorf("数据库连接失败: %w", err)
+	}
+	limits := models.ExecLimits{Timeout: exampleExplainTimeout}
+	if _, err := models.ExecuteSQLLimited(db, "", nil, limits, "EXPLAIN "+sqlStr); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExample, err)
+	}
+	return nil
+}
+
+// Remove 删除工作区中的一个示例
+func (s *ExampleService) Remove(workspace string, id int64) (bool, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return false, fmt.Errorf("数据库连接失败: %w", err)
+	}
+	return models.DeleteExample(db, workspace, id)
+}
+
+// Verified 返回工作区中某个数据源下调用方可以使用的已验证示例；示例库不可用时返回空，不影响主流程。
+// access 不为 nil 时按数据源表结构 schema 跳过引用了调用方无权访问的表或列的示例，避免通过示例泄露
+func (s *ExampleService) Verified(workspace, dataSource string, access core.AccessChecker, schema *core.Schema) []utils.FewShotExample {
+	examples, err := s.List(workspace, dataSource)
+	if err != nil {
+		slog.Warn("few-shot examples unavailable", "workspace", workspace, "data_source", dataSource, "error", err)
+		return nil
+	}
+
+	verified := make([]utils.FewShotExample, 0, len(examples))
+	for _, e := range examples {
+		if access != nil && core.CheckSQLAccess(e.SQL, schema, access) != nil {
+			continue
+		}
+		verified = append(verified, utils.FewShotExample{Question: e.Question, SQL: e.SQL})
+	}
+	return verified
+}
+
+// SelectFor 从调用方可以使用的示例中为问题挑选最相似的几个
+func (s *ExampleService) SelectFor(question string, verified []utils.FewShotExample) []utils.FewShotExample {
+	return core.SelectSimilarExamples(question, verified, defaultExampleCount)
+}
@@ -0,0 +1,25 @@
+package services
+
+import (
+	"d2t_server/internal/config"
+	"errors"
+	"testing"
+)
+
+// TestValidateExampleSQL checks that SQL which must never reach the example
+// bank is rejected before the data source is contacted
+func TestValidateExampleSQL(t *testing.T) {
+	ds := &config.DataSourceConfig{Name: config.DefaultDataSource, Schema: config.DatabaseSchema}
+	for _, sqlStr := range []string{
+		"DELETE FROM Customers",
+		"SELECT cust_name FROM Customers; DROP TABLE Orders",
+		"SELECT key_hash FROM d2t_api_keys",
+		"SELECT a.query FROM pg_stat_activity a",
+		"SELECT setval('orders_order_num_seq', 1)",
+		"SELECT cust_nmae FROM Customers",
+	} {
+		if err := validateExampleSQL(ds, sqlStr); !errors.Is(err, ErrInvalidExample) {
+			t.Errorf("%q: got %v, want ErrInvalidExample", sqlStr, err)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package services
+
+import (
+	"context"
+	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"d2t_server/internal/metrics"
+	"d2t_server/internal/models"
+	"d2t_server/internal/requestid"
+	"d2t_server/internal/tracing"
+	"errors"
+	"log/slog"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Statement 一条待执行的SQL及其来源
+type Statement struct {
+	Principal  *auth.Principal
+	DataSource string
+	// Source 执行路径：models.AuditSourceAsk / AuditSourceHistory / AuditSourceMetric
+	Source string
+	SQL    string
+	Args   []interface{}
+	// Limits 执行候选SQL等不确定是否正确的语句时的超时和行数限制，nil 表示不限制
+	Limits *models.ExecLimits
+	// BeforeMask 不为 nil 时在执行成功后、脱敏之前用原始结果调用，只用于比较结果（如候选投票的结果指纹），
+	// 不得保留或返回原始值
+	BeforeMask func(results []map[string]interface{})
+}
+
+// runStatement 授权、执行SQL并写入审计日志；所有执行路径都必须经过这里，
+// 被拒绝的语句同样记录（状态为 denied），不执行SQL直接返回缓存结果时用 recordCachedResult 记录
+func runStatement(ctx context.Context, stmt Statement) ([]map[string]interface{}, error) {
+	ctx, span := tracing.Start(ctx, "sql.statement",
+		attribute.String("db.system", "postgresql"),
+		attribute.String("d2t.source", stmt.Source),
+		attribute.String("d2t.data_source", stmt.DataSource),
+		attribute.String("d2t.statement.hash", tracing.StatementHash(stmt.SQL)))
+
+	start := time.Now()
+	entry := newAuditEntry(ctx, stmt, models.AuditStatusSuccess)
+	results, err := authorizeAndExecute(ctx, stmt)
+
+	duration := time.Since(start)
+	entry.DurationMs = duration.Milliseconds()
+	entry.RowCount = len(results)
+	if err != nil {
+		entry.Status = models.AuditStatusError
+		stage := metrics.StageExecution
+		if errors.Is(err, auth.ErrForbidden) {
+			entry.Status = models.AuditStatusDenied
+			stage = metrics.StageValidation
+		}
+		entry.Error = err.Error()
+		metrics.PipelineError(stage)
+	}
+	metrics.ObserveSQL(stmt.Source, stmt.DataSource, entry.Status, duration, len(results))
+	span.SetAttributes(attribute.String("d2t.status", entry.Status), attribute.Int("db.rows", len(results)))
+	tracing.End(span, err)
+	recordAudit(ctx, entry)
+
+	return results, err
+}
+
+// recordCachedResult 为直接从问答缓存返回的结果写入审计记录（状态为 cached），
+// 没有执行SQL的请求同样能追查到谁拿到了哪条SQL的结果
+func recordCachedResult(ctx context.Context, stmt Statement, rowCount int) {
+	entry := newAuditEntry(ctx, stmt, models.AuditStatusCached)
+	entry.RowCount = rowCount
+	recordAudit(ctx, entry)
+}
+
+// newAuditEntry 按语句和调用方填写审计记录
+func newAuditEntry(ctx context.Context, stmt Statement, status string) *models.AuditEntry {
+	entry := &models.AuditEntry{
+		Workspace:  stmt.Principal.WorkspaceName(),
+		RequestID:  requestid.FromContext(ctx),
+		DataSource: stmt.DataSource,
+		Source:     stmt.Source,
+		SQL:        stmt.SQL,
+		Params:     stmt.Args,
+		Status:     status,
+	}
+	if p := stmt.Principal; p != nil {
+		entry.PrincipalType = p.Type
+		entry.PrincipalID = p.ID
+		entry.PrincipalName = p.Name
+	}
+	return entry
+}
+
+// authorizeAndExecute 只在调用方所属工作区的数据源上执行，执行前检查SQL只访问了角色允许的表和列
+func authorizeAndExecute(ctx context.Context, stmt Statement) ([]map[string]interface{}, error) {
+	_, span := tracing.Start(ctx, "sql.validate")
+	_, ds, err := auth.ResolveDataSource(stmt.Principal, stmt.DataSource)
+	if err == nil {
+		err = auth.AuthorizeSQL(stmt.Principal, config.GetAccessPolicy(), core.SchemaFor(ds.Schema), stmt.SQL)
+	}
+	tracing.End(span, err)
+	if err != nil {
+		return nil, err
+	}
+
+	_, span = tracing.Start(ctx, "sql.execute")
+	results, err := executeForPrincipal(stmt.Principal, ds, stmt.Limits, stmt.BeforeMask, stmt.SQL, stmt.Args...)
+	span.SetAttributes(attribute.Int("db.rows", len(results)))
+	tracing.End(span, err)
+	return results, err
+}
+
+// recordAudit 追加审计记录，失败时记录错误日志
+func recordAudit(ctx context.Context, entry *models.AuditEntry) {
+	db, err := models.GetAppDB()
+	if err == nil {
+		err = models.InsertAuditEntry(db, entry)
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to write audit log", "error", err)
+	}
+}
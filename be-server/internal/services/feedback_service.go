@@ -0,0 +1,257 @@
+package services
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/models"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 反馈相关的业务错误，路由层据此返回 4xx
+var (
+	ErrInvalidRating    = errors.New(`rating must be "up" or "down"`)
+	ErrHistoryNotFound  = errors.New("query history not found")
+	ErrFeedbackNotFound = errors.New("feedback not found")
+	ErrNothingToPromote = errors.New("feedback has neither corrected SQL nor a positive rating")
+)
+
+// FeedbackInput 用户提交的反馈
+type FeedbackInput struct {
+	Rating       string `json:"rating"`
+	CorrectedSQL string `json:"corrected_sql"`
+	Comment      string `json:"comment"`
+}
+
+// FailureStat 某个分组下的失败率
+type FailureStat struct {
+	Key         string  `json:"key"`
+	Total       int     `json:"total"`
+	ThumbsUp    int     `json:"thumbs_up"`
+	ThumbsDown  int     `json:"thumbs_down"`
+	Errors      int     `json:"errors"`
+	Corrected   int     `json:"corrected"`
+	Failures    int     `json:"failures"`
+	FailureRate float64 `json:"failure_rate"`
+}
+
+// FeedbackReport 反馈报表
+type FeedbackReport struct {
+	Since           time.Time     `json:"since"`
+	Total           int           `json:"total"`
+	Failures        int           `json:"failures"`
+	ByTable         []FailureStat `json:"by_table"`
+	ByPattern       []FailureStat `json:"by_pattern"`
+	ByPromptVersion []FailureStat `json:"by_prompt_version"`
+}
+
+// FeedbackService 处理用户反馈及其统计
+type FeedbackService struct {
+	examples *ExampleService
+}
+
+// NewFeedbackService 创建一个新的FeedbackService实例
+func NewFeedbackService() *FeedbackService {
+	return &FeedbackService{examples: NewExampleService()}
+}
+
+// Submit 为工作区中的一条查询历史记录反馈，其他工作区的历史视为不存在
+func (s *FeedbackService) Submit(workspace string, historyID int64, input FeedbackInput) (*models.Feedback, error) {
+	rating := strings.ToLower(strings.TrimSpace(input.Rating))
+	if rating != models.RatingUp && rating != models.RatingDown {
+		return nil, ErrInvalidRating
+	}
+
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	history, err := models.GetQueryHistory(db, workspace, historyID)
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		return nil, ErrHistoryNotFound
+	}
+
+	feedback := &models.Feedback{
+		HistoryID:    historyID,
+		Rating:       rating,
+		CorrectedSQL: strings.TrimSpace(input.CorrectedSQL),
+		Comment:      strings.TrimSpace(input.Comment),
+	}
+	if err := models.InsertFeedback(db, feedback); err != nil {
+		return nil, err
+	}
+	if feedback.Rating == models.RatingDown || feedback.CorrectedSQL != "" {
+		invalidateAnswer(history)
+	}
+	return feedback, nil
+}
+
+// Promote 将工作区中一条反馈的修正SQL（或被点赞的原始SQL）加入该工作区的示例库；
+// SQL由 ExampleService.Add 校验，未通过时返回 ErrInvalidExample
+func (s *FeedbackService) Promote(workspace string, feedbackID int64) (*models.Example, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	feedback, err := models.GetFeedback(db, workspace, feedbackID)
+	if err != nil {
+		return nil, err
+	}
+	if feedback == nil {
+		return nil, ErrFeedbackNotFound
+	}
+
+	history, err := models.GetQueryHistory(db, workspace, feedback.HistoryID)
+	if err != nil {
+		return nil, err
+	}
+	if history == nil {
+		return nil, ErrHistoryNotFound
+	}
+
+	sqlStr := feedback.CorrectedSQL
+	if sqlStr == "" && feedback.Rating == models.RatingUp && history.Status == models.HistoryStatusSuccess {
+		sqlStr = history.SQL
+	}
+	if sqlStr == "" {
+		return nil, ErrNothingToPromote
+	}
+
+	example := &models.Example{
+		Workspace:  history.Workspace,
+		DataSource: history.DataSource,
+		Question:   history.Question,
+		SQL:        sqlStr,
+		Source:     "feedback",
+	}
+	if err := s.examples.Add(example); err != nil {
+		return nil, err
+	}
+	if err := models.MarkFeedbackPromoted(db, feedbackID); err != nil {
+		return nil, err
+	}
+	return example, nil
+}
+
+// Report 统计工作区中指定时间之后按表、问题模式和提示词版本分组的失败率
+// 失败指：执行出错、被点踩或提交了修正SQL
+func (s *FeedbackService) Report(workspace string, since time.Time) (*FeedbackReport, error) {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	records, err := models.ListFeedbackRecords(db, workspace, since)
+	if err != nil {
+		return nil, err
+	}
+
+	// 同一条历史可能有多条反馈，按历史ID合并
+	type outcome struct {
+		history   models.QueryHistory
+		up        bool
+		down      bool
+		corrected bool
+	}
+	var order []int64
+	outcomes := make(map[int64]*outcome)
+	for _, r := range records {
+		o, ok := outcomes[r.History.ID]
+		if !ok {
+			o = &outcome{history: r.History}
+			outcomes[r.History.ID] = o
+			order = append(order, r.History.ID)
+		}
+		if r.Feedback != nil {
+			o.up = o.up || r.Feedback.Rating == models.RatingUp
+			o.down = o.down || r.Feedback.Rating == models.RatingDown
+			o.corrected = o.corrected || r.Feedback.CorrectedSQL != ""
+		}
+	}
+
+	report := &FeedbackReport{Since: since}
+	byTable := make(map[string]*FailureStat)
+	byPattern := make(map[string]*FailureStat)
+	byPromptVersion := make(map[string]*FailureStat)
+
+	add := func(stats map[string]*FailureStat, key string, o *outcome, failed bool) {
+		st, ok := stats[key]
+		if !ok {
+			st = &FailureStat{Key: key}
+			stats[key] = st
+		}
+		st.Total++
+		if o.up {
+			st.ThumbsUp++
+		}
+		if o.down {
+			st.ThumbsDown++
+		}
+		if o.history.Status == models.HistoryStatusError {
+			st.Errors++
+		}
+		if o.corrected {
+			st.Corrected++
+		}
+		if failed {
+			st.Failures++
+		}
+	}
+
+	for _, id := range order {
+		o := outcomes[id]
+		failed := o.down || o.corrected || o.history.Status == models.HistoryStatusError
+		report.Total++
+		if failed {
+			report.Failures++
+		}
+
+		tables := core.ExtractTables(o.history.SQL)
+		if len(tables) == 0 {
+			tables = []string{"(none)"}
+		}
+		for _, t := range tables {
+			add(byTable, t, o, failed)
+		}
+		add(byPattern, core.QuestionPattern(o.history.Question), o, failed)
+
+		version := o.history.PromptVersion
+		if version == "" {
+			version = "(unknown)"
+		}
+		add(byPromptVersion, version, o, failed)
+	}
+
+	report.ByTable = sortedFailureStats(byTable)
+	report.ByPattern = sortedFailureStats(byPattern)
+	report.ByPromptVersion = sortedFailureStats(byPromptVersion)
+	return report, nil
+}
+
+// sortedFailureStats 计算失败率并按失败率、总数降序排列
+func sortedFailureStats(stats map[string]*FailureStat) []FailureStat {
+	list := make([]FailureStat, 0, len(stats))
+	for _, st := range stats {
+		if st.Total > 0 {
+			st.FailureRate = float64(st.Failures) / float64(st.Total)
+		}
+		list = append(list, *st)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].FailureRate != list[j].FailureRate {
+			return list[i].FailureRate > list[j].FailureRate
+		}
+		if list[i].Total != list[j].Total {
+			return list[i].Total > list[j].Total
+		}
+		return list[i].Key < list[j].Key
+	})
+	return list
+}
@@ -0,0 +1,287 @@
+package services
+
+import (
+	"context"
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"d2t_server/internal/logging"
+	"d2t_server/internal/models"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 整体就绪状态：有关键依赖失败时为 unavailable，只有非关键依赖失败时为 degraded
+const (
+	HealthOK          = "ok"
+	HealthDegraded    = "degraded"
+	HealthUnavailable = "unavailable"
+)
+
+// 单个组件的状态
+const (
+	ComponentOK   = "ok"
+	ComponentFail = "fail"
+)
+
+// ComponentHealth 一个依赖的检查结果
+type ComponentHealth struct {
+	Status string `json:"status"`
+	// Critical 关键依赖失败时 /readyz 返回 503
+	Critical  bool      `json:"critical"`
+	LatencyMs int64     `json:"latency_ms"`
+	CheckedAt time.Time `json:"checked_at"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// HealthReport 就绪检查结果，按组件列出
+type HealthReport struct {
+	Status     string                     `json:"status"`
+	Timestamp  time.Time                  `json:"timestamp"`
+	Components map[string]ComponentHealth `json:"components"`
+}
+
+// Ready 是否没有关键依赖失败
+func (r *HealthReport) Ready() bool {
+	return r.Status != HealthUnavailable
+}
+
+// ForWorkspace 只保留共享依赖（应用库、大模型服务）和指定工作区的数据源组件，workspace 为空时保留全部；
+// 整体状态不变，仍反映所有依赖
+func (r *HealthReport) ForWorkspace(workspace string) *HealthReport {
+	if workspace == "" {
+		return r
+	}
+	filtered := &HealthReport{Status: r.Status, Timestamp: r.Timestamp, Components: make(map[string]ComponentHealth)}
+	for name, component := range r.Components {
+		_, target, _ := strings.Cut(name, ":")
+		if ws, _, scoped := strings.Cut(target, "/"); !scoped || ws == workspace {
+			filtered.Components[name] = component
+		}
+	}
+	return filtered
+}
+
+// healthCheck 一项依赖检查
+type healthCheck struct {
+	name     string
+	critical bool
+	ttl      time.Duration
+	run      func(ctx context.Context) error
+}
+
+var (
+	// healthCache 各组件最近一次的检查结果，失败的结果同样缓存，避免探针在依赖故障时反复重试
+	healthCache   = make(map[string]ComponentHealth)
+	healthCacheMu sync.Mutex
+)
+
+// HealthService 检查数据库、数据源表结构和大模型服务是否可用
+type HealthService struct {
+	cfg config.HealthConfig
+	llm config.LLMConfig
+}
+
+// NewHealthService 创建一个新的HealthService实例
+func NewHealthService(cfg config.HealthConfig, llm config.LLMConfig) *HealthService {
+	return &HealthService{cfg: cfg, llm: llm}
+}
+
+// Check 返回各依赖的状态；缓存未过期的组件直接使用缓存，其余并发检查，每项不超过配置的超时时间。
+// 同一时间只有一次检查在进行，并发的探针等待它的结果
+func (s *HealthService) Check(ctx context.Context) *HealthReport {
+	healthCacheMu.Lock()
+	defer healthCacheMu.Unlock()
+
+	now := time.Now()
+	checks := s.checks()
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	for _, check := range checks {
+		if cached, ok := healthCache[check.name]; ok && now.Sub(cached.CheckedAt) < check.ttl {
+			continue
+		}
+		wg.Add(1)
+		go func(check healthCheck) {
+			defer wg.Done()
+			result := s.run(ctx, check)
+			mu.Lock()
+			healthCache[check.name] = result
+			mu.Unlock()
+		}(check)
+	}
+	wg.Wait()
+
+	report := &HealthReport{Status: HealthOK, Timestamp: now, Components: make(map[string]ComponentHealth, len(checks))}
+	for _, check := range checks {
+		result := healthCache[check.name]
+		report.Components[check.name] = result
+		if result.Status == ComponentOK {
+			continue
+		}
+		if result.Critical {
+			report.Status = HealthUnavailable
+		} else if report.Status == HealthOK {
+			report.Status = HealthDegraded
+		}
+	}
+	return report
+}
+
+// run 执行一项检查；检查本身不响应取消（例如首次建立连接池时）也会在超时后返回失败。
+// 结果会被缓存，因此不随探针请求断开而取消
+func (s *HealthService) run(ctx context.Context, check healthCheck) ComponentHealth {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), s.cfg.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	done := make(chan error, 1)
+	go func() { done <- check.run(ctx) }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %v", s.cfg.Timeout)
+	}
+
+	result := ComponentHealth{
+		Status:    ComponentOK,
+		Critical:  check.critical,
+		LatencyMs: time.Since(start).Milliseconds(),
+		CheckedAt: time.Now(),
+	}
+	if err != nil {
+		result.Status = ComponentFail
+		result.Error = logging.Redact(err.Error())
+	}
+	return result
+}
+
+// checks 列出需要检查的依赖：应用库、每个独立的数据源连接、每个数据源的表结构，以及大模型服务
+func (s *HealthService) checks() []healthCheck {
+	registry := config.GetWorkspaces()
+	pools := registry.PoolNames()
+
+	checks := []healthCheck{{
+		name:     "database:" + config.SharedPool,
+		critical: true,
+		ttl:      s.cfg.CacheTTL,
+		run:      pingAppDB,
+	}}
+
+	dsns := make([]string, 0, len(pools))
+	for dsn := range pools {
+		if dsn != "" {
+			dsns = append(dsns, dsn)
+		}
+	}
+	sort.Strings(dsns)
+	for _, dsn := range dsns {
+		checks = append(checks, healthCheck{
+			name:     "database:" + pools[dsn],
+			critical: true,
+			ttl:      s.cfg.CacheTTL,
+			run:      pingDataSource(dsn),
+		})
+	}
+
+	// 表结构与数据库不一致时问答仍可能对其他表成功，因此不是关键依赖
+	for _, wsName := range registry.Names() {
+		ws, _ := registry.Get(wsName)
+		for _, dsName := range ws.DataSourceNames() {
+			ds, _ := ws.DataSource(dsName)
+			checks = append(checks, healthCheck{
+				name: "schema:" + wsName + "/" + dsName,
+				ttl:  s.cfg.CacheTTL,
+				run:  checkSchema(ds),
+			})
+		}
+	}
+
+	if s.cfg.LLMURL != "" {
+		checks = append(checks, healthCheck{
+			name:     "llm:" + s.llm.Provider,
+			critical: s.cfg.LLMCritical,
+			ttl:      s.cfg.LLMCacheTTL,
+			run:      s.checkLLM,
+		})
+	}
+	return checks
+}
+
+// pingAppDB 检查应用库可连接且应用表已创建
+func pingAppDB(ctx context.Context) error {
+	db, err := models.GetAppDB()
+	if err != nil {
+		return err
+	}
+	return db.PingContext(ctx)
+}
+
+// pingDataSource 检查数据源连接
+func pingDataSource(dsn string) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		db, err := models.GetDataSourceDB(dsn)
+		if err != nil {
+			return err
+		}
+		return db.PingContext(ctx)
+	}
+}
+
+// checkSchema 检查提供给大模型的表结构中的表在数据源中都存在，发现表结构文件已过时
+func checkSchema(ds *config.DataSourceConfig) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		schema := core.SchemaFor(ds.Schema)
+		if len(schema.Tables) == 0 {
+			return fmt.Errorf("schema defines no tables")
+		}
+
+		db, err := models.GetDataSourceDB(ds.DSN)
+		if err != nil {
+			return err
+		}
+		existing, err := models.ListTables(ctx, db)
+		if err != nil {
+			return err
+		}
+
+		var missing []string
+		for _, t := range schema.Tables {
+			if !existing[strings.ToLower(t.Name)] {
+				missing = append(missing, t.Name)
+			}
+		}
+		if len(missing) > 0 {
+			return fmt.Errorf("tables missing from the database: %s", strings.Join(missing, ", "))
+		}
+		return nil
+	}
+}
+
+// checkLLM 请求大模型服务的模型列表：不消耗 token，可以同时发现服务不可达和 API Key 无效
+func (s *HealthService) checkLLM(ctx context.Context) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.cfg.LLMURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+s.llm.APIKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("provider rejected the API key (status %d)", resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("provider returned status %d", resp.StatusCode)
+	}
+	return nil
+}
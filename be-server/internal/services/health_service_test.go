@@ -0,0 +1,47 @@
+package services
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestHealthReportForWorkspace(t *testing.T) {
+	report := &HealthReport{Status: HealthUnavailable, Components: map[string]ComponentHealth{
+		"database:shared":       {Status: ComponentOK, Critical: true},
+		"database:sales/crm":    {Status: ComponentOK, Critical: true},
+		"database:support/desk": {Status: ComponentFail, Critical: true, Error: "connection refused"},
+		"schema:sales/default":  {Status: ComponentOK},
+		"schema:support/desk":   {Status: ComponentOK},
+		"llm:openai":            {Status: ComponentOK},
+	}}
+
+	tests := []struct {
+		workspace string
+		want      []string
+	}{
+		{"sales", []string{"database:sales/crm", "database:shared", "llm:openai", "schema:sales/default"}},
+		{"default", []string{"database:shared", "llm:openai"}},
+		{"", []string{"database:sales/crm", "database:shared", "database:support/desk", "llm:openai", "schema:sales/default", "schema:support/desk"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.workspace, func(t *testing.T) {
+			got := report.ForWorkspace(tt.workspace)
+			if got.Status != HealthUnavailable {
+				t.Errorf("status = %s, want the overall status %s", got.Status, HealthUnavailable)
+			}
+			var names []string
+			for name := range got.Components {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			if len(names) != len(tt.want) {
+				t.Fatalf("components = %v, want %v", names, tt.want)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Fatalf("components = %v, want %v", names, tt.want)
+				}
+			}
+		})
+	}
+}
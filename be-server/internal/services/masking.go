@@ -0,0 +1,29 @@
+package services
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"log/slog"
+)
+
+// maskResults 按敏感字段策略和调用方角色对查询结果脱敏；
+// 无法分析SQL的列来源时按最严格的方式处理全部文本列
+func maskResults(principal *auth.Principal, schema *core.Schema, sqlStr string, results []map[string]interface{}) {
+	policy := config.GetPIIPolicy()
+	if len(results) == 0 || len(policy.Columns) == 0 {
+		return
+	}
+
+	lineage, err := core.ResultLineage(sqlStr, schema)
+	if err != nil {
+		slog.Warn("cannot trace result columns, masking all text columns", "error", err)
+		lineage = nil
+	}
+
+	var roles []string
+	if principal != nil {
+		roles = principal.Roles
+	}
+	core.MaskResults(results, lineage, policy, roles)
+}
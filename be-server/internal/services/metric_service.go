@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"errors"
+	"fmt"
+)
+
+// ErrNoSemanticLayer 工作区的 default 数据源使用自定义表结构，内置语义层不适用
+var ErrNoSemanticLayer = errors.New("the semantic layer is not available for this workspace")
+
+// ErrInvalidMetricQuery 指标查询引用了未定义的指标、维度或不支持的过滤条件
+var ErrInvalidMetricQuery = errors.New("invalid metric query")
+
+// MetricService 处理语义层指标相关的业务逻辑
+type MetricService struct {
+	layer *config.SemanticLayer
+}
+
+// NewMetricService 创建一个新的MetricService实例
+func NewMetricService() *MetricService {
+	return &MetricService{layer: config.GetSemanticLayer()}
+}
+
+// Catalog 返回可供发现的指标、维度和关联路径
+func (s *MetricService) Catalog() *config.SemanticLayer {
+	return s.layer
+}
+
+// Compile 将指标查询编译为SQL，不执行
+func (s *MetricService) Compile(q core.MetricQuery) (string, []interface{}, error) {
+	sqlStr, args, err := core.CompileMetricQuery(s.layer, q)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidMetricQuery, err)
+	}
+	return sqlStr, args, nil
+}
+
+// Query 编译并执行指标查询
+func (s *MetricService) Query(ctx context.Context, principal *auth.Principal, q core.MetricQuery) (string, []map[string]interface{}, error) {
+	sqlStr, args, err := s.Compile(q)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// 语义层基于内置表结构定义，在调用方工作区的 default 数据源上执行
+	_, ds, err := auth.ResolveDataSource(principal, config.DefaultDataSource)
+	if err != nil {
+		return "", nil, err
+	}
+	if !ds.BuiltinSchema() {
+		return "", nil, ErrNoSemanticLayer
+	}
+	policy := config.GetAccessPolicy()
+	if err := auth.AuthorizeDataSource(principal, policy, config.DefaultDataSource); err != nil {
+		return "", nil, err
+	}
+
+	results, err := runStatement(ctx, Statement{
+		Principal:  principal,
+		DataSource: config.DefaultDataSource,
+		Source:     models.AuditSourceMetric,
+		SQL:        sqlStr,
+		Args:       args,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	return sqlStr, results, nil
+}
@@ -0,0 +1,81 @@
+package services
+
+import (
+	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"d2t_server/internal/models"
+	"fmt"
+	"sync"
+)
+
+var (
+	// rowSecurityReady 已创建行级安全策略的数据源，按连接串和表结构文件区分
+	rowSecurityReady = make(map[string]bool)
+	rowSecurityMu    sync.Mutex
+)
+
+// ensureRowSecurity 首次需要时按访问策略在数据源中创建数据库角色和行级安全策略；失败时下次重试
+func ensureRowSecurity(policy *config.AccessPolicy, ds *config.DataSourceConfig) error {
+	rowSecurityMu.Lock()
+	defer rowSecurityMu.Unlock()
+
+	key := ds.DSN + "|" + ds.SchemaFile
+	if rowSecurityReady[key] {
+		return nil
+	}
+
+	stmts, err := auth.RowSecurityStatements(policy, core.SchemaFor(ds.Schema))
+	if err != nil {
+		return err
+	}
+	db, err := models.GetDataSourceDB(ds.DSN)
+	if err != nil {
+		return fmt.Errorf("数据库连接失败: %w", err)
+	}
+	if err := models.ApplyStatements(db, stmts); err != nil {
+		return fmt.Errorf("创建行级安全策略失败: %w", err)
+	}
+	rowSecurityReady[key] = true
+	return nil
+}
+
+// executeForPrincipal 按调用方在数据源上执行查询；配置了行级过滤的受限用户在专用数据库角色下执行，
+// 由 PostgreSQL 行级安全策略过滤数据。返回的结果已按调用方角色脱敏，之后的所有环节（响应、分析）只接触脱敏后的值
+// 所有语句都在只读事务中执行并在之后回滚，即使SQL检查漏掉了修改数据的函数也不会留下任何改动；
+// limits 不为 nil 时同时按限制执行；beforeMask 不为 nil 时在脱敏前用原始结果调用
+func executeForPrincipal(principal *auth.Principal, ds *config.DataSourceConfig, limits *models.ExecLimits, beforeMask func([]map[string]interface{}), sqlStr string, args ...interface{}) ([]map[string]interface{}, error) {
+	policy := config.GetAccessPolicy()
+	rs, err := auth.ResolveRowSecurity(principal, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := models.GetDataSourceDB(ds.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	var execLimits models.ExecLimits
+	if limits != nil {
+		execLimits = *limits
+	}
+	var role string
+	var settings map[string]string
+	if rs != nil {
+		if err := ensureRowSecurity(policy, ds); err != nil {
+			return nil, err
+		}
+		role, settings = rs.Role, rs.Settings
+	}
+	results, err := models.ExecuteSQLLimited(db, role, settings, execLimits, sqlStr, args...)
+	if err != nil {
+		return nil, fmt.Errorf("执行SQL失败: %w", err)
+	}
+
+	if beforeMask != nil {
+		beforeMask(results)
+	}
+	maskResults(principal, core.SchemaFor(ds.Schema), sqlStr, results)
+	return results, nil
+}
@@ -1,39 +1,396 @@
 package services
 
 import (
+	"context"
 	"d2t_server/core"
+	"d2t_server/internal/auth"
+	"d2t_server/internal/cache"
+	"d2t_server/internal/config"
+	"d2t_server/internal/embedding"
+	"d2t_server/internal/metrics"
 	"d2t_server/internal/models"
+	"d2t_server/utils"
+	"errors"
 	"fmt"
+	"log/slog"
+	"time"
 )
 
+// ErrNotAwaitingClarification 查询历史不是等待用户回答澄清问题的状态
+var ErrNotAwaitingClarification = errors.New("query history is not awaiting clarification")
+
+// QARequest 一次问答请求
+type QARequest struct {
+	Question   string
+	DataSource string
+	Principal  *auth.Principal
+	// Clarification 继续一次需要澄清的问答时，为大模型的澄清问题、建议选项和用户的回答
+	Clarification *models.Clarification
+	// ParentID 继续问答时为需要澄清的那条查询历史
+	ParentID int64
+	// Candidates 生成的候选SQL数，大于 1 时按执行结果投票；0 表示使用 SQL_CANDIDATES
+	Candidates int
+	// Meter 累计本次请求调用大模型消耗的 token，可为 nil
+	Meter *utils.UsageMeter
+}
+
+// QAResult 一次问答的结果
+type QAResult struct {
+	HistoryID     int64
+	SQL           string
+	PromptVersion string
+	Analysis      string
+	Results       []map[string]interface{}
+	Usage         utils.Usage
+	Cache         CacheStatus
+	// Details 结构化输出中大模型报告的表、假设和置信度，SQL不是本次生成时（语义缓存命中）或大模型未按格式输出时为 nil
+	Details *core.GenerationDetails
+	// Chart 按结果列的类型和基数推荐的图表，结果不适合作图时为 nil
+	Chart *core.Chart
+	// Voting 生成了多条候选SQL时的投票结果，否则为 nil
+	Voting *VotingResult
+}
+
+// CacheStatus 本次问答是否命中了缓存的SQL和查询结果
+type CacheStatus struct {
+	SQL     bool `json:"sql"`
+	Results bool `json:"results"`
+	// Semantic 复用了语义相近的已验证示例的SQL时，为该示例的问题和相似度
+	Semantic *embedding.Match `json:"semantic,omitempty"`
+}
+
 // QAService 处理问答相关的业务逻辑
 type QAService struct {
+	examples *ExampleService
 }
 
 // NewQAService 创建一个新的QAService实例
 func NewQAService() *QAService {
-	return &QAService{}
+	return &QAService{examples: NewExampleService()}
 }
 
 // ProcessQuestion 处理问题并返回结果
-func (s *QAService) ProcessQuestion(question string) (string, string, []map[string]interface{}, error) {
-	// 处理自然语言查询
-	sqlStr, analysisResult, err := core.ProcessNaturalLanguageQuery(question)
+// 无论成功与否都会写入查询历史；出错时返回的结果中只有 HistoryID 有效
+func (s *QAService) ProcessQuestion(ctx context.Context, req QARequest) (*QAResult, error) {
+	if req.DataSource == "" {
+		req.DataSource = config.DefaultDataSource
+	}
+	if req.Meter == nil {
+		req.Meter = &utils.UsageMeter{}
+	}
+
+	start := time.Now()
+	result, err := s.process(ctx, req)
+	if err == nil {
+		result.Chart = core.RecommendChart(result.Results)
+	}
+
+	history := &models.QueryHistory{
+		Workspace:     req.Principal.WorkspaceName(),
+		DataSource:    req.DataSource,
+		Question:      req.Question,
+		SQL:           result.SQL,
+		PromptVersion: result.PromptVersion,
+		Status:        models.HistoryStatusSuccess,
+		RowCount:      len(result.Results),
+		DurationMs:    time.Since(start).Milliseconds(),
+	}
+	switch {
+	case errors.Is(err, core.ErrClarificationNeeded):
+		// 记录澄清问题和建议选项，用户回答后通过 ResumeClarification 继续
+		history.Status = models.HistoryStatusClarification
+		history.Clarification = &models.Clarification{
+			Question: result.Details.Clarification,
+			Options:  result.Details.Options,
+		}
+	case err != nil:
+		history.Status = models.HistoryStatusError
+		history.Error = err.Error()
+	}
+	if req.Clarification != nil {
+		// 继续的问答再次需要澄清时保留新的澄清问题
+		if history.Clarification == nil {
+			history.Clarification = req.Clarification
+		}
+		history.ParentID = req.ParentID
+	}
+	result.HistoryID = s.recordHistory(ctx, history)
+	result.Usage = req.Meter.Total()
+
+	return result, err
+}
+
+// process 生成SQL、执行并分析
+func (s *QAService) process(ctx context.Context, req QARequest) (*QAResult, error) {
+	result := &QAResult{}
+	policy := config.GetAccessPolicy()
+
+	// 数据源只在调用方所属的工作区中查找
+	ws, ds, err := auth.ResolveDataSource(req.Principal, req.DataSource)
+	if err != nil {
+		return result, err
+	}
+	if err := auth.AuthorizeDataSource(req.Principal, policy, req.DataSource); err != nil {
+		return result, err
+	}
+
+	// 从工作区的示例库挑选与问题最相似的已验证示例，并去掉引用了调用方无权访问的表或列的示例
+	access := auth.ResolveAccess(req.Principal, policy)
+	verified := s.examples.Verified(ws.Name, req.DataSource, access, core.SchemaFor(ds.Schema))
+	examples := s.examples.SelectFor(req.Question, verified)
+
+	// 使用工作区和数据源对应的提示词模板生成SQL，提示词中只包含该数据源中调用方可访问的表和列
+	genReq := core.GenerateRequest{
+		Question:       req.Question,
+		DataSource:     req.DataSource,
+		SchemaDDL:      ds.Schema,
+		PromptVersions: ws.PromptVersions,
+		Examples:       examples,
+		Access:         access,
+		Meter:          req.Meter,
+	}
+	if req.Clarification != nil {
+		genReq.Clarification = &utils.Clarification{Question: req.Clarification.Question, Answer: req.Clarification.Answer}
+	}
+
+	// 相同的规范化问题在提示词模板版本、表结构和示例都不变时复用之前生成的SQL
+	answers := cache.Default()
+	question := core.NormalizeQuestion(req.Question)
+	var sqlKey *cache.SQLKey
+	if version, hash, err := core.PromptFingerprint(genReq); err == nil {
+		sqlKey = &cache.SQLKey{
+			Workspace:     ws.Name,
+			DataSource:    req.DataSource,
+			Question:      question,
+			PromptVersion: version,
+			ContextHash:   hash,
+		}
+		if req.Clarification != nil {
+			sqlKey.Clarification = core.NormalizeQuestion(req.Clarification.Answer)
+		}
+	}
+
+	var results []map[string]interface{}
+	executed := false
+	votingCfg := config.GetVotingConfig()
+	if entry, ok := s.cachedSQL(answers, sqlKey); ok {
+		result.SQL = entry.SQL
+		result.PromptVersion = entry.PromptVersion
+		result.Details = entry.Details
+		result.Cache.SQL = true
+	} else if match := s.semanticMatch(ctx, req, verified); match != nil {
+		// 换了说法的问题直接复用语义相近的已验证示例的SQL，不调用大模型
+		result.SQL = match.SQL
+		result.Cache.Semantic = match
+	} else if n := candidateCount(votingCfg, req.Candidates); n > 1 {
+		// 生成多条候选SQL，执行后按结果投票，选中的候选已经执行过
+		vote, err := s.voteCandidates(ctx, req, genReq, votingCfg, n)
+		if vote != nil {
+			result.SQL = vote.SQL
+			result.PromptVersion = vote.PromptVersion
+			result.Details = vote.Details
+			result.Voting = vote.Voting
+		}
+		if err != nil {
+			return result, err
+		}
+		if vote.Executed {
+			results, executed = vote.Results, true
+		}
+	} else {
+		generation, err := core.Generate(ctx, genReq)
+		if errors.Is(err, core.ErrClarificationNeeded) {
+			// 问题有歧义，大模型要求用户补充信息，不是生成失败
+			result.PromptVersion = generation.PromptVersion
+			result.Details = generation.Details
+			return result, err
+		}
+		if err != nil {
+			metrics.PipelineError(metrics.StageGeneration)
+			return result, fmt.Errorf("处理查询失败: %w", err)
+		}
+		result.SQL = generation.SQL
+		result.PromptVersion = generation.PromptVersion
+		result.Details = generation.Details
+	}
+	sqlStr := result.SQL
+
+	// 结果经过行级过滤和脱敏，只对同一调用方、同样的角色和行级过滤取值复用；命中时不执行SQL，只写一条 cached 审计记录
+	resultKey := cache.ResultKey{
+		Workspace:  ws.Name,
+		DataSource: req.DataSource,
+		Question:   question,
+		Principal:  req.Principal.Type + ":" + req.Principal.ID,
+		Roles:      req.Principal.Roles,
+		SQL:        sqlStr,
+	}
+	if rs, err := auth.ResolveRowSecurity(req.Principal, policy); err == nil && rs != nil {
+		resultKey.RowSettings = rs.Settings
+	}
+	if !executed {
+		stmt := Statement{
+			Principal:  req.Principal,
+			DataSource: req.DataSource,
+			Source:     models.AuditSourceAsk,
+			SQL:        sqlStr,
+		}
+		if entry, ok := answers.GetResult(resultKey); ok {
+			recordCachedResult(ctx, stmt, len(entry.Results))
+			result.Results = entry.Results
+			result.Analysis = entry.Analysis
+			result.Cache.Results = true
+			return result, nil
+		}
+
+		// 检查生成的SQL只访问了角色允许的表和列后执行，按调用方应用行级过滤并对结果脱敏
+		results, err = runStatement(ctx, stmt)
+		if err != nil {
+			return result, err
+		}
+	}
+	result.Results = results
+
+	// 只缓存执行成功的生成结果，避免反复返回无法执行或被拒绝的SQL
+	if sqlKey != nil && !result.Cache.SQL && result.Cache.Semantic == nil {
+		answers.PutSQL(*sqlKey, cache.SQLEntry{SQL: sqlStr, PromptVersion: result.PromptVersion, Details: result.Details})
+	}
+
+	// 分析结果，只传入脱敏后的结果，失败不影响主流程
+	result.Analysis = s.analyze(ctx, req, ws.PromptVersions, sqlStr, results)
+	if result.Analysis != core.NoAnalysis {
+		answers.PutResult(resultKey, cache.ResultEntry{Results: results, Analysis: result.Analysis})
+	}
+
+	return result, nil
+}
+
+// analyze 默认根据问题、SQL、列统计和结果样例用自然语言回答问题；ANALYSIS_MODE=analyze 时只解释SQL
+func (s *QAService) analyze(ctx context.Context, req QARequest, promptVersions, sqlStr string, results []map[string]interface{}) string {
+	cfg := config.GetAnalysisConfig()
+	if cfg.Mode == config.AnalysisExplain {
+		return core.Analyze(ctx, core.AnalyzeRequest{
+			SQL:            sqlStr,
+			DataSource:     req.DataSource,
+			PromptVersions: promptVersions,
+			Results:        results,
+			Meter:          req.Meter,
+		})
+	}
+	return core.Summarize(ctx, core.SummarizeRequest{
+		Question:       req.Question,
+		SQL:            sqlStr,
+		DataSource:     req.DataSource,
+		PromptVersions: promptVersions,
+		Results:        results,
+		SampleRows:     cfg.SampleRows,
+		MaxInputChars:  cfg.MaxInputChars,
+		Meter:          req.Meter,
+	})
+}
+
+// semanticMatch 在调用方可以使用的已验证示例中查找与问题语义相近的一条；向量化失败时记录日志并回退到生成
+func (s *QAService) semanticMatch(ctx context.Context, req QARequest, verified []utils.FewShotExample) *embedding.Match {
+	index := embedding.Default()
+	// 用户回答了澄清问题时，相近示例的SQL不一定符合用户选择的解释
+	if index == nil || len(verified) == 0 || req.Clarification != nil {
+		return nil
+	}
+
+	candidates := make([]embedding.Candidate, len(verified))
+	for i, e := range verified {
+		candidates[i] = embedding.Candidate{Question: e.Question, SQL: e.SQL}
+	}
+	match, err := index.Nearest(ctx, req.Question, candidates, req.Meter)
+	if err != nil {
+		slog.WarnContext(ctx, "semantic cache lookup failed", "data_source", req.DataSource, "error", err)
+		return nil
+	}
+	return match
+}
+
+// cachedSQL 查找缓存的SQL；无法计算提示词指纹时不使用缓存
+func (s *QAService) cachedSQL(answers *cache.Cache, key *cache.SQLKey) (*cache.SQLEntry, bool) {
+	if key == nil {
+		return nil, false
+	}
+	return answers.GetSQL(*key)
+}
+
+// recordHistory 写入查询历史，失败时只记录日志并返回 0
+func (s *QAService) recordHistory(ctx context.Context, history *models.QueryHistory) int64 {
+	db, err := models.GetAppDB()
+	if err == nil {
+		err = models.InsertQueryHistory(db, history)
+	}
+	if err != nil {
+		slog.WarnContext(ctx, "failed to record query history", "error", err)
+		return 0
+	}
+	return history.ID
+}
+
+// ResumeClarification 用用户对澄清问题的回答继续调用方工作区中一条需要澄清的查询历史：
+// 以原问题、原数据源和该回答重新生成SQL并执行，结果写入一条新的查询历史
+func (s *QAService) ResumeClarification(ctx context.Context, principal *auth.Principal, historyID int64, choice string, meter *utils.UsageMeter) (*QAResult, error) {
+	appDB, err := models.GetAppDB()
+	if err != nil {
+		return &QAResult{}, fmt.Errorf("数据库连接失败: %w", err)
+	}
+
+	history, err := models.GetQueryHistory(appDB, principal.WorkspaceName(), historyID)
 	if err != nil {
-		return "", "", nil, fmt.Errorf("处理查询失败: %w", err)
+		return &QAResult{}, err
+	}
+	if history == nil {
+		return &QAResult{}, ErrHistoryNotFound
+	}
+	if history.Status != models.HistoryStatusClarification || history.Clarification == nil {
+		return &QAResult{}, ErrNotAwaitingClarification
 	}
 
-	// 获取数据库连接
-	db, err := models.GetPGDBConnection()
+	return s.ProcessQuestion(ctx, QARequest{
+		Question:   history.Question,
+		DataSource: history.DataSource,
+		Principal:  principal,
+		Clarification: &models.Clarification{
+			Question: history.Clarification.Question,
+			Options:  history.Clarification.Options,
+			Answer:   choice,
+		},
+		ParentID: historyID,
+		Meter:    meter,
+	})
+}
+
+// ExecuteHistory 重新执行调用方工作区中一条成功的查询历史中的SQL，不调用大模型
+func (s *QAService) ExecuteHistory(ctx context.Context, principal *auth.Principal, historyID int64) (*models.QueryHistory, []map[string]interface{}, error) {
+	appDB, err := models.GetAppDB()
 	if err != nil {
-		return "", "", nil, fmt.Errorf("数据库连接失败: %w", err)
+		return nil, nil, fmt.Errorf("数据库连接失败: %w", err)
 	}
 
-	// 执行SQL查询
-	results, err := models.ExecuteSQL(db, sqlStr)
+	history, err := models.GetQueryHistory(appDB, principal.WorkspaceName(), historyID)
 	if err != nil {
-		return "", "", nil, fmt.Errorf("执行SQL失败: %w", err)
+		return nil, nil, err
+	}
+	if history == nil || history.Status != models.HistoryStatusSuccess || history.SQL == "" {
+		return nil, nil, ErrHistoryNotFound
 	}
 
-	return sqlStr, analysisResult, results, nil
+	// 重新执行时按当前调用方的角色重新授权
+	policy := config.GetAccessPolicy()
+	if err := auth.AuthorizeDataSource(principal, policy, history.DataSource); err != nil {
+		return nil, nil, err
+	}
+
+	results, err := runStatement(ctx, Statement{
+		Principal:  principal,
+		DataSource: history.DataSource,
+		Source:     models.AuditSourceHistory,
+		SQL:        history.SQL,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return history, results, nil
 }
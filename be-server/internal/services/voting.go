@@ -0,0 +1,181 @@
+package services
+
+import (
+	"context"
+	"d2t_server/core"
+	"d2t_server/internal/config"
+	"d2t_server/internal/metrics"
+	"d2t_server/internal/models"
+	"d2t_server/utils"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// VotingResult 多候选生成的投票结果
+type VotingResult struct {
+	// Agreement 结果与选中的SQL相同的候选占生成成功的候选的比例
+	Agreement float64 `json:"agreement"`
+	// Candidates 每条不同的候选SQL，按得票从高到低
+	Candidates []CandidateResult `json:"candidates"`
+}
+
+// CandidateResult 一条候选SQL的执行结果和得票
+type CandidateResult struct {
+	SQL string `json:"sql"`
+	// Temperatures 生成了这条SQL的采样温度
+	Temperatures []float64 `json:"temperatures"`
+	// Votes 结果与这条SQL相同的候选数（包括它自己），执行失败时为 0
+	Votes int `json:"votes"`
+	Rows  int `json:"rows"`
+	// Truncated 结果超过 SQL_CANDIDATE_MAX_ROWS，只比较了前面的行
+	Truncated bool   `json:"truncated,omitempty"`
+	Chosen    bool   `json:"chosen"`
+	Error     string `json:"error,omitempty"`
+
+	generation  core.Generation
+	results     []map[string]interface{}
+	fingerprint string
+	err         error
+}
+
+// votedSQL 投票选出的SQL；Executed 为 false 时结果被截断，需要不限行数重新执行
+type votedSQL struct {
+	core.Generation
+	Voting   *VotingResult
+	Results  []map[string]interface{}
+	Executed bool
+}
+
+// candidateCount 本次生成的候选数：请求中指定的数量，未指定时为 SQL_CANDIDATES，不超过 SQL_MAX_CANDIDATES
+func candidateCount(cfg config.VotingConfig, requested int) int {
+	n := cfg.Candidates
+	if requested > 0 {
+		n = requested
+	}
+	return min(n, cfg.MaxCandidates)
+}
+
+// voteCandidates 以不同的采样温度并发生成 n 条候选SQL，相同的SQL只执行一次，在超时和行数限制下
+// 并发执行后按结果集分组（忽略行顺序、列顺序和列名），选出结果相同的候选最多的一组；
+// 票数相同时选先生成的候选（SQL_CANDIDATE_TEMPERATURES 中靠前的温度）。所有候选都执行失败时返回第一条候选的SQL和执行错误
+func (s *QAService) voteCandidates(ctx context.Context, req QARequest, genReq core.GenerateRequest, cfg config.VotingConfig, n int) (*votedSQL, error) {
+	temperatures := make([]float64, n)
+	for i := range temperatures {
+		temperatures[i] = cfg.Temperatures[i%len(cfg.Temperatures)]
+	}
+
+	generated, clarification, err := core.GenerateCandidates(ctx, genReq, temperatures)
+	if clarification != nil {
+		return &votedSQL{Generation: *clarification}, err
+	}
+	if err != nil {
+		metrics.PipelineError(metrics.StageGeneration)
+		return nil, fmt.Errorf("处理查询失败: %w", err)
+	}
+
+	// 相同的SQL（忽略空白差异）合并为一条候选
+	var distinct []*CandidateResult
+	bySQL := make(map[string]*CandidateResult)
+	counts := make(map[*CandidateResult]int)
+	for _, g := range generated {
+		key := strings.Join(strings.Fields(g.SQL), " ")
+		c, ok := bySQL[key]
+		if !ok {
+			c = &CandidateResult{SQL: g.SQL, generation: g.Generation}
+			bySQL[key] = c
+			distinct = append(distinct, c)
+		}
+		c.Temperatures = append(c.Temperatures, g.Temperature)
+		counts[c]++
+	}
+
+	limits := &models.ExecLimits{Timeout: cfg.Timeout, MaxRows: cfg.MaxRows}
+	var wg sync.WaitGroup
+	for _, c := range distinct {
+		wg.Add(1)
+		go func(c *CandidateResult) {
+			defer wg.Done()
+			// 指纹在脱敏前计算，只有脱敏列不同的结果不会被当作相同的答案
+			var fingerprint string
+			results, err := runStatement(ctx, Statement{
+				Principal:  req.Principal,
+				DataSource: req.DataSource,
+				Source:     models.AuditSourceCandidate,
+				SQL:        c.SQL,
+				Limits:     limits,
+				BeforeMask: func(raw []map[string]interface{}) {
+					if cfg.MaxRows > 0 && len(raw) > cfg.MaxRows {
+						raw = raw[:cfg.MaxRows]
+					}
+					fingerprint = utils.ResultFingerprint(raw)
+				},
+			})
+			if err != nil {
+				c.err, c.Error = err, err.Error()
+				return
+			}
+			if cfg.MaxRows > 0 && len(results) > cfg.MaxRows {
+				results, c.Truncated = results[:cfg.MaxRows], true
+			}
+			c.results, c.Rows = results, len(results)
+			c.fingerprint = fingerprint
+		}(c)
+	}
+	wg.Wait()
+
+	voting, chosen := tally(distinct, counts, len(generated))
+	if chosen == nil {
+		first := distinct[0]
+		return &votedSQL{Generation: first.generation, Voting: voting}, first.err
+	}
+	metrics.ObserveVoting(len(generated), voting.Agreement)
+	slog.InfoContext(ctx, "sql candidates voted", "data_source", req.DataSource, "candidates", len(generated),
+		"distinct", len(distinct), "agreement", voting.Agreement)
+
+	return &votedSQL{
+		Generation: chosen.generation,
+		Voting:     voting,
+		Results:    chosen.results,
+		Executed:   !chosen.Truncated,
+	}, nil
+}
+
+// tally 按结果指纹计票：每条执行成功的候选得到结果相同的候选数，counts 为每条不同SQL被生成的次数；
+// 没有候选执行成功时 chosen 为 nil
+func tally(distinct []*CandidateResult, counts map[*CandidateResult]int, generated int) (voting *VotingResult, chosen *CandidateResult) {
+	votes := make(map[string]int)
+	for _, c := range distinct {
+		if c.Error == "" {
+			votes[c.fingerprint] += counts[c]
+		}
+	}
+	for _, c := range distinct {
+		if c.Error != "" {
+			continue
+		}
+		c.Votes = votes[c.fingerprint]
+		if chosen == nil || c.Votes > chosen.Votes {
+			chosen = c
+		}
+	}
+
+	voting = &VotingResult{Candidates: make([]CandidateResult, 0, len(distinct))}
+	for _, c := range distinct {
+		voting.Candidates = append(voting.Candidates, *c)
+	}
+	sort.SliceStable(voting.Candidates, func(a, b int) bool {
+		return voting.Candidates[a].Votes > voting.Candidates[b].Votes
+	})
+
+	if chosen == nil {
+		return voting, nil
+	}
+	for i := range voting.Candidates {
+		voting.Candidates[i].Chosen = voting.Candidates[i].SQL == chosen.SQL
+	}
+	voting.Agreement = float64(chosen.Votes) / float64(generated)
+	return voting, chosen
+}
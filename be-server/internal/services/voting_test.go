@@ -0,0 +1,129 @@
+package services
+
+import (
+	"d2t_server/internal/config"
+	"d2t_server/utils"
+	"errors"
+	"testing"
+)
+
+// candidate stubs an executed candidate; nil rows means it failed
+func candidate(sql string, rows []map[string]interface{}) *CandidateResult {
+	c := &CandidateResult{SQL: sql}
+	if rows == nil {
+		c.err = errors.New("column does not exist")
+		c.Error = c.err.Error()
+		return c
+	}
+	c.results, c.Rows = rows, len(rows)
+	c.fingerprint = utils.ResultFingerprint(rows)
+	return c
+}
+
+func TestTally(t *testing.T) {
+	byState := []map[string]interface{}{{"state": "CA", "n": int64(2)}, {"state": "NY", "n": int64(1)}}
+	// same rows in another order and under other column names
+	byStateAliased := []map[string]interface{}{{"c": 1.0, "s": "NY"}, {"c": int32(2), "s": "CA"}}
+	other := []map[string]interface{}{{"state": "CA", "n": int64(3)}}
+
+	tests := []struct {
+		name      string
+		distinct  []*CandidateResult
+		counts    []int
+		generated int
+		chosen    string
+		votes     map[string]int
+		agreement float64
+	}{
+		{
+			name:      "equal results are grouped",
+			distinct:  []*CandidateResult{candidate("a", other), candidate("b", byState), candidate("c", byStateAliased)},
+			counts:    []int{1, 1, 1},
+			generated: 3,
+			chosen:    "b",
+			votes:     map[string]int{"a": 1, "b": 2, "c": 2},
+			agreement: 2.0 / 3,
+		},
+		{
+			name:      "tie goes to the first candidate",
+			distinct:  []*CandidateResult{candidate("a", other), candidate("b", byState)},
+			counts:    []int{1, 1},
+			generated: 2,
+			chosen:    "a",
+			votes:     map[string]int{"a": 1, "b": 1},
+			agreement: 0.5,
+		},
+		{
+			name:      "duplicate generations count",
+			distinct:  []*CandidateResult{candidate("a", other), candidate("b", byState)},
+			counts:    []int{1, 2},
+			generated: 3,
+			chosen:    "b",
+			votes:     map[string]int{"a": 1, "b": 2},
+			agreement: 2.0 / 3,
+		},
+		{
+			name:      "failed candidates get no votes",
+			distinct:  []*CandidateResult{candidate("a", nil), candidate("b", byState)},
+			counts:    []int{2, 1},
+			generated: 3,
+			chosen:    "b",
+			votes:     map[string]int{"a": 0, "b": 1},
+			agreement: 1.0 / 3,
+		},
+		{
+			name:      "all failed",
+			distinct:  []*CandidateResult{candidate("a", nil), candidate("b", nil)},
+			counts:    []int{1, 1},
+			generated: 2,
+			chosen:    "",
+			votes:     map[string]int{"a": 0, "b": 0},
+			agreement: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counts := make(map[*CandidateResult]int)
+			for i, c := range tt.distinct {
+				counts[c] = tt.counts[i]
+			}
+
+			voting, chosen := tally(tt.distinct, counts, tt.generated)
+
+			if tt.chosen == "" {
+				if chosen != nil {
+					t.Fatalf("chosen = %q, want none", chosen.SQL)
+				}
+			} else if chosen == nil || chosen.SQL != tt.chosen {
+				t.Fatalf("chosen = %+v, want %q", chosen, tt.chosen)
+			}
+			if voting.Agreement != tt.agreement {
+				t.Errorf("agreement = %v, want %v", voting.Agreement, tt.agreement)
+			}
+			if len(voting.Candidates) != len(tt.distinct) {
+				t.Fatalf("got %d candidates, want %d", len(voting.Candidates), len(tt.distinct))
+			}
+			for i, c := range voting.Candidates {
+				if c.Votes != tt.votes[c.SQL] {
+					t.Errorf("%s: votes = %d, want %d", c.SQL, c.Votes, tt.votes[c.SQL])
+				}
+				if c.Chosen != (c.SQL == tt.chosen) {
+					t.Errorf("%s: chosen = %v", c.SQL, c.Chosen)
+				}
+				if i > 0 && c.Votes > voting.Candidates[i-1].Votes {
+					t.Errorf("candidates are not ordered by votes: %+v", voting.Candidates)
+				}
+			}
+		})
+	}
+}
+
+func TestCandidateCount(t *testing.T) {
+	cfg := config.VotingConfig{Candidates: 3, MaxCandidates: 5}
+	for requested, want := range map[int]int{0: 3, 1: 1, 4: 4, 9: 5} {
+		if got := candidateCount(cfg, requested); got != want {
+			t.Errorf("candidateCount(%d) = %d, want %d", requested, got, want)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"d2t_server/internal/auth"
+	"d2t_server/internal/config"
+	"fmt"
+)
+
+// AllWorkspaces 引导管理员Key在列表类管理接口中表示全部工作区的取值
+const AllWorkspaces = "*"
+
+// AdminWorkspace 返回管理接口操作的工作区：默认为调用方所属的工作区；
+// 只有引导管理员Key可以指定其他工作区，allowAll 时还可以用 * 表示全部工作区（返回空字符串）
+func AdminWorkspace(p *auth.Principal, requested string, allowAll bool) (string, error) {
+	own := p.WorkspaceName()
+	if requested == "" || requested == own {
+		return own, nil
+	}
+	if p == nil || !p.Operator {
+		return "", fmt.Errorf("%w: workspace %s is not accessible", auth.ErrForbidden, requested)
+	}
+	if requested == AllWorkspaces {
+		if !allowAll {
+			return "", fmt.Errorf("%w: a single workspace is required", auth.ErrForbidden)
+		}
+		return "", nil
+	}
+	if _, ok := config.GetWorkspaces().Get(requested); !ok {
+		return "", fmt.Errorf("%w: unknown workspace %s", auth.ErrForbidden, requested)
+	}
+	return requested, nil
+}
@@ -0,0 +1,48 @@
+package services
+
+import (
+	"d2t_server/internal/auth"
+	"errors"
+	"testing"
+)
+
+func TestAdminWorkspace(t *testing.T) {
+	user := &auth.Principal{Type: auth.PrincipalAPIKey, ID: "key-1", Workspace: "sales", Scopes: []string{auth.ScopeAdmin}}
+	operator := &auth.Principal{Type: auth.PrincipalAPIKey, ID: "bootstrap", Scopes: []string{auth.ScopeAdmin}, Operator: true}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		requested string
+		allowAll  bool
+		want      string
+		denied    bool
+	}{
+		{"own workspace by default", user, "", true, "sales", false},
+		{"own workspace by name", user, "sales", false, "sales", false},
+		{"other workspace", user, "default", false, "", true},
+		{"unknown workspace", user, "support", false, "", true},
+		{"all workspaces", user, AllWorkspaces, true, "", true},
+		{"anonymous", &auth.Principal{Type: auth.PrincipalAnonymous}, "sales", true, "", true},
+		{"nil principal", nil, "sales", true, "", true},
+		{"operator own workspace", operator, "", false, "default", false},
+		{"operator other workspace", operator, "default", false, "default", false},
+		{"operator unknown workspace", operator, "sales", false, "", true},
+		{"operator all workspaces", operator, AllWorkspaces, true, "", false},
+		{"operator all workspaces not allowed", operator, AllWorkspaces, false, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AdminWorkspace(tt.principal, tt.requested, tt.allowAll)
+			if tt.denied {
+				if !errors.Is(err, auth.ErrForbidden) {
+					t.Fatalf("got %q, %v, want ErrForbidden", got, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("got %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
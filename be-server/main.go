@@ -1,13 +1,29 @@
 package main
 
 import (
+	"context"
 	"d2t_server/internal/api"
 	"d2t_server/internal/config"
+	"d2t_server/internal/devtoken"
+	"d2t_server/internal/eval"
+	"d2t_server/internal/logging"
+	"d2t_server/internal/tracing"
 	"flag"
-	"log"
+	"log/slog"
+	"os"
 )
 
 func main() {
+	// 子命令：d2t eval ... / d2t devtoken ...
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "eval":
+			os.Exit(eval.Main(os.Args[2:]))
+		case "devtoken":
+			os.Exit(devtoken.Main(os.Args[2:]))
+		}
+	}
+
 	// 解析命令行参数
 	envFile := flag.String("env", "", "Path to .env file")
 	flag.Parse()
@@ -15,12 +31,30 @@ func main() {
 	// 加载配置
 	cfg, err := config.LoadConfig(*envFile)
 	if err != nil {
-		log.Fatalf("Failed to load configuration: %v", err)
+		slog.Error("failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// 按配置初始化结构化日志
+	logging.Setup(cfg.Log)
+
+	// 没有大模型密钥时无法回答任何问题，启动即失败
+	if err := cfg.LLM.Validate(); err != nil {
+		slog.Error("invalid LLM configuration", "error", err)
+		os.Exit(1)
+	}
+
+	// 初始化 OpenTelemetry 追踪，退出前导出尚未发送的 span
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing)
+	if err != nil {
+		slog.Error("failed to set up tracing", "error", err)
+		os.Exit(1)
 	}
+	defer shutdownTracing(context.Background())
 
 	// 输出数据库连接信息
 	if cfg.DB.User != "" {
-		log.Printf("Database configuration loaded successfully. Connected as user: %s", cfg.DB.User)
+		slog.Info("database configuration loaded", "db_user", cfg.DB.User, "db_host", cfg.DB.Host, "db_name", cfg.DB.Name)
 	}
 
 	// 创建服务器
@@ -28,6 +62,8 @@ func main() {
 
 	// 启动服务器
 	if err := server.Start(); err != nil {
-		log.Fatalf("Server failed to start: %v", err)
+		slog.Error("server failed to start", "error", err)
+		shutdownTracing(context.Background())
+		os.Exit(1)
 	}
 }
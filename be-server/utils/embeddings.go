@@ -0,0 +1,107 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"d2t_server/internal/config"
+	"d2t_server/internal/metrics"
+	"d2t_server/internal/requestid"
+	"d2t_server/internal/tracing"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+// embeddingMode labels embedding calls in metrics and traces
+const embeddingMode = "embedding"
+
+// Embeddings sends texts to the OpenAI-compatible embeddings endpoint and
+// returns one vector per text, in input order. Token usage goes to meter.
+func Embeddings(ctx context.Context, cfg config.EmbeddingConfig, texts []string, meter *UsageMeter) (vectors [][]float64, err error) {
+	if cfg.APIURL == "" {
+		return nil, fmt.Errorf("EMBEDDING_API_URL is not configured")
+	}
+	provider := cfg.APIURL
+	if u, err := url.Parse(cfg.APIURL); err == nil && u.Host != "" {
+		provider = u.Host
+	}
+
+	ctx, span := tracing.Start(ctx, "llm."+embeddingMode,
+		attribute.String("gen_ai.system", provider),
+		attribute.String("gen_ai.request.model", cfg.Model),
+		attribute.Int("d2t.embedding.inputs", len(texts)),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	jsonData, err := json.Marshal(map[string]interface{}{"model": cfg.Model, "input": texts})
+	if err != nil {
+		return nil, fmt.Errorf("json序列化失败: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", cfg.APIURL, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("创建请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", cfg.APIKey))
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	client := &http.Client{Timeout: config.GetAPIConfig().Timeout}
+	start := time.Now()
+	var usage Usage
+	defer func() {
+		metrics.ObserveLLMCall(provider, cfg.Model, embeddingMode, time.Since(start), err, usage.PromptTokens, 0)
+		span.SetAttributes(attribute.Int64("gen_ai.usage.input_tokens", usage.PromptTokens))
+		meter.Record(usage)
+	}()
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	slog.DebugContext(ctx, "embedding response", "model", cfg.Model, "status", resp.StatusCode,
+		"duration_ms", time.Since(start).Milliseconds(), "inputs", len(texts))
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+
+	var response struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+		Usage Usage `json:"usage"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	usage = response.Usage
+
+	vectors = make([][]float64, len(texts))
+	for _, d := range response.Data {
+		if d.Index >= 0 && d.Index < len(vectors) {
+			vectors[d.Index] = d.Embedding
+		}
+	}
+	for i, v := range vectors {
+		if len(v) == 0 {
+			return nil, fmt.Errorf("响应中缺少第 %d 个输入的向量", i)
+		}
+	}
+	return vectors, nil
+}
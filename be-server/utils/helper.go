@@ -2,17 +2,25 @@ package utils
 
 import (
 	"bytes"
+	"context"
 	"d2t_server/internal/config"
+	"d2t_server/internal/logging"
+	"d2t_server/internal/metrics"
+	"d2t_server/internal/prompts"
+	"d2t_server/internal/requestid"
+	"d2t_server/internal/tracing"
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
 	"regexp"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
 )
 
 type Response struct {
@@ -21,89 +29,186 @@ type Response struct {
 	Data      interface{} `json:"data,omitempty"`
 }
 
-func getAskURL() string {
-	return "https://api.deepseek.com/chat/completions"
+// FewShotExample is a verified question/SQL pair included in the nl2sql prompt
+type FewShotExample = prompts.Example
+
+// Clarification is the user's answer to a clarifying question of the model
+type Clarification = prompts.Clarification
+
+// DefaultDialect is the SQL dialect announced to the model
+const DefaultDialect = "PostgreSQL"
+
+// PromptRequest describes one templated call to the LLM
+type PromptRequest struct {
+	Mode       string
+	Input      string
+	DataSource string
+	// PromptVersions are workspace overrides of PROMPT_VERSIONS, same syntax
+	PromptVersions string
+	Schema         string
+	Dialect        string
+	Examples       []FewShotExample
+	Clarification  *Clarification
+	// Temperature overrides the provider's default sampling temperature
+	Temperature *float64
+	// Results is a rendered sample of (already masked) query results
+	Results string
+	// SQL, Columns and RowCount describe the executed query and its result
+	// for the summarize mode
+	SQL      string
+	Columns  string
+	RowCount int
+	// Meter, when set, receives the token usage of the call
+	Meter *UsageMeter
+}
+
+// PromptResponse is the model answer together with the template version used
+type PromptResponse struct {
+	Content       string
+	PromptVersion string
+	// Format is the output format the template asked for, e.g.
+	// prompts.ResponseFormatJSON; empty for free text
+	Format string
+	Usage  Usage
 }
 
 // DeepseekRequest handles all interactions with the Deepseek API
 // mode: "nl2sql" for natural language to SQL conversion, "analyze" for SQL analysis, "nl2sql_with_schema" for NL to SQL with DB schema
 func DeepseekRequest(input string, mode string, schema ...string) (string, error) {
-	url := getAskURL()
+	return DeepseekRequestWithExamples(input, mode, nil, schema...)
+}
 
-	// Define request structure
-	type Message struct {
-		Role    string `json:"role"`
-		Content string `json:"content"`
+// DeepseekRequestWithExamples is DeepseekRequest with few-shot examples
+func DeepseekRequestWithExamples(input string, mode string, examples []FewShotExample, schema ...string) (string, error) {
+	req := PromptRequest{Mode: mode, Input: input, Examples: examples}
+	if len(schema) > 0 {
+		req.Schema = schema[0]
 	}
 
-	type RequestBody struct {
-		Model    string    `json:"model"`
-		Messages []Message `json:"messages"`
+	resp, err := DeepseekPrompt(context.Background(), req)
+	if err != nil {
+		return "", err
 	}
+	return resp.Content, nil
+}
 
-	// Build request body based on mode
-	var reqBody RequestBody
-	reqBody.Model = "deepseek-chat"
+// DeepseekPrompt renders the prompt template selected for the mode and data
+// source and sends it to the configured chat completions endpoint. The request
+// ID carried by ctx is forwarded to the provider.
+func DeepseekPrompt(ctx context.Context, prompt PromptRequest) (resp *PromptResponse, err error) {
+	if prompt.Mode == "nl2sql_with_schema" && prompt.Schema == "" {
+		return nil, fmt.Errorf("schema is required for nl2sql_with_schema mode")
+	}
+	if prompt.Dialect == "" {
+		prompt.Dialect = DefaultDialect
+	}
 
-	switch mode {
-	case "nl2sql":
-		reqBody.Messages = []Message{
-			{
-				Role:    "user",
-				Content: "我想把如下问题转换成sql语句: " + input,
-			},
-		}
-	case "nl2sql_with_schema":
-		if len(schema) == 0 {
-			return "", fmt.Errorf("schema is required for nl2sql_with_schema mode")
-		}
+	tmpl, err := prompts.ResolveFor(prompt.Mode, prompt.DataSource, prompt.PromptVersions)
+	if err != nil {
+		return nil, err
+	}
+	messages, err := tmpl.Render(prompts.Vars{
+		Input:         prompt.Input,
+		Schema:        prompt.Schema,
+		Dialect:       prompt.Dialect,
+		Examples:      prompt.Examples,
+		Clarification: prompt.Clarification,
+		Results:       prompt.Results,
+		SQL:           prompt.SQL,
+		Columns:       prompt.Columns,
+		RowCount:      prompt.RowCount,
+	})
+	if err != nil {
+		return nil, err
+	}
+	slog.InfoContext(ctx, "llm request", "mode", prompt.Mode, "prompt_version", tmpl.Version, "input_length", len(prompt.Input))
+	slog.DebugContext(ctx, "llm request input", "mode", prompt.Mode, "input", prompt.Input)
+
+	llmConfig := config.GetLLMConfig()
+	ctx, span := tracing.Start(ctx, "llm."+prompt.Mode,
+		attribute.String("gen_ai.system", llmConfig.Provider),
+		attribute.String("gen_ai.request.model", llmConfig.Model),
+		attribute.String("d2t.prompt.mode", prompt.Mode),
+		attribute.String("d2t.prompt.version", tmpl.Version),
+		attribute.String("d2t.data_source", prompt.DataSource),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// The provider's JSON mode guarantees syntactically valid JSON; the prompt
+	// itself still has to describe the expected object
+	format := tmpl.ResponseFormat()
+	responseFormat := ""
+	if format == prompts.ResponseFormatJSON && llmConfig.JSONMode {
+		responseFormat = format
+	}
 
-		prettyJSON, _ := json.MarshalIndent(reqBody, "", "  ")
-		log.Printf("请求体: %s", string(prettyJSON))
-		log.Printf("DeepseekRequest: 模式=%s, 输入=%s", mode, input)
-		reqBody.Messages = []Message{
-			{
-				Role:    "system",
-				Content: "You are an SQL expert. Convert natural language questions to SQL queries. Use the provided database schema to create accurate queries. Only respond with valid SQL queries, no explanations.",
-			},
-			{
-				Role:    "user",
-				Content: "Database Schema:\n" + schema[0] + "\n\nConvert this question to SQL: " + input,
-			},
-		}
-	case "analyze":
-		reqBody.Messages = []Message{
-			{
-				Role:    "system",
-				Content: "You are an SQL expert. Analyze the provided SQL query and explain its purpose, potential optimizations, and any issues it might have.",
-			},
-			{
-				Role:    "user",
-				Content: input,
-			},
-		}
-	default:
-		return "", fmt.Errorf("未知的操作模式: %s", mode)
+	start := time.Now()
+	content, usage, err := chatCompletion(ctx, llmConfig, messages, responseFormat, prompt.Temperature)
+	metrics.ObserveLLMCall(llmConfig.Provider, llmConfig.Model, prompt.Mode, time.Since(start), err, usage.PromptTokens, usage.CompletionTokens)
+	span.SetAttributes(
+		attribute.Int64("gen_ai.usage.input_tokens", usage.PromptTokens),
+		attribute.Int64("gen_ai.usage.output_tokens", usage.CompletionTokens),
+	)
+	prompt.Meter.Record(usage)
+	if err != nil {
+		return nil, err
+	}
+	return &PromptResponse{Content: content, PromptVersion: tmpl.Version, Format: format, Usage: usage}, nil
+}
+
+// chatCompletion sends the rendered messages to the LLM and returns the first
+// answer together with the token usage reported by the provider. A non-empty
+// responseFormat (e.g. json_object) is passed as the OpenAI-style
+// response_format; a nil temperature leaves the provider's default.
+func chatCompletion(ctx context.Context, llmConfig config.LLMConfig, messages []prompts.Message, responseFormat string, temperature *float64) (string, Usage, error) {
+	if err := llmConfig.Validate(); err != nil {
+		return "", Usage{}, err
+	}
+	url := llmConfig.APIURL
+
+	// Define request structure
+	type ResponseFormat struct {
+		Type string `json:"type"`
+	}
+	type RequestBody struct {
+		Model          string            `json:"model"`
+		Messages       []prompts.Message `json:"messages"`
+		ResponseFormat *ResponseFormat   `json:"response_format,omitempty"`
+		Temperature    *float64          `json:"temperature,omitempty"`
+	}
+
+	reqBody := RequestBody{
+		Model:       llmConfig.Model,
+		Messages:    messages,
+		Temperature: temperature,
+	}
+	if responseFormat != "" {
+		reqBody.ResponseFormat = &ResponseFormat{Type: responseFormat}
 	}
 
 	// Serialize request body to JSON
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
-		return "", fmt.Errorf("json序列化失败: %v", err)
+		return "", Usage{}, fmt.Errorf("json序列化失败: %v", err)
 	}
 
 	// Create HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
-		return "", fmt.Errorf("创建请求失败: %v", err)
+		return "", Usage{}, fmt.Errorf("创建请求失败: %v", err)
 	}
 
 	// Set headers
 	req.Header.Set("Content-Type", "application/json")
 
 	// Add API key
-	apiKey := "sk-05560ff5cfcf472188f269aff3fb053b"
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", apiKey))
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", llmConfig.APIKey))
+
+	// Propagate the request ID so provider-side logs can be correlated
+	if id := requestid.FromContext(ctx); id != "" {
+		req.Header.Set(requestid.Header, id)
+	}
+	tracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
 
 	// Get API timeout config
 	apiConfig := config.GetAPIConfig()
@@ -113,42 +218,54 @@ func DeepseekRequest(input string, mode string, schema ...string) (string, error
 		Timeout: apiConfig.Timeout,
 	}
 
-	log.Printf("Making API request with timeout of %v seconds", apiConfig.Timeout.Seconds())
+	start := time.Now()
 	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("请求失败: %v", err)
+		slog.ErrorContext(ctx, "llm request failed", "model", llmConfig.Model, "timeout", apiConfig.Timeout, "error", err)
+		return "", Usage{}, fmt.Errorf("请求失败: %v", err)
 	}
 	defer resp.Body.Close()
 
 	// Read response
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return "", fmt.Errorf("读取响应失败: %v", err)
+		return "", Usage{}, fmt.Errorf("读取响应失败: %v", err)
 	}
 
 	// Check HTTP status code
+	slog.InfoContext(ctx, "llm response", "model", llmConfig.Model, "status", resp.StatusCode,
+		"duration_ms", time.Since(start).Milliseconds(), "response_bytes", len(body))
 	if resp.StatusCode != http.StatusOK {
-		return "", fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+		return "", Usage{}, fmt.Errorf("API请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
 	}
 
 	// Parse response
 	var response map[string]interface{}
 	if err := json.Unmarshal(body, &response); err != nil {
-		return "", fmt.Errorf("解析响应失败: %v", err)
+		return "", Usage{}, fmt.Errorf("解析响应失败: %v", err)
+	}
+
+	// Token usage is billed even when no usable content is returned
+	var usage Usage
+	if raw, ok := response["usage"]; ok {
+		if data, err := json.Marshal(raw); err == nil {
+			json.Unmarshal(data, &usage)
+		}
 	}
 
-	log.Printf("Deepseek响应: %v", response["choices"])
+	slog.DebugContext(ctx, "llm response body", logging.KeyLLMResponse, string(body),
+		"prompt_tokens", usage.PromptTokens, "completion_tokens", usage.CompletionTokens)
 	if choices, ok := response["choices"].([]interface{}); ok && len(choices) > 0 {
 		if firstChoice, ok := choices[0].(map[string]interface{}); ok {
 			if message, ok := firstChoice["message"].(map[string]interface{}); ok {
 				if content, ok := message["content"].(string); ok {
-					return content, nil
+					return content, usage, nil
 				}
 			}
 		}
 	}
 
-	return "", fmt.Errorf("无法从响应中提取有效内容: %s", string(body))
+	return "", usage, fmt.Errorf("无法从响应中提取有效内容: %s", string(body))
 }
 
 // CleanSQLFromMarkdown removes markdown formatting from SQL strings
@@ -0,0 +1,82 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RowKeys normalises every row of a result set into a comparable string. Row
+// order, column order and column names are ignored; numbers, times and strings
+// are normalised so that equivalent values from different queries or driver
+// types produce the same key.
+func RowKeys(rows []map[string]interface{}) []string {
+	keys := make([]string, len(rows))
+	for i, row := range rows {
+		values := make([]string, 0, len(row))
+		for _, v := range row {
+			values = append(values, normalizeValue(v))
+		}
+		sort.Strings(values)
+		keys[i] = "(" + strings.Join(values, ", ") + ")"
+	}
+	return keys
+}
+
+// ResultFingerprint identifies a result set as a multiset of RowKeys: two
+// result sets have the same fingerprint exactly when their row keys match
+func ResultFingerprint(rows []map[string]interface{}) string {
+	keys := RowKeys(rows)
+	sort.Strings(keys)
+	sum := sha256.Sum256([]byte(strings.Join(keys, "\n")))
+	return hex.EncodeToString(sum[:])
+}
+
+// normalizeValue converts the values of the different driver types to one text form
+func normalizeValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return "NULL"
+	case []byte:
+		return normalizeValue(string(val))
+	case string:
+		s := strings.TrimSpace(val)
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return formatNumber(f)
+		}
+		return s
+	case bool:
+		return strconv.FormatBool(val)
+	case int64:
+		return formatNumber(float64(val))
+	case int32:
+		return formatNumber(float64(val))
+	case int:
+		return formatNumber(float64(val))
+	case float64:
+		return formatNumber(val)
+	case float32:
+		return formatNumber(float64(val))
+	case time.Time:
+		if val.Hour() == 0 && val.Minute() == 0 && val.Second() == 0 && val.Nanosecond() == 0 {
+			return val.Format("2006-01-02")
+		}
+		return val.UTC().Format(time.RFC3339)
+	default:
+		return fmt.Sprintf("%v", val)
+	}
+}
+
+// formatNumber rounds to 4 decimals to hide numeric/float precision differences
+func formatNumber(f float64) string {
+	rounded := math.Round(f*1e4) / 1e4
+	if rounded == 0 {
+		rounded = 0 // drop -0
+	}
+	return strconv.FormatFloat(rounded, 'f', -1, 64)
+}
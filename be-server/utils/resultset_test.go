@@ -0,0 +1,48 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestResultFingerprint(t *testing.T) {
+	base := []map[string]interface{}{
+		{"state": "CA", "revenue": 10.5},
+		{"state": "NY", "revenue": int64(3)},
+	}
+
+	same := map[string][]map[string]interface{}{
+		"row order":    {{"state": "NY", "revenue": int64(3)}, {"state": "CA", "revenue": 10.5}},
+		"column names": {{"s": "CA", "total": 10.5}, {"s": "NY", "total": int64(3)}},
+		"numeric type": {{"state": "CA", "revenue": []byte("10.50")}, {"state": "NY", "revenue": 3.0}},
+		"whitespace":   {{"state": "CA  ", "revenue": 10.5}, {"state": "NY", "revenue": int32(3)}},
+	}
+	for name, rows := range same {
+		if ResultFingerprint(rows) != ResultFingerprint(base) {
+			t.Errorf("%s: fingerprints differ", name)
+		}
+	}
+
+	different := map[string][]map[string]interface{}{
+		"missing row":   {{"state": "CA", "revenue": 10.5}},
+		"duplicate row": {{"state": "CA", "revenue": 10.5}, {"state": "CA", "revenue": 10.5}, {"state": "NY", "revenue": int64(3)}},
+		"other value":   {{"state": "CA", "revenue": 10.6}, {"state": "NY", "revenue": int64(3)}},
+		"null":          {{"state": "CA", "revenue": nil}, {"state": "NY", "revenue": int64(3)}},
+	}
+	for name, rows := range different {
+		if ResultFingerprint(rows) == ResultFingerprint(base) {
+			t.Errorf("%s: fingerprints match", name)
+		}
+	}
+}
+
+func TestRowKeysDates(t *testing.T) {
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	if got := RowKeys([]map[string]interface{}{{"d": day}})[0]; got != "(2024-03-01)" {
+		t.Fatalf("date key = %s", got)
+	}
+	ts := time.Date(2024, 3, 1, 12, 30, 0, 0, time.FixedZone("CET", 3600))
+	if got := RowKeys([]map[string]interface{}{{"t": ts}})[0]; got != "(2024-03-01T11:30:00Z)" {
+		t.Fatalf("timestamp key = %s", got)
+	}
+}
@@ -0,0 +1,44 @@
+package utils
+
+import "sync"
+
+// Usage is the token accounting reported by the provider in the `usage` block
+type Usage struct {
+	PromptTokens     int64 `json:"prompt_tokens"`
+	CompletionTokens int64 `json:"completion_tokens"`
+	TotalTokens      int64 `json:"total_tokens"`
+}
+
+// Add accumulates another usage report
+func (u *Usage) Add(other Usage) {
+	u.PromptTokens += other.PromptTokens
+	u.CompletionTokens += other.CompletionTokens
+	u.TotalTokens += other.TotalTokens
+}
+
+// UsageMeter collects the usage of every LLM call made for one request; it is
+// safe for concurrent use and a nil meter ignores all reports
+type UsageMeter struct {
+	mu    sync.Mutex
+	usage Usage
+}
+
+// Record adds the usage of one call
+func (m *UsageMeter) Record(u Usage) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.usage.Add(u)
+}
+
+// Total returns the usage recorded so far
+func (m *UsageMeter) Total() Usage {
+	if m == nil {
+		return Usage{}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.usage
+}
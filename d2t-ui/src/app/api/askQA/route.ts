@@ -66,11 +66,16 @@ export async function POST(request: NextRequest) {
     // Forward the request to the external service - no transformation needed
     // since the backend expects 'question' parameter which is already correct
     devLog("Sending fetch request to backend...");
+    const headers: Record<string, string> = {
+      "Content-Type": "application/json",
+    };
+    // 后端开启认证时，使用服务端环境变量中的API Key（不会暴露给浏览器）
+    if (process.env.D2T_API_KEY) {
+      headers["X-API-Key"] = process.env.D2T_API_KEY;
+    }
     const response = await fetch(apiUrl, {
       method: "POST",
-      headers: {
-        "Content-Type": "application/json",
-      },
+      headers,
       body: JSON.stringify(body), // Forward the original body without transformation
     });
     devLog("Received response from backend, status:", response.status);